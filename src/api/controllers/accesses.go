@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"time"
+)
+
+const maxUserAgentLength int = 512
+
+// responseStatus returns status of the handled request. Errors are written
+// to the response after handlers return, so status of the last error is
+// taken if there is one.
+func responseStatus(c *gin.Context) int {
+	if err := c.Errors.Last(); err != nil {
+		var serviceErr base.ServiceError
+		if errors.As(err.Err, &serviceErr) && serviceErr.Status != 0 {
+			return serviceErr.Status
+		}
+		return http.StatusInternalServerError
+	}
+	return c.Writer.Status()
+}
+
+// accessOutcome tells what came of download attempt of the response status.
+func accessOutcome(status int) string {
+	switch status {
+	case http.StatusOK:
+		return base.AccessOutcomeDownloaded
+	case http.StatusPartialContent:
+		return base.AccessOutcomePartial
+	case http.StatusNotModified:
+		return base.AccessOutcomeNotModified
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return base.AccessOutcomeDenied
+	case http.StatusNotFound, http.StatusGone:
+		return base.AccessOutcomeUnavailable
+	default:
+		return base.AccessOutcomeFailed
+	}
+}
+
+// newFileAccess describes download attempt of a file by the handled
+// request. Bytes sent are left to the caller.
+func newFileAccess(c *gin.Context, fileId string, owner string) *api.FileAccess {
+	status := responseStatus(c)
+	access := &api.FileAccess{
+		FileIdentifier: fileId,
+		Owner:          owner,
+		Time:           time.Now().Unix(),
+		ClientIP:       c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		Outcome:        accessOutcome(status),
+		Status:         status,
+	}
+	if len(access.UserAgent) > maxUserAgentLength {
+		access.UserAgent = access.UserAgent[:maxUserAgentLength]
+	}
+	if user := getOptionalUser(c); user != nil {
+		access.Username = user.Username
+	}
+	return access
+}
+
+// saveFileAccess adds the download attempt to access log and counts it for
+// the file. Errors are only logged, downloads do not depend on the log.
+func (controller FilesController) saveFileAccess(access *api.FileAccess) {
+	err := controller.FileAccessLogService.AddFileAccess(access)
+	if err == nil {
+		err = controller.FilesMetadataService.RegisterFileAccess(access)
+	}
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": access.FileIdentifier,
+			"error":      err.Error(),
+		}).Error("Record file access error")
+	}
+}
+
+// recordFileAccess logs download attempt of a file once the request is
+// handled, it is deferred by download handlers. Share token is empty for
+// downloads without share link.
+func (controller FilesController) recordFileAccess(
+	c *gin.Context,
+	fileId string,
+	owner string,
+	shareToken string,
+) {
+	access := newFileAccess(c, fileId, owner)
+	access.ShareLink = shareToken
+	if access.Status < http.StatusBadRequest {
+		access.BytesSent = int64(max(c.Writer.Size(), 0))
+	}
+	controller.saveFileAccess(access)
+}
+
+// GetFileAccesses Get file download attempts
+// @Summary      Get file download attempts
+// @Description  This method returns download attempts of a file of
+// @Description  authorized user from the newest one, with client address
+// @Description  and user agent, the share link and the user the file was
+// @Description  requested with, outcome and bytes sent. Attempts are kept
+// @Description  for configured days, also after the file was deleted
+// @Tags         Files
+// @Security     User
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 _ 	  query     api.PaginationQueryParameters false "Pagination parameters"
+// @Success      200  {object}  api.FileAccessListResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/accesses [get]
+func (controller FilesController) GetFileAccesses(c *gin.Context) {
+	base.Logger.Info("Requested file accesses")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+
+	fileId := c.Param(base.FileIdPathParam)
+	if fileId == "" {
+		c.Error(base.NewPathParamRequiredError(base.FileIdPathParam))
+		return
+	}
+	queryParams, err := controller.parsePaginationQueryParams(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Purged files have no metadata, their accesses are still listed to
+	// the owner recorded with them.
+	_, fileErr := controller.FilesMetadataService.GetFileMetadataByOwner(
+		fileId, auth.Username,
+	)
+	var serviceErr base.ServiceError
+	if fileErr != nil && !(errors.As(fileErr, &serviceErr) &&
+		serviceErr.Status == http.StatusNotFound) {
+		c.Error(fileErr)
+		return
+	}
+	response, err := controller.FileAccessLogService.GetFileAccesses(
+		fileId, auth.Username, queryParams,
+	)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if fileErr != nil && response.Total == 0 {
+		c.Error(fileErr)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"testing"
+)
+
+// captureAccesses collects download attempts added to access log.
+func captureAccesses(accessLogMock *tests.BaseFileAccessLogService) *[]*api.FileAccess {
+	accesses := []*api.FileAccess{}
+	accessLogMock.ExpectedCalls = nil
+	accessLogMock.On("AddFileAccess", mock.Anything).Run(func(args mock.Arguments) {
+		accesses = append(accesses, args.Get(0).(*api.FileAccess))
+	}).Return(nil)
+	return &accesses
+}
+
+func TestAccessOutcome(t *testing.T) {
+	for status, expected := range map[int]string{
+		http.StatusOK:                           base.AccessOutcomeDownloaded,
+		http.StatusPartialContent:               base.AccessOutcomePartial,
+		http.StatusNotModified:                  base.AccessOutcomeNotModified,
+		http.StatusUnauthorized:                 base.AccessOutcomeDenied,
+		http.StatusForbidden:                    base.AccessOutcomeDenied,
+		http.StatusTooManyRequests:              base.AccessOutcomeDenied,
+		http.StatusNotFound:                     base.AccessOutcomeUnavailable,
+		http.StatusGone:                         base.AccessOutcomeUnavailable,
+		http.StatusRequestedRangeNotSatisfiable: base.AccessOutcomeFailed,
+		http.StatusInternalServerError:          base.AccessOutcomeFailed,
+	} {
+		assert.Equal(t, expected, accessOutcome(status), status)
+	}
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileRecordsAccess() {
+	fileId := s.FileMetadataFixture.Identifier
+	accesses := captureAccesses(s.AccessLogMock)
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.RemoteAddr = "203.0.113.7:40000"
+	req.Header.Set("User-Agent", "curl/8.4.0")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Len(s.T(), *accesses, 1)
+	access := (*accesses)[0]
+	assert.Equal(s.T(), fileId, access.FileIdentifier)
+	assert.Equal(s.T(), s.UserFixture.Username, access.Owner)
+	assert.Equal(s.T(), "203.0.113.7", access.ClientIP)
+	assert.Equal(s.T(), "curl/8.4.0", access.UserAgent)
+	assert.Empty(s.T(), access.Username)
+	assert.Empty(s.T(), access.ShareLink)
+	assert.Equal(s.T(), base.AccessOutcomeDownloaded, access.Outcome)
+	assert.Equal(s.T(), http.StatusOK, access.Status)
+	assert.Equal(s.T(), int64(4), access.BytesSent)
+	s.MetadataServiceMock.AssertCalled(s.T(), "RegisterFileAccess", access)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileRecordsPartialAccessOfUser() {
+	fileId := s.FileMetadataFixture.Identifier
+	accesses := captureAccesses(s.AccessLogMock)
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequestAs("GET", "/files/"+fileId, "jane_doe")
+	req.Header.Set("Range", "bytes=1-2")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusPartialContent, recorder.Code)
+	assert.Len(s.T(), *accesses, 1)
+	assert.Equal(s.T(), "jane_doe", (*accesses)[0].Username)
+	assert.Equal(s.T(), base.AccessOutcomePartial, (*accesses)[0].Outcome)
+	assert.Equal(s.T(), int64(2), (*accesses)[0].BytesSent)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileRecordsDeniedAccess() {
+	fileId := s.FileMetadataFixture.Identifier
+	accesses := captureAccesses(s.AccessLogMock)
+	s.protectWithPassword("p@ssw0rd")
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set(base.FilePasswordHeader, "wrong")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	assert.Len(s.T(), *accesses, 1)
+	assert.Equal(s.T(), base.AccessOutcomeDenied, (*accesses)[0].Outcome)
+	assert.Equal(s.T(), http.StatusForbidden, (*accesses)[0].Status)
+	assert.Zero(s.T(), (*accesses)[0].BytesSent)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadMissingFileNotRecorded() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		nil, base.NewFileNotFoundError(fileId),
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	s.AccessLogMock.AssertNotCalled(s.T(), "AddFileAccess", mock.Anything)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileAccess", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadExpiredFileNotRecorded() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		nil, base.NewFileExpiredError(fileId),
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+	s.AccessLogMock.AssertNotCalled(s.T(), "AddFileAccess", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileLimitReachedRecordsAccess() {
+	fileId := s.FileMetadataFixture.Identifier
+	accesses := captureAccesses(s.AccessLogMock)
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+	s.MetadataServiceMock.On("RegisterFileDownload", fileId).Return(
+		nil, base.NewFileDownloadLimitError(fileId),
+	)
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+	assert.Len(s.T(), *accesses, 1)
+	assert.Equal(s.T(), s.UserFixture.Username, (*accesses)[0].Owner)
+	assert.Equal(s.T(), http.StatusGone, (*accesses)[0].Status)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileAccessLogError() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.AccessLogMock.ExpectedCalls = nil
+	s.AccessLogMock.On("AddFileAccess", mock.Anything).Return(
+		base.NewDatabaseError(assert.AnError),
+	)
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileAccess", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileUntrustedProxy() {
+	fileId := s.FileMetadataFixture.Identifier
+	accesses := captureAccesses(s.AccessLogMock)
+	s.mockDownloadableFile()
+	s.mockFileContent()
+	assert.NoError(s.T(), s.Router.SetTrustedProxies([]string{"10.0.0.0/8"}))
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.RemoteAddr = "203.0.113.7:40000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	s.serve(req)
+	req = s.newRequest("GET", "/files/"+fileId, false)
+	req.RemoteAddr = "10.0.0.2:40000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	s.serve(req)
+
+	assert.Len(s.T(), *accesses, 2)
+	assert.Equal(s.T(), "203.0.113.7", (*accesses)[0].ClientIP)
+	assert.Equal(s.T(), "198.51.100.1", (*accesses)[1].ClientIP)
+}
+
+func (s *FilesApiTestSuite) TestApiGetFileAccesses() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockOwnedFile()
+	s.AccessLogMock.On(
+		"GetFileAccesses", fileId, s.UserFixture.Username,
+		&api.PaginationQueryParameters{Skip: 1, Limit: 2},
+	).Return(&api.FileAccessListResponse{
+		Records: []*api.FileAccess{{
+			FileIdentifier: fileId,
+			Owner:          s.UserFixture.Username,
+			ClientIP:       "203.0.113.7",
+			Outcome:        base.AccessOutcomeDownloaded,
+			Status:         http.StatusOK,
+			BytesSent:      4,
+		}},
+		Total: 3,
+	}, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId+"/accesses?skip=1&limit=2", true))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	var response api.FileAccessListResponse
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(s.T(), int64(3), response.Total)
+	assert.Len(s.T(), response.Records, 1)
+	assert.Equal(s.T(), "203.0.113.7", response.Records[0].ClientIP)
+	assert.Equal(s.T(), int64(4), response.Records[0].BytesSent)
+}
+
+func (s *FilesApiTestSuite) TestApiGetFileAccessesOfPurgedFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(nil, base.NewFileNotFoundError(fileId))
+	s.AccessLogMock.On(
+		"GetFileAccesses", fileId, s.UserFixture.Username, mock.Anything,
+	).Return(&api.FileAccessListResponse{
+		Records: []*api.FileAccess{{Outcome: base.AccessOutcomeDownloaded}},
+		Total:   1,
+	}, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId+"/accesses", true))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiGetFileAccessesOfMissingFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(nil, base.NewFileNotFoundError(fileId))
+	s.AccessLogMock.On(
+		"GetFileAccesses", fileId, s.UserFixture.Username, mock.Anything,
+	).Return(&api.FileAccessListResponse{Records: []*api.FileAccess{}}, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId+"/accesses", true))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiGetFileAccessesOfAnotherUser() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(nil, base.NewFileAccessDeniedError(fileId))
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId+"/accesses", true))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.AccessLogMock.AssertNotCalled(
+		s.T(), "GetFileAccesses", mock.Anything, mock.Anything, mock.Anything,
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiGetFileAccessesInvalidLimit() {
+	fileId := s.FileMetadataFixture.Identifier
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId+"/accesses?limit=0", true))
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileRecordsAccess() {
+	accesses := captureAccesses(s.AccessLogMock)
+	s.mockSharedDownload()
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Len(s.T(), *accesses, 1)
+	assert.Equal(s.T(), s.FileMetadataFixture.Identifier, (*accesses)[0].FileIdentifier)
+	assert.Equal(s.T(), s.UserFixture.Username, (*accesses)[0].Owner)
+	assert.Equal(s.T(), s.LinkFixture.Token, (*accesses)[0].ShareLink)
+	assert.Equal(s.T(), int64(4), (*accesses)[0].BytesSent)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileDisabledLinkRecordsAccess() {
+	accesses := captureAccesses(s.AccessLogMock)
+	s.LinkFixture.Enabled = false
+	s.mockLink()
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	assert.Len(s.T(), *accesses, 1)
+	assert.Equal(s.T(), base.AccessOutcomeDenied, (*accesses)[0].Outcome)
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadBundleArchiveRecordsAccesses() {
+	accesses := captureAccesses(s.AccessLogMock)
+	s.mockBundle()
+	s.MetadataServiceMock.On("RegisterFileDownload", "second").Return(
+		nil, base.NewFileDownloadLimitError("second"),
+	)
+	s.mockDownloads()
+
+	recorder := s.serve(s.newRequest("/bundles/bundle/archive"))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	sent := map[string]int64{}
+	for _, access := range *accesses {
+		assert.Equal(s.T(), base.AccessOutcomeDownloaded, access.Outcome)
+		sent[access.FileIdentifier] = access.BytesSent
+	}
+	assert.Equal(s.T(), map[string]int64{
+		"first": int64(len("first content")),
+		"third": int64(len("third content")),
+	}, sent)
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadBundleArchiveRecordsDeniedAccesses() {
+	accesses := captureAccesses(s.AccessLogMock)
+	for i := range s.FilesFixture {
+		s.FilesFixture[i].PasswordProtected = true
+		s.FilesFixture[i].PasswordHash = "$2a$04$invalid"
+	}
+	s.mockBundle()
+
+	recorder := s.serve(s.newRequest("/bundles/bundle/archive"))
+
+	assert.Equal(s.T(), http.StatusUnauthorized, recorder.Code)
+	assert.Len(s.T(), *accesses, 3)
+	for _, access := range *accesses {
+		assert.Equal(s.T(), base.AccessOutcomeDenied, access.Outcome)
+	}
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"net/http"
 	"stealthy-backend/api/services"
 	"stealthy-backend/base"
@@ -30,3 +31,21 @@ func (controller AuthorizationController) Authorize(context *gin.Context) {
 	context.Set("auth", user)
 	context.Next()
 }
+
+// AuthorizeOptionally authenticates requests which send valid
+// authorization token, requests without token or with invalid one continue
+// anonymously.
+func (controller AuthorizationController) AuthorizeOptionally(context *gin.Context) {
+	tokenString := context.GetHeader("Authorization")
+	if tokenString != "" {
+		user, err := controller.AuthService.ParseToken(tokenString)
+		if err == nil {
+			context.Set("auth", user)
+		} else {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Debug("Invalid authorization token, continuing anonymously")
+		}
+	}
+	context.Next()
+}
@@ -1,8 +1,10 @@
 package controllers
 
 import (
+	"crypto/rand"
 	"encoding/base64"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"net/http"
 	"stealthy-backend/api"
@@ -13,6 +15,44 @@ func generateShortUUID() string {
 	return base64.RawURLEncoding.EncodeToString([]byte(uuid.New().String()))
 }
 
+// generateToken returns random URL safe token which can not be guessed,
+// unlike identifiers derived from UUID.
+func generateToken() (string, error) {
+	value := make([]byte, base.ShareTokenBytes)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
+
+// bindJSONRequest reads and validates JSON body. Errors are already added
+// to the context, gin responds itself if the body can not be parsed.
+func bindJSONRequest(
+	c *gin.Context,
+	schemaValidator *validator.Validate,
+	request any,
+) error {
+	if err := c.BindJSON(request); err != nil {
+		return err
+	}
+	if err := schemaValidator.Struct(request); err != nil {
+		err = base.WrapValidationErrors(err)
+		c.Error(err)
+		return err
+	}
+	return nil
+}
+
+// getOptionalUser returns user of optionally authorized request, nil for
+// anonymous requests.
+func getOptionalUser(c *gin.Context) *api.User {
+	value, exists := c.Get("auth")
+	if !exists {
+		return nil
+	}
+	return value.(*api.User)
+}
+
 func GetAuthenticatedUser(c *gin.Context) (*api.User, error) {
 	value, exists := c.Get("auth")
 	if !exists {
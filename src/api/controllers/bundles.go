@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"stealthy-backend/api"
+	"stealthy-backend/api/services"
+	"stealthy-backend/base"
+	"strings"
+	"time"
+)
+
+type BundlesController struct {
+	Files FilesController
+}
+
+// getBundleFiles returns the requested bundle with metadata of its files
+// which are not expired or deleted yet. Files which are not public are left
+// out unless the requester may access them.
+func (controller BundlesController) getBundleFiles(
+	c *gin.Context,
+) (*api.Bundle, []api.FileMetadata, error) {
+	bundleId := c.Param(base.BundleIdPathParam)
+	if bundleId == "" {
+		return nil, nil, base.NewPathParamRequiredError(base.BundleIdPathParam)
+	}
+
+	bundle, err := controller.Files.BundlesService.GetBundle(bundleId)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := controller.Files.FilesMetadataService.GetFilesMetadata(bundle.Files)
+	if err != nil {
+		return nil, nil, err
+	}
+	user := getOptionalUser(c)
+	files = slices.DeleteFunc(files, func(fileMetadata api.FileMetadata) bool {
+		return !isFileListed(user, &fileMetadata)
+	})
+	if len(files) == 0 {
+		return nil, nil, base.NewBundleExpiredError(bundleId)
+	}
+	return bundle, files, nil
+}
+
+// GetBundle Get bundle
+// @Summary      Get bundle
+// @Description  This method lists files of a bundle uploaded in one
+// @Description  request. Expired and deleted files are left out, as are
+// @Description  private files unless authorized user may access them
+// @Tags         Bundles
+// @Produce      json
+// @Param 		 identifier path string true "Bundle ID" example(NWJlODYxZjctZDNkYi00ZTJiLWI0ZGYtMzIyNDhkNDQ0ZjA4)
+// @Success      200  {object}  api.BundleResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/bundles/{identifier} [get]
+func (controller BundlesController) GetBundle(c *gin.Context) {
+	base.Logger.Info("Requested bundle")
+
+	bundle, files, err := controller.getBundleFiles(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	response := api.BundleResponse{
+		Identifier: bundle.Identifier,
+		Creation:   bundle.Creation,
+		Expiration: bundle.Expiration,
+		Files:      make([]*api.BundleFile, len(files)),
+	}
+	for i, fileMetadata := range files {
+		response.Files[i] = &api.BundleFile{
+			Identifier:        fileMetadata.Identifier,
+			Name:              fileMetadata.Name,
+			Size:              fileMetadata.Size,
+			Mimetype:          fileMetadata.Mimetype,
+			Expiration:        fileMetadata.Expiration,
+			PasswordProtected: fileMetadata.PasswordProtected,
+			EndToEndEncrypted: fileMetadata.EndToEndEncrypted,
+			SHA256:            fileMetadata.SHA256,
+		}
+	}
+	c.IndentedJSON(http.StatusOK, &response)
+}
+
+// selectArchiveFiles leaves out files which can not be served. Password
+// of protected files is checked once for every password hash, files of a
+// bundle share the hash.
+func (controller BundlesController) selectArchiveFiles(
+	c *gin.Context,
+	files []api.FileMetadata,
+) ([]api.FileMetadata, error) {
+	checkedHashes := map[string]bool{}
+	selected := []api.FileMetadata{}
+	for i := range files {
+		fileMetadata := &files[i]
+		if controller.Files.checkFileAccess(c, fileMetadata) != nil ||
+			controller.Files.checkScanStatus(fileMetadata) != nil {
+			continue
+		}
+		if fileMetadata.PasswordProtected && !checkedHashes[fileMetadata.PasswordHash] {
+			if err := controller.Files.checkFilePassword(c, fileMetadata); err != nil {
+				return nil, err
+			}
+			checkedHashes[fileMetadata.PasswordHash] = true
+		}
+		selected = append(selected, *fileMetadata)
+	}
+	return selected, nil
+}
+
+// registerDownloads counts a download of every file, files which expired
+// or reached their download limit meanwhile are left out.
+func (controller BundlesController) registerDownloads(
+	files []api.FileMetadata,
+) ([]api.FileMetadata, error) {
+	registered := []api.FileMetadata{}
+	for _, file := range files {
+		fileMetadata, err := controller.Files.FilesMetadataService.RegisterFileDownload(
+			file.Identifier,
+		)
+		var serviceErr base.ServiceError
+		if errors.As(err, &serviceErr) && (serviceErr.Status == http.StatusGone ||
+			serviceErr.Status == http.StatusNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		registered = append(registered, *fileMetadata)
+	}
+	return registered, nil
+}
+
+// archiveEntryName returns the file name, numbered if a file of the same
+// name is already in the archive.
+func archiveEntryName(usedNames map[string]bool, name string) string {
+	extension := path.Ext(name)
+	entryName := name
+	for i := 1; usedNames[entryName]; i++ {
+		entryName = fmt.Sprintf(
+			"%s (%d)%s", strings.TrimSuffix(name, extension), i, extension,
+		)
+	}
+	usedNames[entryName] = true
+	return entryName
+}
+
+// writeArchiveEntry streams the file into the archive and returns number
+// of content bytes written.
+func (controller BundlesController) writeArchiveEntry(
+	archive *zip.Writer,
+	fileMetadata *api.FileMetadata,
+	name string,
+) (int64, error) {
+	fileId := fileMetadata.Identifier
+	stream, err := controller.Files.FilesService.OpenFile(&api.FileData{
+		Identifier: fileId,
+		Encryption: fileMetadata.Encryption,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer services.CloseFileStream(stream, fileId)
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: time.Unix(fileMetadata.Creation, 0),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(entry, stream)
+}
+
+// writeArchive streams files into ZIP archive. Content is stored without
+// compression, so the archive is built on the fly at streaming speed.
+// Content bytes written of every file are set in sent.
+func (controller BundlesController) writeArchive(
+	writer io.Writer,
+	files []api.FileMetadata,
+	sent map[string]int64,
+) error {
+	archive := zip.NewWriter(writer)
+	usedNames := map[string]bool{}
+	for i := range files {
+		name := archiveEntryName(usedNames, files[i].Name)
+		written, err := controller.writeArchiveEntry(archive, &files[i], name)
+		sent[files[i].Identifier] = written
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// recordArchiveAccesses logs download attempts of bundle files once the
+// archive request is handled. Files left out of the archive are recorded
+// only if the request failed as a whole.
+func (controller BundlesController) recordArchiveAccesses(
+	c *gin.Context,
+	files []api.FileMetadata,
+	sent map[string]int64,
+) {
+	failed := len(c.Errors) > 0
+	for i := range files {
+		bytesSent, archived := sent[files[i].Identifier]
+		if !archived && !failed {
+			continue
+		}
+		access := newFileAccess(c, files[i].Identifier, files[i].Username)
+		access.BytesSent = bytesSent
+		controller.Files.saveFileAccess(access)
+	}
+}
+
+// DownloadBundleArchive Download bundle archive
+// @Summary      Download bundle archive
+// @Description  This method downloads files of a bundle in ZIP archive
+// @Description  built while it is sent. Password of protected files is
+// @Description  sent in header or with POST form. Download of every file
+// @Description  is counted and recorded in access log of the file. Files
+// @Description  which can not be downloaded are left out.
+// @Description  Anonymous requests are refused if only presigned URLs are
+// @Description  allowed
+// @Tags         Bundles
+// @Produce      application/zip
+// @Param 		 identifier path string true "Bundle ID" example(NWJlODYxZjctZDNkYi00ZTJiLWI0ZGYtMzIyNDhkNDQ0ZjA4)
+// @Param 		 X-File-Password header string false "Password of protected files"
+// @Success      200
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      401  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      429  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/bundles/{identifier}/archive [get]
+// @Router       /v1/bundles/{identifier}/archive [post]
+func (controller BundlesController) DownloadBundleArchive(c *gin.Context) {
+	base.Logger.Info("Requested bundle archive")
+
+	if controller.Files.Presign.OwnerOnly && getOptionalUser(c) == nil {
+		c.Error(base.NewPresignedUrlRequiredError())
+		return
+	}
+	bundle, files, err := controller.getBundleFiles(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	sent := map[string]int64{}
+	defer controller.recordArchiveAccesses(c, files, sent)
+	if files, err = controller.selectArchiveFiles(c, files); err != nil {
+		c.Error(err)
+		return
+	}
+	if files, err = controller.registerDownloads(files); err != nil {
+		c.Error(err)
+		return
+	}
+	if len(files) == 0 {
+		c.Error(base.NewBundleExpiredError(bundle.Identifier))
+		return
+	}
+
+	c.Header("Content-Type", base.ZipMimetype)
+	c.Header(
+		"Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"%s.zip\"", bundle.Identifier),
+	)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	if err = controller.writeArchive(c.Writer, files, sent); err != nil {
+		// Response is already started, the client gets broken archive.
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": bundle.Identifier,
+			"error":      err.Error(),
+		}).Error("Write bundle archive error")
+	}
+
+	for i := range files {
+		if services.IsDownloadLimitReached(&files[i]) {
+			controller.Files.purgeFile(&files[i])
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stealthy-backend/api"
+	"stealthy-backend/api/services"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"testing"
+	"time"
+)
+
+func setupBundlesRouter(
+	config *base.BackendConfig,
+	filesController FilesController,
+) *gin.Engine {
+	bundlesController := BundlesController{Files: filesController}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.NoRoute(api.NoRouteHandler)
+	router.NoMethod(api.NoMethodHandler)
+	router.Use(api.LogsHandler)
+	router.Use(api.ErrorHandler)
+	router.Use(api.CORSHandler)
+
+	applicationGroup := router.Group(config.Server.BasePath)
+	v1 := applicationGroup.Group("/v1")
+
+	bundlesGroup := v1.Group("/bundles")
+	bundlesGroup.GET(
+		fmt.Sprintf("/:%s", base.BundleIdPathParam),
+		bundlesController.GetBundle,
+	)
+	bundlesGroup.GET(
+		fmt.Sprintf("/:%s/archive", base.BundleIdPathParam),
+		bundlesController.DownloadBundleArchive,
+	)
+
+	return router
+}
+
+type BundlesApiTestSuite struct {
+	suite.Suite
+	Config              *base.BackendConfig
+	BundleFixture       *api.Bundle
+	FilesFixture        []api.FileMetadata
+	StoredContent       map[string][]byte
+	FilesServiceMock    *tests.BaseFilesService
+	MetadataServiceMock *tests.BaseFilesMetadataService
+	BundlesServiceMock  *tests.BaseBundlesService
+	UserServiceMock     *tests.BaseUserService
+	AccessLogMock       *tests.BaseFileAccessLogService
+	Router              *gin.Engine
+}
+
+func (s *BundlesApiTestSuite) bundleFile(
+	fileId string,
+	name string,
+	content string,
+) api.FileMetadata {
+	s.StoredContent[fileId] = []byte(content)
+	return api.FileMetadata{
+		Identifier: fileId,
+		Name:       name,
+		Username:   "valid_username",
+		Size:       int64(len(content)),
+		Mimetype:   "text/plain",
+		Creation:   time.Now().Add(-time.Hour).Unix(),
+		Expiration: time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func (s *BundlesApiTestSuite) SetupTest() {
+	s.Config = &base.BackendConfig{}
+	s.Config.SetDefaults()
+	s.Config.Logs.AppName = "sharing-backend-test"
+
+	s.StoredContent = map[string][]byte{}
+	s.FilesFixture = []api.FileMetadata{
+		s.bundleFile("first", "photo.jpg", "first content"),
+		s.bundleFile("second", "photo.jpg", "second content"),
+		s.bundleFile("third", "notes.txt", "third content"),
+	}
+	s.BundleFixture = &api.Bundle{
+		Identifier: "bundle",
+		Username:   "valid_username",
+		Files:      []string{"first", "second", "third"},
+		Creation:   time.Now().Add(-time.Hour).Unix(),
+		Expiration: time.Now().Add(time.Hour).Unix(),
+	}
+
+	s.FilesServiceMock = tests.NewBaseFilesService(s.T())
+	s.MetadataServiceMock = tests.NewBaseFilesMetadataService(s.T())
+	s.BundlesServiceMock = tests.NewBaseBundlesService(s.T())
+	s.UserServiceMock = tests.NewBaseUserService(s.T())
+	shareLinksServiceMock := tests.NewBaseShareLinksService(s.T())
+	mockUserStorage(s.UserServiceMock, "valid_username", &api.UserStorage{})
+	mockShareLinks(shareLinksServiceMock)
+	s.AccessLogMock = tests.NewBaseFileAccessLogService(s.T())
+	mockFileAccessLog(s.AccessLogMock, s.MetadataServiceMock)
+	filesController := FilesController{
+		FilesService:         s.FilesServiceMock,
+		FilesMetadataService: s.MetadataServiceMock,
+		BundlesService:       s.BundlesServiceMock,
+		ShareLinksService:    shareLinksServiceMock,
+		FileAccessLogService: s.AccessLogMock,
+		UserService:          s.UserServiceMock,
+		Scanning:             &s.Config.Scanning,
+		Presign:              &s.Config.Presign,
+		PasswordLimiter:      services.NewAttemptsLimiter(&s.Config.FilesPassword),
+		SchemaValidator:      base.CreateValidator(),
+	}
+	s.Router = setupBundlesRouter(s.Config, filesController)
+}
+
+func (s *BundlesApiTestSuite) serve(req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.Router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (s *BundlesApiTestSuite) newRequest(url string) *http.Request {
+	req, err := http.NewRequest("GET", getRequestUrl(s.Config, url), nil)
+	assert.NoError(s.T(), err)
+	return req
+}
+
+func (s *BundlesApiTestSuite) mockBundle() {
+	s.BundlesServiceMock.On("GetBundle", s.BundleFixture.Identifier).Return(
+		s.BundleFixture, nil,
+	)
+	s.MetadataServiceMock.On("GetFilesMetadata", s.BundleFixture.Files).Return(
+		func([]string) ([]api.FileMetadata, error) { return s.FilesFixture, nil },
+	)
+}
+
+// mockDownloads counts downloads and serves stored content of the files.
+func (s *BundlesApiTestSuite) mockDownloads() {
+	s.MetadataServiceMock.On("RegisterFileDownload", mock.Anything).Return(
+		func(fileId string) (*api.FileMetadata, error) {
+			for _, fileMetadata := range s.FilesFixture {
+				if fileMetadata.Identifier == fileId {
+					fileMetadata.DownloadCount++
+					return &fileMetadata, nil
+				}
+			}
+			return nil, base.NewFileNotFoundError(fileId)
+		},
+	).Maybe()
+	s.FilesServiceMock.On("OpenFile", mock.Anything).Return(
+		func(file *api.FileData) (io.ReadSeekCloser, error) {
+			content := s.StoredContent[file.Identifier]
+			return services.NopSeekCloser(bytes.NewReader(content)), nil
+		},
+	).Maybe()
+}
+
+func (s *BundlesApiTestSuite) readArchive(body []byte) map[string]string {
+	reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	assert.NoError(s.T(), err)
+	entries := map[string]string{}
+	for _, entry := range reader.File {
+		stream, err := entry.Open()
+		assert.NoError(s.T(), err)
+		content, err := io.ReadAll(stream)
+		assert.NoError(s.T(), err)
+		entries[entry.Name] = string(content)
+	}
+	return entries
+}
+
+func (s *BundlesApiTestSuite) TestApiGetBundle() {
+	s.mockBundle()
+
+	recorder := s.serve(s.newRequest("/bundles/bundle"))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	var response api.BundleResponse
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(s.T(), "bundle", response.Identifier)
+	assert.Equal(s.T(), s.BundleFixture.Expiration, response.Expiration)
+	assert.Len(s.T(), response.Files, 3)
+	assert.Equal(s.T(), &api.BundleFile{
+		Identifier: "third",
+		Name:       "notes.txt",
+		Size:       13,
+		Mimetype:   "text/plain",
+		Expiration: s.FilesFixture[2].Expiration,
+	}, response.Files[2])
+	assert.NotContains(s.T(), recorder.Body.String(), "valid_username")
+}
+
+func (s *BundlesApiTestSuite) TestApiGetBundleNotFound() {
+	s.BundlesServiceMock.On("GetBundle", "missing").Return(
+		nil, base.NewBundleNotFoundError("missing"),
+	)
+
+	recorder := s.serve(s.newRequest("/bundles/missing"))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+}
+
+func (s *BundlesApiTestSuite) TestApiGetBundleWithoutFiles() {
+	s.FilesFixture = []api.FileMetadata{}
+	s.mockBundle()
+
+	recorder := s.serve(s.newRequest("/bundles/bundle"))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+}
+
+func (s *BundlesApiTestSuite) TestApiGetBundleHidesFilesNotPublic() {
+	s.FilesFixture[0].Visibility = base.VisibilityPrivate
+	s.FilesFixture[1].Visibility = base.VisibilityAuthenticated
+	s.FilesFixture[2].Visibility = base.VisibilityPublic
+	s.mockBundle()
+
+	recorder := s.serve(s.newRequest("/bundles/bundle"))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	var response api.BundleResponse
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Len(s.T(), response.Files, 1)
+	assert.Equal(s.T(), "third", response.Files[0].Identifier)
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadBundleArchive() {
+	s.mockBundle()
+	s.mockDownloads()
+
+	recorder := s.serve(s.newRequest("/bundles/bundle/archive"))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), base.ZipMimetype, recorder.Header().Get("Content-Type"))
+	assert.Equal(
+		s.T(),
+		"attachment; filename=\"bundle.zip\"",
+		recorder.Header().Get("Content-Disposition"),
+	)
+	assert.Equal(s.T(), map[string]string{
+		"photo.jpg":     "first content",
+		"photo (1).jpg": "second content",
+		"notes.txt":     "third content",
+	}, s.readArchive(recorder.Body.Bytes()))
+	s.MetadataServiceMock.AssertNumberOfCalls(s.T(), "RegisterFileDownload", 3)
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadBundleArchiveOwnerOnly() {
+	s.Config.Presign.OwnerOnly = true
+
+	recorder := s.serve(s.newRequest("/bundles/bundle/archive"))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.BundlesServiceMock.AssertNotCalled(s.T(), "GetBundle", mock.Anything)
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadBundleArchiveSkipsUnavailableFiles() {
+	s.Config.Scanning.Required = true
+	for i := range s.FilesFixture {
+		s.FilesFixture[i].ScanStatus = base.ScanStatusClean
+	}
+	s.FilesFixture[0].ScanStatus = base.ScanStatusPending
+	s.mockBundle()
+	s.MetadataServiceMock.On("RegisterFileDownload", "second").Return(
+		nil, base.NewFileDownloadLimitError("second"),
+	)
+	s.mockDownloads()
+
+	recorder := s.serve(s.newRequest("/bundles/bundle/archive"))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), map[string]string{
+		"notes.txt": "third content",
+	}, s.readArchive(recorder.Body.Bytes()))
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", "first")
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadBundleArchivePurgesFiles() {
+	s.FilesFixture[2].MaxDownloads = 1
+	s.mockBundle()
+	s.mockDownloads()
+	s.FilesServiceMock.On("DeleteFile", "third").Return(nil)
+	s.MetadataServiceMock.On("DeleteFileMetadata", "third").Return(nil)
+
+	recorder := s.serve(s.newRequest("/bundles/bundle/archive"))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Len(s.T(), s.readArchive(recorder.Body.Bytes()), 3)
+	s.UserServiceMock.AssertCalled(
+		s.T(), "ReleaseStorage", "valid_username", &api.UserUsage{Files: 1, Bytes: 13},
+	)
+}
+
+func (s *BundlesApiTestSuite) protectWithPassword(password string) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	assert.NoError(s.T(), err)
+	for i := range s.FilesFixture {
+		s.FilesFixture[i].PasswordProtected = true
+		s.FilesFixture[i].PasswordHash = string(hash)
+	}
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadProtectedBundleArchive() {
+	s.protectWithPassword("p@ssw0rd")
+	s.mockBundle()
+	s.mockDownloads()
+	req := s.newRequest("/bundles/bundle/archive")
+	req.Header.Set(base.FilePasswordHeader, "p@ssw0rd")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Len(s.T(), s.readArchive(recorder.Body.Bytes()), 3)
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadProtectedBundleArchiveWithoutPassword() {
+	s.protectWithPassword("p@ssw0rd")
+	s.mockBundle()
+
+	recorder := s.serve(s.newRequest("/bundles/bundle/archive"))
+
+	assert.Equal(s.T(), http.StatusUnauthorized, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", mock.Anything)
+}
+
+func (s *BundlesApiTestSuite) TestApiDownloadBundleArchiveNothingLeft() {
+	s.mockBundle()
+	s.MetadataServiceMock.On("RegisterFileDownload", mock.Anything).Return(
+		nil, base.NewFileExpiredError("file"),
+	)
+
+	recorder := s.serve(s.newRequest("/bundles/bundle/archive"))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+}
+
+func TestBundlesApiTestSuite(t *testing.T) {
+	suite.Run(t, new(BundlesApiTestSuite))
+}
+
+func TestArchiveEntryName(t *testing.T) {
+	usedNames := map[string]bool{}
+
+	assert.Equal(t, "a.txt", archiveEntryName(usedNames, "a.txt"))
+	assert.Equal(t, "a (1).txt", archiveEntryName(usedNames, "a.txt"))
+	assert.Equal(t, "a (1) (1).txt", archiveEntryName(usedNames, "a (1).txt"))
+	assert.Equal(t, "a (2).txt", archiveEntryName(usedNames, "a.txt"))
+	assert.Equal(t, "README", archiveEntryName(usedNames, "README"))
+	assert.Equal(t, "README (1)", archiveEntryName(usedNames, "README"))
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"strings"
+)
+
+// sniffBytes is the amount of content used to detect its type.
+const sniffBytes int = 512
+
+// dangerousContentTypes can run scripts if a browser renders them.
+var dangerousContentTypes = []string{
+	"text/html",
+	"application/xhtml+xml",
+	"image/svg+xml",
+	"text/javascript",
+	"application/javascript",
+	"application/x-javascript",
+	"application/ecmascript",
+	"text/xml",
+	"application/xml",
+}
+
+// contentSniffer keeps the beginning of written content to detect its
+// type from magic bytes.
+type contentSniffer struct {
+	head []byte
+}
+
+func (sniffer *contentSniffer) Write(p []byte) (int, error) {
+	if left := sniffBytes - len(sniffer.head); left > 0 {
+		sniffer.head = append(sniffer.head, p[:min(left, len(p))]...)
+	}
+	return len(p), nil
+}
+
+func (sniffer *contentSniffer) ContentType() string {
+	if len(sniffer.head) == 0 {
+		return base.EmptyContentMimetype
+	}
+	return http.DetectContentType(sniffer.head)
+}
+
+// mediaType returns mimetype without parameters.
+func mediaType(mimetype string) string {
+	value, _, _ := strings.Cut(mimetype, ";")
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+func matchesContentType(patterns []string, mimetype string) bool {
+	mimetype = mediaType(mimetype)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == mimetype ||
+			strings.HasSuffix(pattern, "/*") &&
+				strings.HasPrefix(mimetype, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDangerousContentType(mimetype string) bool {
+	return slices.Contains(dangerousContentTypes, mediaType(mimetype))
+}
+
+// checkContentType enforces configured types and extensions of files.
+// Detected type is checked once the file content is read.
+func (controller FilesController) checkContentType(fileMetadata *api.FileMetadata) error {
+	config := controller.ContentTypes
+	extension := strings.ToLower(filepath.Ext(fileMetadata.Name))
+	extensionAllowed := len(config.AllowedExtensions) == 0 ||
+		slices.ContainsFunc(config.AllowedExtensions, func(allowed string) bool {
+			return strings.ToLower(allowed) == extension
+		})
+	extensionDenied := slices.ContainsFunc(config.DeniedExtensions, func(denied string) bool {
+		return strings.ToLower(denied) == extension
+	})
+	if !extensionAllowed || extensionDenied {
+		return base.NewUnsupportedFileTypeError(
+			fmt.Sprintf("Files with extension '%s' are not allowed", extension),
+		)
+	}
+
+	for _, mimetype := range []string{
+		fileMetadata.DeclaredMimetype, fileMetadata.DetectedMimetype,
+	} {
+		if mimetype == "" {
+			continue
+		}
+		typeAllowed := len(config.AllowedTypes) == 0 ||
+			matchesContentType(config.AllowedTypes, mimetype)
+		if !typeAllowed || matchesContentType(config.DeniedTypes, mimetype) {
+			return base.NewUnsupportedFileTypeError(
+				fmt.Sprintf("Files of type '%s' are not allowed", mediaType(mimetype)),
+			)
+		}
+	}
+	return nil
+}
+
+// setContentHeaders sets type of the downloaded file. Files are always
+// sent as attachment and browsers are not allowed to guess their type.
+// Content which could run scripts in origin of the service, e.g. HTML or
+// SVG, is sandboxed even if the browser renders it. Returns the sent type.
+func setContentHeaders(c *gin.Context, fileMetadata *api.FileMetadata) string {
+	mimetype := fileMetadata.Mimetype
+	if fileMetadata.EndToEndEncrypted {
+		mimetype = base.OctetStreamMimetype
+		c.Header(base.EncryptionParamsHeader, fileMetadata.EncryptionParams)
+	}
+	c.Header("Content-Type", mimetype)
+	c.Header("Content-Disposition", contentDisposition(fileMetadata.Name))
+	c.Header("X-Content-Type-Options", "nosniff")
+	if isDangerousContentType(mimetype) ||
+		isDangerousContentType(fileMetadata.DetectedMimetype) {
+		c.Header("Content-Security-Policy", "sandbox")
+	}
+	return mimetype
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"hash"
+	"net/http"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"strings"
+)
+
+// contentDigests holds digests of file content, missing digests are nil.
+type contentDigests struct {
+	SHA256 []byte
+	MD5    []byte
+}
+
+// parseRequestDigests reads digests of uploaded file content sent in
+// Digest (RFC 3230) and Content-MD5 headers. Digests of unsupported
+// algorithms are ignored.
+func parseRequestDigests(header http.Header) (*contentDigests, error) {
+	digests := &contentDigests{}
+	for _, value := range header.Values(base.DigestHeader) {
+		for _, item := range strings.Split(value, ",") {
+			algorithm, encoded, found := strings.Cut(strings.TrimSpace(item), "=")
+			if !found {
+				return nil, base.NewHeaderError(
+					base.DigestHeader, fmt.Errorf("invalid digest '%s'", item),
+				)
+			}
+			var target *[]byte
+			switch strings.ToLower(algorithm) {
+			case "sha-256":
+				target = &digests.SHA256
+			case "md5":
+				target = &digests.MD5
+			default:
+				continue
+			}
+			sum, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, base.NewHeaderError(base.DigestHeader, err)
+			}
+			*target = sum
+		}
+	}
+
+	if value := header.Get(base.ContentMD5Header); value != "" {
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, base.NewHeaderError(base.ContentMD5Header, err)
+		}
+		if digests.MD5 != nil && !bytes.Equal(digests.MD5, sum) {
+			return nil, base.NewHeaderError(
+				base.ContentMD5Header, fmt.Errorf("conflicts with MD5 digest"),
+			)
+		}
+		digests.MD5 = sum
+	}
+	return digests, nil
+}
+
+func (expected *contentDigests) empty() bool {
+	return expected.SHA256 == nil && expected.MD5 == nil
+}
+
+// verify compares digests expected by the client with computed ones.
+func (expected *contentDigests) verify(computed *contentDigests) error {
+	if expected.SHA256 != nil && !bytes.Equal(expected.SHA256, computed.SHA256) {
+		return base.NewDigestMismatchError("sha-256")
+	}
+	if expected.MD5 != nil && !bytes.Equal(expected.MD5, computed.MD5) {
+		return base.NewDigestMismatchError("md5")
+	}
+	return nil
+}
+
+// contentHasher computes digests of content written to it.
+type contentHasher struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func newContentHasher(withMD5 bool) *contentHasher {
+	hasher := &contentHasher{sha256: sha256.New()}
+	if withMD5 {
+		hasher.md5 = md5.New()
+	}
+	return hasher
+}
+
+func (hasher *contentHasher) Write(p []byte) (int, error) {
+	hasher.sha256.Write(p)
+	if hasher.md5 != nil {
+		hasher.md5.Write(p)
+	}
+	return len(p), nil
+}
+
+func (hasher *contentHasher) Digests() *contentDigests {
+	digests := &contentDigests{SHA256: hasher.sha256.Sum(nil)}
+	if hasher.md5 != nil {
+		digests.MD5 = hasher.md5.Sum(nil)
+	}
+	return digests
+}
+
+// setDigestHeaders sends digests of the whole file content in Digest
+// (RFC 3230) and Repr-Digest (RFC 9530) headers, so recipients can verify
+// the downloaded file.
+func setDigestHeaders(c *gin.Context, fileMetadata *api.FileMetadata) {
+	algorithms := []struct {
+		Name string
+		Hex  string
+	}{
+		{Name: "sha-256", Hex: fileMetadata.SHA256},
+		{Name: "md5", Hex: fileMetadata.MD5},
+	}
+
+	var digest, reprDigest []string
+	for _, algorithm := range algorithms {
+		sum, err := hex.DecodeString(algorithm.Hex)
+		if err != nil || len(sum) == 0 {
+			continue
+		}
+		encoded := base64.StdEncoding.EncodeToString(sum)
+		digest = append(digest, algorithm.Name+"="+encoded)
+		reprDigest = append(reprDigest, algorithm.Name+"=:"+encoded+":")
+	}
+	if len(digest) > 0 {
+		c.Header(base.DigestHeader, strings.Join(digest, ", "))
+		c.Header(base.ReprDigestHeader, strings.Join(reprDigest, ", "))
+	}
+}
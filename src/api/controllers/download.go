@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"stealthy-backend/api"
+	"strings"
+	"time"
+)
+
+// fileETag returns strong entity tag built from content hash. Files
+// uploaded before content hashes were stored have no entity tag.
+func fileETag(fileMetadata *api.FileMetadata) string {
+	if fileMetadata.SHA256 == "" {
+		return ""
+	}
+	return "\"" + fileMetadata.SHA256 + "\""
+}
+
+func fileLastModified(fileMetadata *api.FileMetadata) time.Time {
+	return time.Unix(fileMetadata.Creation, 0).UTC()
+}
+
+func contentDisposition(filename string) string {
+	filename = url.QueryEscape(filename)
+	filename = strings.ReplaceAll(filename, "+", "%20")
+	return "attachment; filename=\"" + filename + "\""
+}
+
+// etagMatches compares entity tags of If-None-Match header with weak
+// comparison.
+func etagMatches(header string, etag string) bool {
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		if value == "*" || (etag != "" && strings.TrimPrefix(value, "W/") == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotModified evaluates conditional headers of a download request.
+// If-None-Match takes precedence over If-Modified-Since.
+func isNotModified(request *http.Request, fileMetadata *api.FileMetadata) bool {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return false
+	}
+	if header := request.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, fileETag(fileMetadata))
+	}
+	since, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !fileLastModified(fileMetadata).After(since)
+}
+
+func setCacheValidators(c *gin.Context, fileMetadata *api.FileMetadata) {
+	c.Header("Last-Modified", fileLastModified(fileMetadata).Format(http.TimeFormat))
+	if etag := fileETag(fileMetadata); etag != "" {
+		c.Header("ETag", etag)
+	}
+}
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"encoding/hex"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/sirupsen/logrus"
-	"math"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -12,121 +14,685 @@ import (
 	"stealthy-backend/api/services"
 	"stealthy-backend/base"
 	"strconv"
-	"strings"
 	"time"
 )
 
 type FilesController struct {
 	FilesService         services.BaseFilesService
 	FilesMetadataService services.BaseFilesMetadataService
+	BundlesService       services.BaseBundlesService
+	ShareLinksService    services.BaseShareLinksService
+	FileAccessLogService services.BaseFileAccessLogService
+	UserService          services.BaseUserService
 	FilesExpConfig       *base.FilesExpirationConfig
+	UploadConfig         *base.UploadConfig
+	ContentTypes         *base.ContentTypesConfig
+	Scanning             *base.ScanningConfig
+	Scanner              services.BaseScanner
+	Presign              *base.PresignConfig
+	Signer               services.URLSigner
+	PasswordLimiter      *services.AttemptsLimiter
 	SchemaValidator      *validator.Validate
 }
 
+// getFileLifetime returns file lifetime requested with upload form
+// fields clamped to configured bounds or default lifetime if none set.
+func (controller FilesController) getFileLifetime(
+	form url.Values,
+	creation time.Time,
+) (time.Duration, error) {
+	lifetimeMinutes := form.Get(base.LifetimeMinutesFormField)
+	expiresAt := form.Get(base.ExpiresAtFormField)
+
+	var lifetime time.Duration
+	if lifetimeMinutes != "" && expiresAt != "" {
+		return 0, base.ServiceError{
+			Summary: fmt.Sprintf(
+				"Only one of form fields '%s', '%s' allowed",
+				base.LifetimeMinutesFormField,
+				base.ExpiresAtFormField,
+			),
+			Status: http.StatusBadRequest,
+		}
+	} else if lifetimeMinutes != "" {
+		minutes, err := strconv.ParseUint(lifetimeMinutes, 10, 32)
+		if err != nil {
+			return 0, base.NewFormFieldError(base.LifetimeMinutesFormField, err)
+		}
+		lifetime = time.Minute * time.Duration(minutes)
+	} else if expiresAt != "" {
+		timestamp, err := strconv.ParseInt(expiresAt, 10, 64)
+		if err != nil {
+			return 0, base.NewFormFieldError(base.ExpiresAtFormField, err)
+		}
+		lifetime = time.Unix(timestamp, 0).Sub(creation)
+	} else {
+		return controller.FilesExpConfig.DefaultLifetime(), nil
+	}
+
+	return controller.FilesExpConfig.ClampLifetime(lifetime), nil
+}
+
+func getMaxDownloads(form url.Values) (int64, error) {
+	maxDownloads := form.Get(base.MaxDownloadsFormField)
+	if maxDownloads == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseUint(maxDownloads, 10, 32)
+	if err != nil {
+		return 0, base.NewFormFieldError(base.MaxDownloadsFormField, err)
+	}
+	return int64(value), nil
+}
+
+// setVisibility stores who may download the file if it is not public.
+func (controller FilesController) setVisibility(
+	form url.Values,
+	fileMetadata *api.FileMetadata,
+) error {
+	visibilityForm := api.FileVisibilityForm{
+		Visibility: form.Get(base.VisibilityFormField),
+	}
+	if visibilityForm.Visibility == "" || visibilityForm.Visibility == base.VisibilityPublic {
+		return nil
+	}
+	if err := controller.SchemaValidator.Struct(visibilityForm); err != nil {
+		return base.WrapValidationErrors(err)
+	}
+	fileMetadata.Visibility = visibilityForm.Visibility
+	return nil
+}
+
+// setFilePassword stores hash of the download password if it was set
+// in upload form.
+func (controller FilesController) setFilePassword(
+	form url.Values,
+	fileMetadata *api.FileMetadata,
+) error {
+	passwordForm := api.FilePasswordForm{
+		Password: form.Get(base.PasswordFormField),
+	}
+	if passwordForm.Password == "" {
+		return nil
+	}
+	if err := controller.SchemaValidator.Struct(passwordForm); err != nil {
+		return base.WrapValidationErrors(err)
+	}
+
+	hash, err := services.GeneratePasswordHash(passwordForm.Password)
+	if err != nil {
+		return base.ServiceError{
+			Summary: "Password processing error",
+			Detail:  err.Error(),
+		}
+	}
+	fileMetadata.PasswordProtected = true
+	fileMetadata.PasswordHash = string(hash)
+	return nil
+}
+
+// setEncryptionParams marks a file encrypted by the client if encryption
+// parameters were sent in upload form. Parameters are opaque for the
+// server, they are returned to clients downloading the file. Declared
+// mimetype of such file is not kept, since it could tell about the
+// encrypted content.
+func (controller FilesController) setEncryptionParams(
+	form url.Values,
+	fileMetadata *api.FileMetadata,
+) error {
+	paramsForm := api.FileEncryptionParamsForm{
+		Params: form.Get(base.EncryptionParamsFormField),
+	}
+	if paramsForm.Params == "" {
+		return nil
+	}
+	if err := controller.SchemaValidator.Struct(paramsForm); err != nil {
+		return base.WrapValidationErrors(err)
+	}
+	fileMetadata.EndToEndEncrypted = true
+	fileMetadata.EncryptionParams = paramsForm.Params
+	fileMetadata.Mimetype = base.OctetStreamMimetype
+	fileMetadata.DeclaredMimetype = ""
+	return nil
+}
+
+// checkFilePassword verifies download password sent in header or form
+// field. Failed attempts are limited per file.
+func (controller FilesController) checkFilePassword(
+	c *gin.Context,
+	fileMetadata *api.FileMetadata,
+) error {
+	return controller.checkPassword(
+		c, fileMetadata.Identifier, fileMetadata.PasswordHash,
+	)
+}
+
+// checkPassword verifies download password of a file or a share link
+// identified by the resource ID, failed attempts are limited per resource.
+func (controller FilesController) checkPassword(
+	c *gin.Context,
+	resourceId string,
+	passwordHash string,
+) error {
+	if !controller.PasswordLimiter.Allow(resourceId) {
+		return base.NewFilePasswordAttemptsError(resourceId)
+	}
+
+	password := c.GetHeader(base.FilePasswordHeader)
+	if password == "" {
+		password = c.PostForm(base.PasswordFormField)
+	}
+	if password == "" {
+		controller.PasswordLimiter.Release(resourceId)
+		return base.NewFilePasswordRequiredError(resourceId)
+	}
+
+	if !services.CheckPasswordEquals(password, passwordHash) {
+		return base.NewFilePasswordInvalidError(resourceId)
+	}
+	controller.PasswordLimiter.Release(resourceId)
+	return nil
+}
+
+// checkStorageQuota rejects a file of the specified size if the user has
+// no storage left for it. Returns the maximum size of the file, so the
+// quota is not exceeded while the file content is read.
+func (controller FilesController) checkStorageQuota(
+	username string,
+	size int64,
+) (int64, error) {
+	storage, err := controller.UserService.GetUserStorage(username)
+	if err != nil {
+		return 0, err
+	}
+	quota, usage := storage.Quota, storage.Usage
+	if quota.MaxFiles > 0 && usage.Files >= quota.MaxFiles {
+		return 0, base.NewStorageQuotaError(
+			fmt.Sprintf("Quota allows %d files", quota.MaxFiles),
+		)
+	}
+
+	maxFileBytes := controller.UploadConfig.MaxFileBytes
+	if quota.MaxFileBytes > 0 {
+		maxFileBytes = min(maxFileBytes, quota.MaxFileBytes)
+	}
+	if quota.MaxTotalBytes > 0 {
+		available := max(quota.MaxTotalBytes-usage.Bytes, 0)
+		if size > available {
+			return 0, base.NewStorageQuotaError(
+				fmt.Sprintf("%d bytes of storage quota left", available),
+			)
+		}
+		maxFileBytes = min(maxFileBytes, available)
+	}
+	return maxFileBytes, nil
+}
+
+// releaseStorage uncounts a deleted file of its owner. Errors are only
+// logged since the file is already deleted.
+func (controller FilesController) releaseStorage(fileMetadata *api.FileMetadata) {
+	err := controller.UserService.ReleaseStorage(
+		fileMetadata.Username,
+		&api.UserUsage{Files: 1, Bytes: fileMetadata.Size},
+	)
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileMetadata.Identifier,
+			"username":   fileMetadata.Username,
+			"error":      err.Error(),
+		}).Error("Release storage usage error")
+	}
+}
+
+// scanFile checks stored content of a new file for malware and saves the
+// scan status. Infected file is removed. Scan errors are only logged, so
+// the file is kept but not served if scanning is required.
+func (controller FilesController) scanFile(fileMetadata *api.FileMetadata) error {
+	fileId := fileMetadata.Identifier
+	result, err := controller.scanFileContent(fileMetadata)
+	status := base.ScanStatusClean
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"error":      err.Error(),
+		}).Error("Scan file error")
+		status = base.ScanStatusError
+	} else if result.Infected {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"username":   fileMetadata.Username,
+			"signature":  result.Signature,
+		}).Warn("Infected file uploaded")
+		fileMetadata.ScanStatus = base.ScanStatusInfected
+		controller.purgeFile(fileMetadata)
+		return base.NewFileInfectedError(result.Signature)
+	}
+
+	fileMetadata.ScanStatus = status
+	if err = controller.FilesMetadataService.SetScanStatus(fileId, status); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"error":      err.Error(),
+		}).Error("Save scan status error")
+	}
+	return nil
+}
+
+func (controller FilesController) scanFileContent(
+	fileMetadata *api.FileMetadata,
+) (*api.ScanResult, error) {
+	fileId := fileMetadata.Identifier
+	stream, err := controller.FilesService.OpenFile(&api.FileData{
+		Identifier: fileId,
+		Encryption: fileMetadata.Encryption,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer services.CloseFileStream(stream, fileId)
+	return controller.Scanner.Scan(stream)
+}
+
+// checkScanStatus refuses downloads of infected files and, if scanning is
+// required, of files not found clean.
+func (controller FilesController) checkScanStatus(fileMetadata *api.FileMetadata) error {
+	status := fileMetadata.ScanStatus
+	if status == base.ScanStatusInfected ||
+		(controller.Scanning.Required && status != base.ScanStatusClean) {
+		return base.NewFileScanStatusError(fileMetadata.Identifier, status)
+	}
+	return nil
+}
+
+// filesUpload keeps state of files uploaded in one request.
+type filesUpload struct {
+	Username     string
+	Values       url.Values
+	Digests      *contentDigests
+	MaxFileBytes int64
+	Files        []*api.FileMetadata
+	Responses    []*api.AddFileResponse
+}
+
+func closeFilePart(part *multipart.Part) {
+	if err := part.Close(); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Warn("Close file error")
+	}
+}
+
+// storeFileParts stores the file part and the rest of files sent after it.
+// Form fields are shared by all files, content digests can be sent for a
+// single file only.
+func (controller FilesController) storeFileParts(
+	upload *filesUpload,
+	part *multipart.Part,
+	reader *multipart.Reader,
+) error {
+	for part != nil {
+		if err := controller.storeFilePart(upload, part); err != nil {
+			return err
+		}
+		var err error
+		if part, err = nextFilePart(reader); err != nil {
+			return base.NewFilesRequestError(err)
+		}
+	}
+	return nil
+}
+
+func (controller FilesController) storeFilePart(
+	upload *filesUpload,
+	part *multipart.Part,
+) error {
+	defer closeFilePart(part)
+	maxFiles := controller.UploadConfig.MaxFilesPerRequest
+	if int64(len(upload.Files)) >= maxFiles {
+		return base.NewTooManyFilesError(maxFiles)
+	}
+	if len(upload.Files) > 0 && !upload.Digests.empty() {
+		return base.NewFilesRequestError(
+			fmt.Errorf("content digests allowed for single file only"),
+		)
+	}
+
+	fileMetadata, err := controller.buildFileMetadata(
+		part.FileName(), part.Header.Get("Content-Type"), upload.Values,
+	)
+	if err != nil {
+		return err
+	}
+	fileMetadata.Username = upload.Username
+	if len(upload.Files) > 0 {
+		fileMetadata.PasswordProtected = upload.Files[0].PasswordProtected
+		fileMetadata.PasswordHash = upload.Files[0].PasswordHash
+	}
+
+	response, err := controller.storeFile(
+		fileMetadata, part, upload.Digests, upload.MaxFileBytes, false,
+	)
+	if err != nil {
+		return err
+	}
+	if len(upload.Files) == 0 {
+		// Password is hashed once, the rest of files share its hash.
+		upload.Values.Del(base.PasswordFormField)
+	}
+	upload.Files = append(upload.Files, fileMetadata)
+	upload.Responses = append(upload.Responses, response)
+	return nil
+}
+
+// addBundle groups files uploaded in one request, the bundle expires with
+// the last of them.
+func (controller FilesController) addBundle(
+	upload *filesUpload,
+) (*api.AddBundleResponse, error) {
+	bundle := &api.Bundle{
+		Identifier: generateShortUUID(),
+		Username:   upload.Username,
+		Files:      make([]string, len(upload.Files)),
+		Creation:   time.Now().Unix(),
+	}
+	for i, fileMetadata := range upload.Files {
+		bundle.Files[i] = fileMetadata.Identifier
+		if fileMetadata.Expiration > bundle.Expiration {
+			bundle.Expiration = fileMetadata.Expiration
+			bundle.ExpirationDate = fileMetadata.ExpirationDate
+		}
+	}
+	if err := controller.BundlesService.AddBundle(bundle); err != nil {
+		return nil, err
+	}
+	return &api.AddBundleResponse{
+		Identifier: bundle.Identifier,
+		Files:      upload.Responses,
+	}, nil
+}
+
 // UploadFile Upload file
 // @Summary      Upload file for user
-// @Description  This method uploads a new file to user's space
+// @Description  This method uploads a new file to user's space. File
+// @Description  content is streamed, so form fields have to be sent
+// @Description  before the file part. Content not matching digests
+// @Description  sent in Digest or Content-MD5 header is rejected. Files
+// @Description  exceeding storage quota of the user or of not allowed
+// @Description  type are rejected as well. File type is detected from
+// @Description  its content. Content is scanned for malware before the
+// @Description  file can be downloaded, infected files are rejected.
+// @Description  Several files can be sent in one request, they share form
+// @Description  fields and are grouped into a bundle. Bundle identifier and
+// @Description  identifiers of the files are returned then
+// @Description  (AddBundleResponse). Either all files are stored or none
 // @Tags         Files
 // @Security     User
 // @Accept       multipart/form-data
 // @Produce      json
-// @Success      200  {object}  api.AddFileResponse
+// @Param 		 file formData file true "File to upload"
+// @Param 		 lifetime_minutes formData int false "File lifetime in minutes, clamped to allowed bounds"
+// @Param 		 expires_at formData int false "File expiration unix timestamp, clamped to allowed bounds"
+// @Param 		 max_downloads formData int false "Number of allowed downloads, file is deleted after the last one"
+// @Param 		 password formData string false "Password required to download file"
+// @Param 		 visibility formData string false "Who can download the file" Enums(public, authenticated, private) default(public)
+// @Param 		 encryption_params formData string false "Parameters of content encrypted by client, returned with downloads"
+// @Param 		 Digest header string false "Digests of file content" example(sha-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=)
+// @Param 		 Content-MD5 header string false "MD5 digest of file content"
+// @Success      201  {object}  api.AddFileResponse
 // @Failure      400  {object}  api.ErrorResponse
+// @Failure      413  {object}  api.ErrorResponse
+// @Failure      415  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
 // @Failure      500  {object}  api.ErrorResponse
+// @Failure      507  {object}  api.ErrorResponse
 // @Router       /v1/files [post]
 func (controller FilesController) UploadFile(c *gin.Context) {
 	base.Logger.Info("Requested file upload")
 
-	fileMetadata := api.FileMetadata{}
-	fileData := api.FileData{}
 	auth, err := GetAuthenticatedUser(c)
 	if err != nil {
 		return
 	}
-	fileMetadata.Username = auth.Username
 
-	fileMetadata.Identifier = generateShortUUID()
+	expectedDigests, err := parseRequestDigests(c.Request.Header)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Request length includes form fields, so it only bounds file size.
+	maxFileBytes, err := controller.checkStorageQuota(
+		auth.Username, c.Request.ContentLength-base.MaxFormFieldsBytes,
+	)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	maxRequestBytes := maxFileBytes*controller.UploadConfig.MaxFilesPerRequest +
+		base.MaxFormFieldsBytes
+	if c.Request.ContentLength > maxRequestBytes {
+		c.Error(base.NewFileTooLargeError(maxFileBytes))
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRequestBytes)
 
-	fileSize, err := strconv.ParseInt(c.GetHeader("Content-Length"), 10, 64)
+	multipartReader, err := c.Request.MultipartReader()
 	if err != nil {
 		c.Error(base.NewFilesRequestError(err))
 		return
 	}
-	err = c.Request.ParseMultipartForm(math.MaxInt64)
+	form, err := readUploadForm(multipartReader)
 	if err != nil {
 		c.Error(base.NewFilesRequestError(err))
 		return
 	}
 
-	fileMetadata.Size = fileSize
-	fileBytes := make([]byte, fileSize)
+	upload := &filesUpload{
+		Username:     auth.Username,
+		Values:       form.Values,
+		Digests:      expectedDigests,
+		MaxFileBytes: maxFileBytes,
+	}
+	err = controller.storeFileParts(upload, form.FilePart, multipartReader)
+	if err != nil {
+		controller.purgeFiles(upload.Files)
+		c.Error(err)
+		return
+	}
+	if len(upload.Files) == 1 {
+		c.IndentedJSON(http.StatusCreated, upload.Responses[0])
+		return
+	}
 
-	fileMultipart, fileHeader, err := c.Request.FormFile("file")
+	response, err := controller.addBundle(upload)
 	if err != nil {
-		c.Error(base.NewFilesRequestError(err))
+		controller.purgeFiles(upload.Files)
+		c.Error(err)
 		return
 	}
+	c.IndentedJSON(http.StatusCreated, response)
+}
 
-	fileMetadata.Name = fileHeader.Filename
+// storeFile saves file content and its metadata. Size, content digests
+// and detected mimetype are filled in while the content is stored. Content
+// not matching expected digests or of not allowed type is rejected. The
+// file is counted in storage usage of its owner unless the storage is
+// already reserved for it. Stored file is scanned for malware, it is saved
+// pending the scan.
+func (controller FilesController) storeFile(
+	fileMetadata *api.FileMetadata,
+	reader io.Reader,
+	expected *contentDigests,
+	maxFileBytes int64,
+	reserved bool,
+) (*api.AddFileResponse, error) {
+	fileData := api.FileData{
+		Identifier:     fileMetadata.Identifier,
+		ExpirationDate: fileMetadata.ExpirationDate,
+	}
+	hasher := newContentHasher(
+		controller.UploadConfig.ComputeMD5 || expected.MD5 != nil,
+	)
+	sniffer := &contentSniffer{}
+	content := &sizeLimitedReader{
+		Reader: io.TeeReader(reader, io.MultiWriter(hasher, sniffer)),
+		Limit:  maxFileBytes,
+	}
+	_, err := controller.FilesService.AddFile(&fileData, content)
+	if content.Exceeded() {
+		return nil, base.NewFileTooLargeError(maxFileBytes)
+	} else if err != nil {
+		return nil, err
+	}
 
-	mimetype := fileHeader.Header.Get("Content-Type")
-	if mimetype != "" {
-		fileMetadata.Mimetype = mimetype
-	} else {
-		if fileMetadata.Size > 0 {
-			fileMetadata.Mimetype = "application/octet-stream"
-		} else {
-			fileMetadata.Mimetype = "application/x-empty"
-		}
+	digests := hasher.Digests()
+	if err = expected.verify(digests); err != nil {
+		controller.removeFileData(fileMetadata.Identifier)
+		return nil, err
+	}
+	fileMetadata.DetectedMimetype = sniffer.ContentType()
+	if err = controller.checkContentType(fileMetadata); err != nil {
+		controller.removeFileData(fileMetadata.Identifier)
+		return nil, err
 	}
 
-	defer func(fileMultipart multipart.File) {
-		err := fileMultipart.Close()
+	fileMetadata.Size = content.BytesRead
+	fileMetadata.SHA256 = hex.EncodeToString(digests.SHA256)
+	if digests.MD5 != nil {
+		fileMetadata.MD5 = hex.EncodeToString(digests.MD5)
+	}
+	fileMetadata.Encryption = fileData.Encryption
+	if fileMetadata.Mimetype == "" {
+		fileMetadata.Mimetype = fileMetadata.DetectedMimetype
+	}
+
+	err = controller.SchemaValidator.Struct(fileMetadata)
+	if err != nil {
+		controller.removeFileData(fileMetadata.Identifier)
+		return nil, base.WrapValidationErrors(err)
+	}
+	if !reserved {
+		err = controller.UserService.ReserveStorage(fileMetadata.Username, fileMetadata.Size)
 		if err != nil {
-			base.Logger.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Warn("Close file error")
+			controller.removeFileData(fileMetadata.Identifier)
+			return nil, err
 		}
-	}(fileMultipart)
-	_, err = fileMultipart.Read(fileBytes)
+	}
+	fileMetadata.ScanStatus = base.ScanStatusPending
+	response, err := controller.FilesMetadataService.AddFileMetadata(fileMetadata)
 	if err != nil {
-		c.Error(base.NewFilesRequestError(err))
-		return
+		controller.removeFileData(fileMetadata.Identifier)
+		if !reserved {
+			controller.releaseStorage(fileMetadata)
+		}
+		return nil, err
+	}
+	if err = controller.scanFile(fileMetadata); err != nil {
+		return nil, err
 	}
+	return response, nil
+}
 
-	fileMetadata.Creation = time.Now().Unix()
-	fileMetadata.Expiration = time.Now().Add(
-		time.Minute * time.Duration(
-			controller.FilesExpConfig.MinutesLifetimeDefault,
-		),
-	).Unix()
+// buildFileMetadata fills metadata known before file content is read.
+func (controller FilesController) buildFileMetadata(
+	name string,
+	mimetype string,
+	values url.Values,
+) (*api.FileMetadata, error) {
+	fileMetadata := &api.FileMetadata{
+		Identifier:       generateShortUUID(),
+		Name:             name,
+		Mimetype:         mimetype,
+		DeclaredMimetype: mimetype,
+	}
 
-	fileData.Identifier = fileMetadata.Identifier
-	fileData.Data = fileBytes
+	creation := time.Now()
+	lifetime, err := controller.getFileLifetime(values, creation)
+	if err != nil {
+		return nil, err
+	}
+	expiration := creation.Add(lifetime)
+	fileMetadata.Creation = creation.Unix()
+	fileMetadata.Expiration = expiration.Unix()
+	fileMetadata.ExpirationDate = expiration
 
-	err = controller.SchemaValidator.Struct(fileMetadata)
+	maxDownloads, err := getMaxDownloads(values)
 	if err != nil {
-		c.Error(base.WrapValidationErrors(err))
-		return
+		return nil, err
 	}
-	err = controller.SchemaValidator.Struct(fileData)
+	fileMetadata.MaxDownloads = maxDownloads
+
+	if err = controller.setVisibility(values, fileMetadata); err != nil {
+		return nil, err
+	}
+	if err = controller.setFilePassword(values, fileMetadata); err != nil {
+		return nil, err
+	}
+	if err = controller.setEncryptionParams(values, fileMetadata); err != nil {
+		return nil, err
+	}
+	if err = controller.checkContentType(fileMetadata); err != nil {
+		return nil, err
+	}
+	return fileMetadata, nil
+}
+
+// removeFileData deletes stored content of a file which failed to be
+// uploaded completely.
+func (controller FilesController) removeFileData(fileId string) {
+	if err := controller.FilesService.DeleteFile(fileId); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"error":      err.Error(),
+		}).Error("Remove file data error")
+	}
+}
+
+// parsePaginationQueryParams reads skip and limit of listed records.
+func (controller FilesController) parsePaginationQueryParams(
+	c *gin.Context,
+) (*api.PaginationQueryParameters, error) {
+	skip, err := strconv.ParseInt(
+		c.DefaultQuery(base.SkipQueryParam, strconv.FormatInt(0, 10)), 10, 64)
 	if err != nil {
-		c.Error(base.WrapValidationErrors(err))
-		return
+		return nil, base.NewQueryParamError(base.SkipQueryParam, err)
 	}
 
-	response, err := controller.FilesMetadataService.AddFileMetadata(&fileMetadata)
+	val := strconv.FormatInt(20, 10)
+
+	limit, err := strconv.ParseInt(
+		c.DefaultQuery(base.LimitQueryParam, val), 10, 64)
 	if err != nil {
-		c.Error(err)
-		return
+		return nil, base.NewPathParamError(base.LimitQueryParam, err)
 	}
-	_, err = controller.FilesService.AddFile(&fileData)
+
+	queryParams := api.PaginationQueryParameters{Skip: skip, Limit: limit}
+	if err = controller.SchemaValidator.Struct(queryParams); err != nil {
+		return nil, base.WrapValidationErrors(err)
+	}
+	return &queryParams, nil
+}
+
+// parseListQueryParams reads pagination and filter parameters of files
+// metadata list.
+func (controller FilesController) parseListQueryParams(
+	c *gin.Context,
+) (*api.FileMetadataListQueryParameters, error) {
+	pagination, err := controller.parsePaginationQueryParams(c)
 	if err != nil {
-		c.Error(err)
-		return
+		return nil, err
 	}
 
-	c.IndentedJSON(http.StatusCreated, &response)
+	includeExpired, err := strconv.ParseBool(
+		c.DefaultQuery(base.IncludeExpiredQueryParam, strconv.FormatBool(false)))
+	if err != nil {
+		return nil, base.NewQueryParamError(base.IncludeExpiredQueryParam, err)
+	}
+
+	return &api.FileMetadataListQueryParameters{
+		PaginationQueryParameters: *pagination,
+		IncludeExpired:            includeExpired,
+	}, nil
 }
 
 // GetFileMetadataList Get files metadata
@@ -136,7 +702,7 @@ func (controller FilesController) UploadFile(c *gin.Context) {
 // @Security     User
 // @Accept       json
 // @Produce      json
-// @Param 		 _ 	  query     api.PaginationQueryParameters false "Pagination parameters"
+// @Param 		 _ 	  query     api.FileMetadataListQueryParameters false "Pagination and filter parameters"
 // @Success      200  {object}  api.FileMetadataListResponse
 // @Failure      400  {object}  api.ErrorResponse
 // @Failure      422  {object}  api.ErrorResponse
@@ -145,60 +711,118 @@ func (controller FilesController) UploadFile(c *gin.Context) {
 func (controller FilesController) GetFileMetadataList(c *gin.Context) {
 	base.Logger.Info("Requested files metadata list")
 
-	queryParams := api.PaginationQueryParameters{}
-
 	auth, err := GetAuthenticatedUser(c)
 	if err != nil {
 		return
 	}
 
-	skip, err := strconv.ParseInt(
-		c.DefaultQuery(base.SkipQueryParam, strconv.FormatInt(0, 10)), 10, 64)
+	queryParams, err := controller.parseListQueryParams(c)
 	if err != nil {
-		c.Error(base.NewQueryParamError(base.SkipQueryParam, err))
+		c.Error(err)
 		return
 	}
 
-	val := strconv.FormatInt(20, 10)
+	response, err := controller.FilesMetadataService.GetFileMetadataList(
+		queryParams,
+		auth.Username,
+	)
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
-	limit, err := strconv.ParseInt(
-		c.DefaultQuery(base.LimitQueryParam, val), 10, 64)
+	c.IndentedJSON(http.StatusOK, &response)
+}
+
+// GetSharedFileMetadataList Get shared files metadata
+// @Summary      Get files shared with user
+// @Description  This method returns metadata list of files other users
+// @Description  shared with authorized user, owner of each file is in its
+// @Description  username. Other users the files are shared with are not
+// @Description  listed
+// @Tags         Files
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 _ 	  query     api.FileMetadataListQueryParameters false "Pagination and filter parameters"
+// @Success      200  {object}  api.FileMetadataListResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/shared [get]
+func (controller FilesController) GetSharedFileMetadataList(c *gin.Context) {
+	base.Logger.Info("Requested shared files metadata list")
+
+	auth, err := GetAuthenticatedUser(c)
 	if err != nil {
-		c.Error(base.NewPathParamError(base.LimitQueryParam, err))
 		return
 	}
 
-	queryParams.Skip = skip
-	queryParams.Limit = limit
-	if err = controller.SchemaValidator.Struct(queryParams); err != nil {
-		c.Error(base.WrapValidationErrors(err))
+	queryParams, err := controller.parseListQueryParams(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	response, err := controller.FilesMetadataService.GetFileMetadataList(
-		&queryParams,
+	response, err := controller.FilesMetadataService.GetSharedFileMetadataList(
+		queryParams,
 		auth.Username,
 	)
 	if err != nil {
 		c.Error(err)
 		return
 	}
+	for _, fileMetadata := range response.Records {
+		fileMetadata.SharedWith = nil
+	}
 
 	c.IndentedJSON(http.StatusOK, &response)
 }
 
 // DownloadFile Download file
 // @Summary      Download file
-// @Description  This method downloads a specific file
+// @Description  This method downloads a specific file. Password of
+// @Description  protected file is sent in header or with POST form.
+// @Description  Range and conditional requests are supported, files
+// @Description  with download limit are always sent whole. Content
+// @Description  digests are sent in Digest and Repr-Digest headers.
+// @Description  Content encrypted by client is sent as octet stream with
+// @Description  its encryption parameters in X-Encryption-Params header.
+// @Description  Files are always sent as attachment, content which can run
+// @Description  scripts is sandboxed. Infected files are not served, nor
+// @Description  files not found clean if malware scanning is required.
+// @Description  Presigned URL carries its constraints and signature in
+// @Description  query, password is not asked with it. Files with
+// @Description  authenticated visibility are served to users authorized
+// @Description  with token, private files only to their owner and users
+// @Description  they are shared with, others are told the file is not
+// @Description  found. Plain URL is refused to others if only presigned
+// @Description  URLs are allowed. Download attempts are recorded in access
+// @Description  log of the file
 // @Tags         Files
 // @Accept       json
 // @Produce      multipart/form-data
 // @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 X-File-Password header string false "Password of protected file"
+// @Param 		 expires query int false "Expiration of presigned URL" example(1699644399)
+// @Param 		 ip query string false "Client address or network allowed by presigned URL"
+// @Param 		 max-bytes query int false "Requested bytes allowed by presigned URL"
+// @Param 		 signature query string false "Signature of presigned URL"
+// @Param 		 Range header string false "Requested byte ranges" example(bytes=0-1023)
+// @Param 		 If-None-Match header string false "Entity tag of cached file"
 // @Success      200
+// @Success      206
+// @Success      304
 // @Failure      400  {object}  api.ErrorResponse
+// @Failure      401  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
 // @Failure      422  {object}  api.ErrorResponse
+// @Failure      429  {object}  api.ErrorResponse
 // @Failure      500  {object}  api.ErrorResponse
 // @Router       /v1/files/{identifier} [get]
+// @Router       /v1/files/{identifier} [post]
 func (controller FilesController) DownloadFile(c *gin.Context) {
 	base.Logger.Info("Requested file download")
 
@@ -213,21 +837,184 @@ func (controller FilesController) DownloadFile(c *gin.Context) {
 		c.Error(err)
 		return
 	}
-	fileData, err := controller.FilesService.GetFile(fileId)
+	// Attempts are recorded for existing files only, so guessed identifiers
+	// do not fill the log with records nobody can see.
+	defer controller.recordFileAccess(c, fileId, fileMetadata.Username, "")
+	presigned, err := controller.checkPresignedUrl(c, fileMetadata)
+	if !presigned && isFileHidden(getOptionalUser(c), fileMetadata) {
+		err = base.NewFileNotFoundError(fileId)
+	} else if err == nil && !presigned {
+		err = controller.checkFileAccess(c, fileMetadata)
+	}
 	if err != nil {
 		c.Error(err)
 		return
 	}
+	if err = controller.checkScanStatus(fileMetadata); err != nil {
+		c.Error(err)
+		return
+	}
+	if fileMetadata.PasswordProtected && !presigned {
+		if err = controller.checkFilePassword(c, fileMetadata); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	setCacheValidators(c, fileMetadata)
+	if isNotModified(c.Request, fileMetadata) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	controller.sendFile(c, fileMetadata, nil)
+}
+
+// sendFile counts a download of the file, and of the share link it is
+// downloaded with if any, and streams its content. The content is opened
+// first, so a download is not counted if it can not be served. The file is
+// purged once its download limit is reached.
+func (controller FilesController) sendFile(
+	c *gin.Context,
+	fileMetadata *api.FileMetadata,
+	link *api.ShareLink,
+) {
+	fileId := fileMetadata.Identifier
+	stream, err := controller.FilesService.OpenFile(&api.FileData{
+		Identifier: fileId,
+		Encryption: fileMetadata.Encryption,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer services.CloseFileStream(stream, fileId)
+
+	// Every request of a file or link with download limit is counted, so
+	// partial content is not served for such downloads. Range requests
+	// of other links are not counted, a client fetching parts of the file
+	// does not download it several times.
+	wholeFile := fileMetadata.MaxDownloads > 0 || (link != nil && link.MaxDownloads > 0)
+	if link != nil && (wholeFile || c.GetHeader("Range") == "") {
+		_, err = controller.ShareLinksService.RegisterShareLinkDownload(link.Token)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	fileMetadata, err = controller.FilesMetadataService.RegisterFileDownload(fileId)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	setDigestHeaders(c, fileMetadata)
+	mimetype := setContentHeaders(c, fileMetadata)
+	if wholeFile {
+		c.Header("Accept-Ranges", "none")
+		c.DataFromReader(
+			http.StatusOK, fileMetadata.Size, mimetype, stream, nil,
+		)
+	} else {
+		http.ServeContent(
+			c.Writer, c.Request, fileMetadata.Name,
+			fileLastModified(fileMetadata), stream,
+		)
+	}
+
+	if services.IsDownloadLimitReached(fileMetadata) {
+		controller.purgeFile(fileMetadata)
+	}
+}
+
+// purgeFile removes a file which can not be downloaded anymore. Errors
+// are only logged since the file is not served anyway.
+func (controller FilesController) purgeFile(fileMetadata *api.FileMetadata) {
+	fileId := fileMetadata.Identifier
+	base.Logger.WithFields(logrus.Fields{
+		"identifier": fileId,
+	}).Info("Purging file")
+
+	if err := controller.FilesService.DeleteFile(fileId); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"error":      err.Error(),
+		}).Error("Purge file data error")
+		return
+	}
+	if err := controller.FilesMetadataService.DeleteFileMetadata(fileId); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"error":      err.Error(),
+		}).Error("Purge file metadata error")
+		return
+	}
+	controller.releaseStorage(fileMetadata)
+	controller.deleteShareLinks(fileId)
+}
 
-	filename := url.QueryEscape(fileMetadata.Name)
-	filename = strings.ReplaceAll(filename, "+", "%20")
+// deleteShareLinks removes links of a deleted file. Errors are only
+// logged, links of missing files do not resolve anyway.
+func (controller FilesController) deleteShareLinks(fileId string) {
+	_, err := controller.ShareLinksService.DeleteShareLinks([]string{fileId})
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"error":      err.Error(),
+		}).Error("Delete share links error")
+	}
+}
+
+func (controller FilesController) purgeFiles(files []*api.FileMetadata) {
+	for _, fileMetadata := range files {
+		controller.purgeFile(fileMetadata)
+	}
+}
+
+// DeleteFile Delete file
+// @Summary      Delete user's file
+// @Description  This method deletes a specific file of authorized user
+// @Tags         Files
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Success      204
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier} [delete]
+func (controller FilesController) DeleteFile(c *gin.Context) {
+	base.Logger.Info("Requested file deletion")
 
-	c.Header(
-		"Content-Disposition",
-		"attachment; filename=\""+filename+"\"",
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+
+	fileId := c.Param(base.FileIdPathParam)
+	if fileId == "" {
+		c.Error(base.NewPathParamRequiredError(base.FileIdPathParam))
+		return
+	}
+
+	fileMetadata, err := controller.FilesMetadataService.GetFileMetadataByOwner(
+		fileId, auth.Username,
 	)
-	c.Header("Content-Type", fileMetadata.Mimetype)
-	c.Header("Content-Length", strconv.FormatInt(fileMetadata.Size, 10))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err = controller.FilesService.DeleteFile(fileId); err != nil {
+		c.Error(err)
+		return
+	}
+	if err = controller.FilesMetadataService.DeleteFileMetadata(fileId); err != nil {
+		c.Error(err)
+		return
+	}
+	controller.releaseStorage(fileMetadata)
+	controller.deleteShareLinks(fileId)
 
-	c.Data(http.StatusOK, fileMetadata.Mimetype, fileData.Data)
+	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,1179 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"stealthy-backend/api"
+	"stealthy-backend/api/services"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupFilesRouter(
+	config *base.BackendConfig,
+	filesController FilesController,
+	authService services.BaseAuthorizationService,
+) *gin.Engine {
+	authController := AuthorizationController{
+		AuthService: authService,
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.NoRoute(api.NoRouteHandler)
+	router.NoMethod(api.NoMethodHandler)
+	router.Use(api.LogsHandler)
+	router.Use(api.ErrorHandler)
+	router.Use(api.CORSHandler)
+
+	applicationGroup := router.Group(config.Server.BasePath)
+	v1 := applicationGroup.Group("/v1")
+
+	filesGroup := v1.Group("/files").Use(authController.AuthorizeOptionally)
+	filesGroup.GET(
+		fmt.Sprintf("/:%s", base.FileIdPathParam),
+		filesController.DownloadFile,
+	)
+	filesGroup.POST(
+		fmt.Sprintf("/:%s", base.FileIdPathParam),
+		filesController.DownloadFile,
+	)
+
+	withAuthFilesGroup := v1.Group("/files").Use(authController.Authorize)
+	withAuthFilesGroup.POST("", filesController.UploadFile)
+	withAuthFilesGroup.GET("", filesController.GetFileMetadataList)
+	withAuthFilesGroup.GET("/shared", filesController.GetSharedFileMetadataList)
+	withAuthFilesGroup.DELETE(
+		fmt.Sprintf("/:%s", base.FileIdPathParam),
+		filesController.DeleteFile,
+	)
+	withAuthFilesGroup.PUT(
+		fmt.Sprintf("/:%s/grants/:%s", base.FileIdPathParam, base.GranteePathParam),
+		filesController.ShareFile,
+	)
+	withAuthFilesGroup.DELETE(
+		fmt.Sprintf("/:%s/grants/:%s", base.FileIdPathParam, base.GranteePathParam),
+		filesController.UnshareFile,
+	)
+	withAuthFilesGroup.GET(
+		fmt.Sprintf("/:%s/accesses", base.FileIdPathParam),
+		filesController.GetFileAccesses,
+	)
+	withAuthFilesGroup.POST(
+		fmt.Sprintf("/:%s/presign", base.FileIdPathParam),
+		filesController.PresignFile,
+	)
+
+	return router
+}
+
+type FilesApiTestSuite struct {
+	suite.Suite
+	Config              *base.BackendConfig
+	AuthToken           string
+	UserFixture         *api.User
+	FileMetadataFixture *api.FileMetadata
+	FileDataFixture     *api.FileData
+	FilesServiceMock    *tests.BaseFilesService
+	MetadataServiceMock *tests.BaseFilesMetadataService
+	BundlesServiceMock  *tests.BaseBundlesService
+	ShareLinksMock      *tests.BaseShareLinksService
+	AccessLogMock       *tests.BaseFileAccessLogService
+	UserServiceMock     *tests.BaseUserService
+	AuthServiceMock     *tests.BaseAuthorizationService
+	ScannerMock         *tests.BaseScanner
+	StorageFixture      *api.UserStorage
+	Router              *gin.Engine
+}
+
+// mockUserStorage makes storage of the user follow the fixture, usage is
+// reserved and released successfully unless a test expects otherwise.
+func mockUserStorage(
+	userServiceMock *tests.BaseUserService,
+	username string,
+	storage *api.UserStorage,
+) {
+	userServiceMock.On("GetUserStorage", username).Return(
+		func(string) (*api.UserStorage, error) { return storage, nil },
+	).Maybe()
+	userServiceMock.On("ReserveStorage", username, mock.Anything).Return(nil).Maybe()
+	userServiceMock.On("ReleaseStorage", username, mock.Anything).Return(nil).Maybe()
+}
+
+// mockScanner makes scanned content clean and its scan status saved
+// unless a test expects otherwise.
+func mockScanner(
+	scannerMock *tests.BaseScanner,
+	metadataServiceMock *tests.BaseFilesMetadataService,
+) {
+	scannerMock.On("Scan", mock.Anything).Return(&api.ScanResult{}, nil).Maybe()
+	metadataServiceMock.On("SetScanStatus", mock.Anything, mock.Anything).Return(nil).Maybe()
+}
+
+// mockFileAccessLog makes download attempts recorded successfully unless
+// a test expects otherwise.
+func mockFileAccessLog(
+	accessLogServiceMock *tests.BaseFileAccessLogService,
+	metadataServiceMock *tests.BaseFilesMetadataService,
+) {
+	accessLogServiceMock.On("AddFileAccess", mock.Anything).Return(nil).Maybe()
+	metadataServiceMock.On("RegisterFileAccess", mock.Anything).Return(nil).Maybe()
+}
+
+// mockShareLinks makes links of deleted files removed successfully unless
+// a test expects otherwise.
+func mockShareLinks(shareLinksServiceMock *tests.BaseShareLinksService) {
+	shareLinksServiceMock.On("DeleteShareLinks", mock.Anything).Return(int64(0), nil).Maybe()
+}
+
+func (s *FilesApiTestSuite) SetupTest() {
+	s.Config = &base.BackendConfig{}
+	s.Config.SetDefaults()
+	s.Config.MongoDB.Database = "sharing-backend-test"
+	s.Config.Server.Socket = "test-app-host"
+	s.Config.Logs.AppName = "sharing-backend-test"
+	s.Config.Presign.SecretKey = "presign_secret_key_of_test_server"
+
+	s.AuthToken = "authorization_token"
+	s.UserFixture = &api.User{Username: "valid_username"}
+
+	fileMetadata := api.FileMetadata{
+		Identifier: "YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm",
+		Name:       "file.txt",
+		Username:   s.UserFixture.Username,
+		Size:       4,
+		Mimetype:   "text/plain",
+		Creation:   time.Now().Add(-time.Hour).Unix(),
+		Expiration: time.Now().Add(time.Hour).Unix(),
+		SHA256:     fmt.Sprintf("%x", sha256.Sum256([]byte("data"))),
+	}
+	s.FileMetadataFixture = &fileMetadata
+	s.FileDataFixture = &api.FileData{
+		Identifier: fileMetadata.Identifier,
+		Data:       []byte("data"),
+	}
+
+	s.FilesServiceMock = tests.NewBaseFilesService(s.T())
+	s.MetadataServiceMock = tests.NewBaseFilesMetadataService(s.T())
+	s.BundlesServiceMock = tests.NewBaseBundlesService(s.T())
+	s.ShareLinksMock = tests.NewBaseShareLinksService(s.T())
+	s.AccessLogMock = tests.NewBaseFileAccessLogService(s.T())
+	s.UserServiceMock = tests.NewBaseUserService(s.T())
+	s.AuthServiceMock = tests.NewBaseAuthorizationService(s.T())
+	s.ScannerMock = tests.NewBaseScanner(s.T())
+	s.StorageFixture = &api.UserStorage{}
+	mockUserStorage(s.UserServiceMock, s.UserFixture.Username, s.StorageFixture)
+	mockScanner(s.ScannerMock, s.MetadataServiceMock)
+	mockShareLinks(s.ShareLinksMock)
+	mockFileAccessLog(s.AccessLogMock, s.MetadataServiceMock)
+	filesController := FilesController{
+		FilesService:         s.FilesServiceMock,
+		FilesMetadataService: s.MetadataServiceMock,
+		BundlesService:       s.BundlesServiceMock,
+		ShareLinksService:    s.ShareLinksMock,
+		FileAccessLogService: s.AccessLogMock,
+		UserService:          s.UserServiceMock,
+		FilesExpConfig:       &s.Config.FilesExpConfig,
+		UploadConfig:         &s.Config.Upload,
+		ContentTypes:         &s.Config.ContentTypes,
+		Scanning:             &s.Config.Scanning,
+		Scanner:              s.ScannerMock,
+		Presign:              &s.Config.Presign,
+		Signer:               services.URLSigner{Key: []byte(s.Config.Presign.SecretKey)},
+		PasswordLimiter:      services.NewAttemptsLimiter(&s.Config.FilesPassword),
+		SchemaValidator:      base.CreateValidator(),
+	}
+	s.Router = setupFilesRouter(s.Config, filesController, s.AuthServiceMock)
+}
+
+func (s *FilesApiTestSuite) serve(req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.Router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (s *FilesApiTestSuite) newRequest(
+	method string,
+	url string,
+	authorized bool,
+) *http.Request {
+	req, err := http.NewRequest(method, getRequestUrl(s.Config, url), nil)
+	assert.NoError(s.T(), err)
+	if authorized {
+		s.AuthServiceMock.On("ParseToken", s.AuthToken).Return(s.UserFixture, nil)
+		req.Header["Authorization"] = []string{s.AuthToken}
+	}
+	return req
+}
+
+func (s *FilesApiTestSuite) newUploadRequest(
+	fields map[string]string,
+	contents ...[]byte,
+) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, value := range fields {
+		assert.NoError(s.T(), writer.WriteField(name, value))
+	}
+	for _, content := range contents {
+		part, err := writer.CreateFormFile(base.FileFormField, "file.txt")
+		assert.NoError(s.T(), err)
+		_, err = part.Write(content)
+		assert.NoError(s.T(), err)
+	}
+	assert.NoError(s.T(), writer.Close())
+
+	req := s.newRequest("POST", "/files", true)
+	req.Body = io.NopCloser(body)
+	req.ContentLength = int64(body.Len())
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Content-Length", strconv.Itoa(body.Len()))
+	return req
+}
+
+func (s *FilesApiTestSuite) mockAddFile() *[]byte {
+	var content []byte
+	s.FilesServiceMock.On("AddFile", mock.Anything, mock.Anything).Return(
+		func(request *api.FileData, reader io.Reader) (*api.AddFileResponse, error) {
+			var err error
+			content, err = io.ReadAll(reader)
+			if err != nil {
+				return nil, base.NewFilesRequestError(err)
+			}
+			return &api.AddFileResponse{Identifier: request.Identifier}, nil
+		},
+	)
+	s.FilesServiceMock.On("OpenFile", mock.Anything).Return(
+		func(*api.FileData) (io.ReadSeekCloser, error) {
+			return services.NopSeekCloser(bytes.NewReader(content)), nil
+		},
+	).Maybe()
+	return &content
+}
+
+func (s *FilesApiTestSuite) uploadWithLifetime(
+	fields map[string]string,
+) time.Duration {
+	var lifetime time.Duration
+	s.MetadataServiceMock.On("AddFileMetadata", mock.MatchedBy(
+		func(fileMetadata *api.FileMetadata) bool {
+			lifetime = time.Duration(
+				fileMetadata.Expiration-fileMetadata.Creation,
+			) * time.Second
+			return fileMetadata.Username == s.UserFixture.Username
+		},
+	)).Return(&api.AddFileResponse{Identifier: "identifier"}, nil)
+	s.mockAddFile()
+
+	recorder := s.serve(s.newUploadRequest(fields, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	return lifetime
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileDefaultLifetime() {
+	lifetime := s.uploadWithLifetime(map[string]string{})
+
+	assert.Equal(s.T(), s.Config.FilesExpConfig.DefaultLifetime(), lifetime)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileCustomLifetime() {
+	lifetime := s.uploadWithLifetime(map[string]string{
+		base.LifetimeMinutesFormField: "30",
+	})
+
+	assert.Equal(s.T(), 30*time.Minute, lifetime)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileLifetimeClamped() {
+	lifetime := s.uploadWithLifetime(map[string]string{
+		base.ExpiresAtFormField: strconv.FormatInt(
+			time.Now().Add(365*24*time.Hour).Unix(), 10,
+		),
+	})
+
+	assert.Equal(
+		s.T(),
+		time.Minute*time.Duration(s.Config.FilesExpConfig.MinutesLifetimeMax),
+		lifetime,
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileStreamsContent() {
+	fileContent := bytes.Repeat([]byte("stealthy"), 4096)
+	content := s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.MatchedBy(
+		func(fileMetadata *api.FileMetadata) bool {
+			return fileMetadata.Size == int64(len(fileContent)) &&
+				fileMetadata.Name == "file.txt" &&
+				fileMetadata.SHA256 == fmt.Sprintf("%x", sha256.Sum256(fileContent))
+		},
+	)).Return(&api.AddFileResponse{Identifier: "identifier"}, nil)
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, fileContent))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	assert.Equal(s.T(), fileContent, *content)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileTooLarge() {
+	s.Config.Upload.MaxFileBytes = 4
+	s.mockAddFile()
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("content")))
+
+	assert.Equal(s.T(), http.StatusRequestEntityTooLarge, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "AddFileMetadata", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileWithDigest() {
+	s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.Anything).Return(
+		func(fileMetadata *api.FileMetadata) (*api.AddFileResponse, error) {
+			return &api.AddFileResponse{
+				Identifier: fileMetadata.Identifier,
+				SHA256:     fileMetadata.SHA256,
+				MD5:        fileMetadata.MD5,
+			}, nil
+		},
+	)
+	sha256Sum := sha256.Sum256([]byte("data"))
+	md5Sum := md5.Sum([]byte("data"))
+	req := s.newUploadRequest(map[string]string{}, []byte("data"))
+	req.Header.Set(
+		base.DigestHeader,
+		"sha-256="+base64.StdEncoding.EncodeToString(sha256Sum[:])+", unixsum=30637",
+	)
+	req.Header.Set(base.ContentMD5Header, base64.StdEncoding.EncodeToString(md5Sum[:]))
+
+	recorder := s.serve(req)
+
+	var response api.AddFileResponse
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(s.T(), fmt.Sprintf("%x", sha256Sum), response.SHA256)
+	assert.Equal(s.T(), fmt.Sprintf("%x", md5Sum), response.MD5)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileDigestMismatch() {
+	s.mockAddFile()
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(nil)
+	sum := sha256.Sum256([]byte("other data"))
+	req := s.newUploadRequest(map[string]string{}, []byte("data"))
+	req.Header.Set(
+		base.DigestHeader, "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]),
+	)
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	s.FilesServiceMock.AssertCalled(s.T(), "DeleteFile", mock.Anything)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "AddFileMetadata", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileInvalidDigest() {
+	req := s.newUploadRequest(map[string]string{}, []byte("data"))
+	req.Header.Set(base.ContentMD5Header, "not base64")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileInvalidLifetime() {
+	recorder := s.serve(s.newUploadRequest(map[string]string{
+		base.LifetimeMinutesFormField: "-5",
+	}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileReservesStorage() {
+	s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.Anything).Return(
+		&api.AddFileResponse{Identifier: "identifier"}, nil,
+	)
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	s.UserServiceMock.AssertCalled(
+		s.T(), "ReserveStorage", s.UserFixture.Username, int64(4),
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileFilesQuotaReached() {
+	s.StorageFixture.Quota.MaxFiles = 2
+	s.StorageFixture.Usage.Files = 2
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusInsufficientStorage, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileBytesQuotaExceeded() {
+	s.StorageFixture.Quota.MaxTotalBytes = 100 << 10
+	s.StorageFixture.Usage.Bytes = 10 << 10
+
+	recorder := s.serve(s.newUploadRequest(
+		map[string]string{}, bytes.Repeat([]byte("a"), 200<<10),
+	))
+
+	assert.Equal(s.T(), http.StatusInsufficientStorage, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileLargerThanQuotaLeft() {
+	s.StorageFixture.Quota.MaxTotalBytes = 10
+	s.StorageFixture.Usage.Bytes = 8
+	s.mockAddFile()
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(nil).Maybe()
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusRequestEntityTooLarge, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "AddFileMetadata", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileQuotaExceededConcurrently() {
+	s.UserServiceMock.ExpectedCalls = nil
+	s.UserServiceMock.On("GetUserStorage", s.UserFixture.Username).Return(
+		s.StorageFixture, nil,
+	)
+	s.UserServiceMock.On("ReserveStorage", s.UserFixture.Username, int64(4)).Return(
+		base.NewStorageQuotaError("Quota allows 1 files"),
+	)
+	s.mockAddFile()
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusInsufficientStorage, recorder.Code)
+	s.FilesServiceMock.AssertCalled(s.T(), "DeleteFile", mock.Anything)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "AddFileMetadata", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileDetectsMimetype() {
+	s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.MatchedBy(
+		func(fileMetadata *api.FileMetadata) bool {
+			return fileMetadata.DeclaredMimetype == base.OctetStreamMimetype &&
+				fileMetadata.DetectedMimetype == "text/html; charset=utf-8" &&
+				fileMetadata.Mimetype == base.OctetStreamMimetype
+		},
+	)).Return(&api.AddFileResponse{Identifier: "identifier"}, nil)
+
+	recorder := s.serve(s.newUploadRequest(
+		map[string]string{}, []byte("<html><body>hello</body></html>"),
+	))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileDeniedExtension() {
+	s.Config.ContentTypes.DeniedExtensions = []string{".TXT"}
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusUnsupportedMediaType, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileNotAllowedDeclaredType() {
+	s.Config.ContentTypes.AllowedTypes = []string{"image/*"}
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusUnsupportedMediaType, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileDeniedDetectedType() {
+	s.Config.ContentTypes.DeniedTypes = []string{"text/*"}
+	s.mockAddFile()
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newUploadRequest(
+		map[string]string{}, []byte("<html><body>hello</body></html>"),
+	))
+
+	assert.Equal(s.T(), http.StatusUnsupportedMediaType, recorder.Code)
+	s.FilesServiceMock.AssertCalled(s.T(), "DeleteFile", mock.Anything)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "AddFileMetadata", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileScanned() {
+	content := s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.MatchedBy(
+		func(fileMetadata *api.FileMetadata) bool {
+			return fileMetadata.ScanStatus == base.ScanStatusPending
+		},
+	)).Return(&api.AddFileResponse{Identifier: "identifier"}, nil)
+	s.ScannerMock.ExpectedCalls = nil
+	s.ScannerMock.On("Scan", mock.Anything).Return(
+		func(reader io.Reader) (*api.ScanResult, error) {
+			scanned, err := io.ReadAll(reader)
+			assert.NoError(s.T(), err)
+			assert.Equal(s.T(), *content, scanned)
+			return &api.ScanResult{}, nil
+		},
+	)
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	s.MetadataServiceMock.AssertCalled(
+		s.T(), "SetScanStatus", mock.Anything, base.ScanStatusClean,
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadInfectedFile() {
+	s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.Anything).Return(
+		&api.AddFileResponse{Identifier: "identifier"}, nil,
+	)
+	s.ScannerMock.ExpectedCalls = nil
+	s.ScannerMock.On("Scan", mock.Anything).Return(
+		&api.ScanResult{Infected: true, Signature: "Eicar-Signature"}, nil,
+	)
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(nil)
+	s.MetadataServiceMock.On("DeleteFileMetadata", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+	assert.Contains(s.T(), recorder.Body.String(), "Eicar-Signature")
+	s.UserServiceMock.AssertCalled(
+		s.T(), "ReleaseStorage", s.UserFixture.Username,
+		&api.UserUsage{Files: 1, Bytes: 4},
+	)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "SetScanStatus", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileScanError() {
+	s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.Anything).Return(
+		&api.AddFileResponse{Identifier: "identifier"}, nil,
+	)
+	s.ScannerMock.ExpectedCalls = nil
+	s.ScannerMock.On("Scan", mock.Anything).Return(
+		nil, base.NewScannerError(fmt.Errorf("connection refused")),
+	)
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	s.MetadataServiceMock.AssertCalled(
+		s.T(), "SetScanStatus", mock.Anything, base.ScanStatusError,
+	)
+}
+
+func (s *FilesApiTestSuite) mockAddFiles() *map[string][]byte {
+	stored := map[string][]byte{}
+	s.FilesServiceMock.On("AddFile", mock.Anything, mock.Anything).Return(
+		func(request *api.FileData, reader io.Reader) (*api.AddFileResponse, error) {
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, base.NewFilesRequestError(err)
+			}
+			stored[request.Identifier] = content
+			return &api.AddFileResponse{Identifier: request.Identifier}, nil
+		},
+	)
+	s.FilesServiceMock.On("OpenFile", mock.Anything).Return(
+		func(file *api.FileData) (io.ReadSeekCloser, error) {
+			return services.NopSeekCloser(bytes.NewReader(stored[file.Identifier])), nil
+		},
+	).Maybe()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.Anything).Return(
+		func(fileMetadata *api.FileMetadata) (*api.AddFileResponse, error) {
+			return &api.AddFileResponse{Identifier: fileMetadata.Identifier}, nil
+		},
+	).Maybe()
+	return &stored
+}
+
+func (s *FilesApiTestSuite) TestApiUploadMultipleFiles() {
+	stored := s.mockAddFiles()
+	var bundle *api.Bundle
+	s.BundlesServiceMock.On("AddBundle", mock.Anything).Return(
+		func(added *api.Bundle) error {
+			bundle = added
+			return nil
+		},
+	)
+
+	recorder := s.serve(s.newUploadRequest(
+		map[string]string{base.PasswordFormField: "p@ssw0rd"},
+		[]byte("first"), []byte("second"),
+	))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	var response api.AddBundleResponse
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(s.T(), bundle.Identifier, response.Identifier)
+	assert.Equal(s.T(), s.UserFixture.Username, bundle.Username)
+	assert.Len(s.T(), response.Files, 2)
+	assert.Equal(s.T(), []string{
+		response.Files[0].Identifier, response.Files[1].Identifier,
+	}, bundle.Files)
+	assert.Equal(s.T(), []byte("first"), (*stored)[bundle.Files[0]])
+	assert.Equal(s.T(), []byte("second"), (*stored)[bundle.Files[1]])
+	assert.Greater(s.T(), bundle.Expiration, time.Now().Unix())
+
+	var hashes []string
+	for _, call := range s.MetadataServiceMock.Calls {
+		if call.Method == "AddFileMetadata" {
+			fileMetadata := call.Arguments.Get(0).(*api.FileMetadata)
+			assert.True(s.T(), fileMetadata.PasswordProtected)
+			hashes = append(hashes, fileMetadata.PasswordHash)
+		}
+	}
+	assert.Len(s.T(), hashes, 2)
+	assert.Equal(s.T(), hashes[0], hashes[1])
+}
+
+func (s *FilesApiTestSuite) TestApiUploadMultipleFilesRollback() {
+	s.Config.ContentTypes.DeniedTypes = []string{"text/html"}
+	stored := s.mockAddFiles()
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(nil)
+	s.MetadataServiceMock.On("DeleteFileMetadata", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newUploadRequest(
+		map[string]string{}, []byte("first"), []byte("<html></html>"),
+	))
+
+	assert.Equal(s.T(), http.StatusUnsupportedMediaType, recorder.Code)
+	assert.Len(s.T(), *stored, 2)
+	for fileId := range *stored {
+		s.FilesServiceMock.AssertCalled(s.T(), "DeleteFile", fileId)
+	}
+	s.MetadataServiceMock.AssertNumberOfCalls(s.T(), "DeleteFileMetadata", 1)
+	s.BundlesServiceMock.AssertNotCalled(s.T(), "AddBundle", mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadTooManyFiles() {
+	s.Config.Upload.MaxFilesPerRequest = 2
+	s.mockAddFiles()
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(nil)
+	s.MetadataServiceMock.On("DeleteFileMetadata", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newUploadRequest(
+		map[string]string{}, []byte("first"), []byte("second"), []byte("third"),
+	))
+
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	s.FilesServiceMock.AssertNumberOfCalls(s.T(), "AddFile", 2)
+	s.MetadataServiceMock.AssertNumberOfCalls(s.T(), "DeleteFileMetadata", 2)
+	s.UserServiceMock.AssertNumberOfCalls(s.T(), "ReleaseStorage", 2)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadMultipleFilesWithDigest() {
+	s.mockAddFiles()
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(nil)
+	s.MetadataServiceMock.On("DeleteFileMetadata", mock.Anything).Return(nil)
+	sum := sha256.Sum256([]byte("first"))
+	req := s.newUploadRequest(map[string]string{}, []byte("first"), []byte("second"))
+	req.Header.Set(
+		base.DigestHeader, "sha-256="+base64.StdEncoding.EncodeToString(sum[:]),
+	)
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	s.FilesServiceMock.AssertNumberOfCalls(s.T(), "AddFile", 1)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadEndToEndEncryptedFile() {
+	s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.MatchedBy(
+		func(fileMetadata *api.FileMetadata) bool {
+			return fileMetadata.EndToEndEncrypted &&
+				fileMetadata.EncryptionParams == "eyJpdiI6IjEyMyJ9" &&
+				fileMetadata.Mimetype == base.OctetStreamMimetype
+		},
+	)).Return(&api.AddFileResponse{Identifier: "identifier"}, nil)
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{
+		base.EncryptionParamsFormField: "eyJpdiI6IjEyMyJ9",
+	}, []byte("ciphertext")))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileInvalidEncryptionParams() {
+	recorder := s.serve(s.newUploadRequest(map[string]string{
+		base.EncryptionParamsFormField: strings.Repeat("a", 1025),
+	}, []byte("ciphertext")))
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) mockDownloadableFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+	s.MetadataServiceMock.On("RegisterFileDownload", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+}
+
+func (s *FilesApiTestSuite) mockFileContent() {
+	s.FilesServiceMock.On("OpenFile", &api.FileData{
+		Identifier: s.FileMetadataFixture.Identifier,
+	}).Return(
+		services.NopSeekCloser(bytes.NewReader(s.FileDataFixture.Data)), nil,
+	)
+}
+
+func (s *FilesApiTestSuite) protectWithPassword(password string) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	assert.NoError(s.T(), err)
+	s.FileMetadataFixture.PasswordProtected = true
+	s.FileMetadataFixture.PasswordHash = string(hash)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+	assert.Equal(
+		s.T(),
+		"attachment; filename=\"file.txt\"",
+		recorder.Header().Get("Content-Disposition"),
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadInfectedFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.ScanStatus = base.ScanStatusInfected
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadNotScannedFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.Config.Scanning.Required = true
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+
+	for _, status := range []string{"", base.ScanStatusPending, base.ScanStatusError} {
+		s.FileMetadataFixture.ScanStatus = status
+		recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+		assert.Equal(s.T(), http.StatusForbidden, recorder.Code, status)
+	}
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadCleanFileScanRequired() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.Config.Scanning.Required = true
+	s.FileMetadataFixture.ScanStatus = base.ScanStatusClean
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileScanNotRequired() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.ScanStatus = base.ScanStatusError
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadDangerousFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.Mimetype = "image/svg+xml"
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), "image/svg+xml", recorder.Header().Get("Content-Type"))
+	assert.Equal(s.T(), "nosniff", recorder.Header().Get("X-Content-Type-Options"))
+	assert.Equal(s.T(), "sandbox", recorder.Header().Get("Content-Security-Policy"))
+	assert.Equal(
+		s.T(),
+		"attachment; filename=\"file.txt\"",
+		recorder.Header().Get("Content-Disposition"),
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileDetectedAsDangerous() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.DetectedMimetype = "text/html; charset=utf-8"
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), "text/plain", recorder.Header().Get("Content-Type"))
+	assert.Equal(s.T(), "sandbox", recorder.Header().Get("Content-Security-Policy"))
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadEndToEndEncryptedFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.EndToEndEncrypted = true
+	s.FileMetadataFixture.EncryptionParams = "eyJpdiI6IjEyMyJ9"
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), base.OctetStreamMimetype, recorder.Header().Get("Content-Type"))
+	assert.Equal(
+		s.T(), "eyJpdiI6IjEyMyJ9", recorder.Header().Get(base.EncryptionParamsHeader),
+	)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileValidators() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), "bytes", recorder.Header().Get("Accept-Ranges"))
+	assert.Equal(
+		s.T(),
+		"\""+s.FileMetadataFixture.SHA256+"\"",
+		recorder.Header().Get("ETag"),
+	)
+	assert.Equal(
+		s.T(),
+		time.Unix(s.FileMetadataFixture.Creation, 0).UTC().Format(http.TimeFormat),
+		recorder.Header().Get("Last-Modified"),
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileDigests() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.MD5 = fmt.Sprintf("%x", md5.Sum([]byte("data")))
+	s.mockDownloadableFile()
+	s.mockFileContent()
+	sha256Sum := sha256.Sum256([]byte("data"))
+	md5Sum := md5.Sum([]byte("data"))
+	sha256Encoded := base64.StdEncoding.EncodeToString(sha256Sum[:])
+	md5Encoded := base64.StdEncoding.EncodeToString(md5Sum[:])
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(
+		s.T(),
+		"sha-256="+sha256Encoded+", md5="+md5Encoded,
+		recorder.Header().Get(base.DigestHeader),
+	)
+	assert.Equal(
+		s.T(),
+		"sha-256=:"+sha256Encoded+":, md5=:"+md5Encoded+":",
+		recorder.Header().Get(base.ReprDigestHeader),
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileRange() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set("Range", "bytes=1-2")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusPartialContent, recorder.Code)
+	assert.Equal(s.T(), "bytes 1-2/4", recorder.Header().Get("Content-Range"))
+	assert.Equal(s.T(), []byte("at"), recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileIfRangeChanged() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set("Range", "bytes=1-2")
+	req.Header.Set("If-Range", "\"outdated\"")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileRangeIgnoredWithLimit() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.MaxDownloads = 5
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set("Range", "bytes=1-2")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), "none", recorder.Header().Get("Accept-Ranges"))
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileNotModified() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set("If-None-Match", "W/\""+s.FileMetadataFixture.SHA256+"\"")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusNotModified, recorder.Code)
+	assert.Empty(s.T(), recorder.Body.Bytes())
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileNotModifiedSince() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusNotModified, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileModified() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set("If-None-Match", "\"outdated\"")
+	req.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadExpiredFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		nil, base.NewFileExpiredError(fileId),
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+	actualResponse := api.ErrorResponse{}
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actualResponse))
+	assert.Equal(s.T(), base.NewFileExpiredError(fileId).Summary, actualResponse.Summary)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileLastAllowedTime() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.MaxDownloads = 1
+	s.FileMetadataFixture.DownloadCount = 1
+	s.mockDownloadableFile()
+	s.mockFileContent()
+	s.FilesServiceMock.On("DeleteFile", fileId).Return(nil)
+	s.MetadataServiceMock.On("DeleteFileMetadata", fileId).Return(nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileWithInvalidToken() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockDownloadableFile()
+	s.mockFileContent()
+	s.AuthServiceMock.On("ParseToken", "expired_token").Return(
+		nil, base.ServiceError{Summary: "Token expired", Status: http.StatusUnauthorized},
+	)
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set("Authorization", "expired_token")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileLimitReached() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+	s.MetadataServiceMock.On("RegisterFileDownload", fileId).Return(
+		nil, base.NewFileDownloadLimitError(fileId),
+	)
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+	assert.NotContains(s.T(), recorder.Body.String(), string(s.FileDataFixture.Data))
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadFileStorageErrorNotCounted() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.MaxDownloads = 1
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+	s.FilesServiceMock.On("OpenFile", mock.Anything).Return(
+		nil, base.NewStorageError(assert.AnError),
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusInternalServerError, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadProtectedFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.protectWithPassword("p@ssw0rd")
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set(base.FilePasswordHeader, "p@ssw0rd")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadProtectedFileWithForm() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.protectWithPassword("p@ssw0rd")
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequest("POST", "/files/"+fileId, false)
+	form := url.Values{base.PasswordFormField: {"p@ssw0rd"}}.Encode()
+	req.Body = io.NopCloser(strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadProtectedFileWithoutPassword() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.protectWithPassword("p@ssw0rd")
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusUnauthorized, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadProtectedFileInvalidPassword() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.protectWithPassword("p@ssw0rd")
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		s.FileMetadataFixture, nil,
+	)
+
+	for i := 0; i < s.Config.FilesPassword.MaxAttempts; i++ {
+		req := s.newRequest("GET", "/files/"+fileId, false)
+		req.Header.Set(base.FilePasswordHeader, "wrong_password")
+		recorder := s.serve(req)
+		assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	}
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set(base.FilePasswordHeader, "p@ssw0rd")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusTooManyRequests, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDeleteFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(s.FileMetadataFixture, nil)
+	s.FilesServiceMock.On("DeleteFile", fileId).Return(nil)
+	s.MetadataServiceMock.On("DeleteFileMetadata", fileId).Return(nil)
+
+	recorder := s.serve(s.newRequest("DELETE", "/files/"+fileId, true))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	s.UserServiceMock.AssertCalled(
+		s.T(), "ReleaseStorage", s.UserFixture.Username, &api.UserUsage{Files: 1, Bytes: 4},
+	)
+	s.ShareLinksMock.AssertCalled(s.T(), "DeleteShareLinks", []string{fileId})
+}
+
+func (s *FilesApiTestSuite) TestApiDeleteFileOfAnotherUser() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(nil, base.NewFileAccessDeniedError(fileId))
+
+	recorder := s.serve(s.newRequest("DELETE", "/files/"+fileId, true))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "DeleteFile", fileId)
+}
+
+func TestFilesApi(t *testing.T) {
+	suite.Run(t, new(FilesApiTestSuite))
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+)
+
+// canAccessFile tells if the user owns the file or the file was shared
+// with the user.
+func canAccessFile(user *api.User, fileMetadata *api.FileMetadata) bool {
+	return user != nil && (user.Username == fileMetadata.Username ||
+		slices.Contains(fileMetadata.SharedWith, user.Username))
+}
+
+// isFileHidden tells if the file is private and not shared with the user,
+// such file is reported as not found so its identifier is not confirmed.
+func isFileHidden(user *api.User, fileMetadata *api.FileMetadata) bool {
+	return fileMetadata.Visibility == base.VisibilityPrivate &&
+		!canAccessFile(user, fileMetadata)
+}
+
+// isFileListed tells if the user may see the file among files of a bundle.
+func isFileListed(user *api.User, fileMetadata *api.FileMetadata) bool {
+	if fileMetadata.Visibility == base.VisibilityAuthenticated {
+		return user != nil
+	}
+	return !isFileHidden(user, fileMetadata)
+}
+
+// checkFileAccess verifies the request may download the file with plain
+// URL. Authenticated files require signed in user, private files the owner
+// or a user the file is shared with. Other files require presigned URL in
+// owner only mode unless requested by such user.
+func (controller FilesController) checkFileAccess(
+	c *gin.Context,
+	fileMetadata *api.FileMetadata,
+) error {
+	user := getOptionalUser(c)
+	if canAccessFile(user, fileMetadata) {
+		return nil
+	}
+	if isFileHidden(user, fileMetadata) {
+		return base.NewFileNotFoundError(fileMetadata.Identifier)
+	}
+	if fileMetadata.Visibility == base.VisibilityAuthenticated && user == nil {
+		return base.NewFileAuthenticationRequiredError(fileMetadata.Identifier)
+	}
+	if controller.Presign.OwnerOnly {
+		return base.NewPresignedUrlRequiredError()
+	}
+	return nil
+}
+
+// getGrant returns the owned file and the user of requested grant.
+func (controller FilesController) getGrant(
+	c *gin.Context,
+) (*api.FileMetadata, string, error) {
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fileId := c.Param(base.FileIdPathParam)
+	if fileId == "" {
+		err = base.NewPathParamRequiredError(base.FileIdPathParam)
+		c.Error(err)
+		return nil, "", err
+	}
+	username := c.Param(base.GranteePathParam)
+	if username == "" {
+		err = base.NewPathParamRequiredError(base.GranteePathParam)
+		c.Error(err)
+		return nil, "", err
+	}
+
+	fileMetadata, err := controller.FilesMetadataService.GetFileMetadataByOwner(
+		fileId, auth.Username,
+	)
+	if err != nil {
+		c.Error(err)
+		return nil, "", err
+	}
+	return fileMetadata, username, nil
+}
+
+// ShareFile Share file with user
+// @Summary      Share file with user
+// @Description  This method grants a registered user access to a file of
+// @Description  authorized user. The file is listed among files shared
+// @Description  with that user, who can download it with own token even
+// @Description  if the file is private
+// @Tags         Files
+// @Security     User
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 username path string true "Username of the grantee" example(jane_doe)
+// @Success      204
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/grants/{username} [put]
+func (controller FilesController) ShareFile(c *gin.Context) {
+	base.Logger.Info("Requested sharing file with user")
+
+	fileMetadata, username, err := controller.getGrant(c)
+	if err != nil {
+		return
+	}
+	if username == fileMetadata.Username {
+		c.Error(base.NewFileGrantOwnerError(fileMetadata.Identifier))
+		return
+	}
+	if _, err = controller.UserService.GetUserByUsername(username); err != nil {
+		c.Error(err)
+		return
+	}
+	err = controller.FilesMetadataService.ShareFile(fileMetadata.Identifier, username)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnshareFile Stop sharing file with user
+// @Summary      Stop sharing file with user
+// @Description  This method revokes access of a user to a file of
+// @Description  authorized user
+// @Tags         Files
+// @Security     User
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 username path string true "Username of the grantee" example(jane_doe)
+// @Success      204
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/grants/{username} [delete]
+func (controller FilesController) UnshareFile(c *gin.Context) {
+	base.Logger.Info("Requested unsharing file with user")
+
+	fileMetadata, username, err := controller.getGrant(c)
+	if err != nil {
+		return
+	}
+	if !slices.Contains(fileMetadata.SharedWith, username) {
+		c.Error(base.NewFileGrantNotFoundError(fileMetadata.Identifier, username))
+		return
+	}
+	err = controller.FilesMetadataService.UnshareFile(fileMetadata.Identifier, username)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+)
+
+// newRequestAs returns request authorized by the given user.
+func (s *FilesApiTestSuite) newRequestAs(
+	method string,
+	url string,
+	username string,
+) *http.Request {
+	token := "authorization_token_of_" + username
+	s.AuthServiceMock.On("ParseToken", token).Return(&api.User{Username: username}, nil)
+	req := s.newRequest(method, url, false)
+	req.Header.Set("Authorization", token)
+	return req
+}
+
+// makePrivate makes the fixture file private and shared with the grantee.
+func (s *FilesApiTestSuite) makePrivate(grantee string) {
+	s.FileMetadataFixture.Visibility = base.VisibilityPrivate
+	s.FileMetadataFixture.SharedWith = []string{grantee}
+}
+
+func (s *FilesApiTestSuite) uploadWithVisibility(visibility string) string {
+	var stored string
+	s.mockAddFile()
+	s.MetadataServiceMock.On("AddFileMetadata", mock.MatchedBy(
+		func(fileMetadata *api.FileMetadata) bool {
+			stored = fileMetadata.Visibility
+			return true
+		},
+	)).Return(&api.AddFileResponse{Identifier: "identifier"}, nil)
+
+	recorder := s.serve(s.newUploadRequest(map[string]string{
+		base.VisibilityFormField: visibility,
+	}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	return stored
+}
+
+func (s *FilesApiTestSuite) TestApiUploadPrivateFile() {
+	assert.Equal(s.T(), base.VisibilityPrivate, s.uploadWithVisibility("private"))
+}
+
+func (s *FilesApiTestSuite) TestApiUploadAuthenticatedFile() {
+	assert.Equal(
+		s.T(), base.VisibilityAuthenticated, s.uploadWithVisibility("authenticated"),
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiUploadPublicFile() {
+	assert.Empty(s.T(), s.uploadWithVisibility("public"))
+}
+
+func (s *FilesApiTestSuite) TestApiUploadFileInvalidVisibility() {
+	recorder := s.serve(s.newUploadRequest(map[string]string{
+		base.VisibilityFormField: "friends",
+	}, []byte("data")))
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPrivateFileAnonymously() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.makePrivate("grantee")
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPrivateFileOfAnotherUser() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.makePrivate("grantee")
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+
+	recorder := s.serve(s.newRequestAs("GET", "/files/"+fileId, "stranger"))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	assert.Contains(s.T(), recorder.Body.String(), "not found")
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPrivateFileWithForgedSignature() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.makePrivate("grantee")
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+
+	recorder := s.serve(s.newRequest(
+		"GET", "/files/"+fileId+"?expires=4102444800&signature=forged", false,
+	))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadAuthenticatedFileAnonymously() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.Visibility = base.VisibilityAuthenticated
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusUnauthorized, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadAuthenticatedFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.Visibility = base.VisibilityAuthenticated
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequestAs("GET", "/files/"+fileId, "stranger"))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPrivateFilePresigned() {
+	s.makePrivate("grantee")
+	presignedUrl := s.presign("")
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", presignedUrl, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPrivateFileByGrantee() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.makePrivate("grantee")
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequestAs("GET", "/files/"+fileId, "grantee"))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPrivateFileByOwner() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.makePrivate("grantee")
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, true))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPrivateFileInvalidToken() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.makePrivate("grantee")
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+	s.AuthServiceMock.On("ParseToken", "invalid_token").Return(
+		nil, base.ServiceError{Summary: "Invalid token", Status: http.StatusUnauthorized},
+	)
+
+	req := s.newRequest("GET", "/files/"+fileId, false)
+	req.Header.Set("Authorization", "invalid_token")
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadSharedFileOwnerOnly() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.Config.Presign.OwnerOnly = true
+	s.FileMetadataFixture.SharedWith = []string{"grantee"}
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequestAs("GET", "/files/"+fileId, "grantee"))
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+
+	recorder = s.serve(s.newRequestAs("GET", "/files/"+fileId, "stranger"))
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) mockOwnedFile() {
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", s.FileMetadataFixture.Identifier, s.UserFixture.Username,
+	).Return(s.FileMetadataFixture, nil)
+}
+
+func (s *FilesApiTestSuite) TestApiShareFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockOwnedFile()
+	s.UserServiceMock.On("GetUserByUsername", "grantee").Return(
+		&api.User{Username: "grantee"}, nil,
+	)
+	s.MetadataServiceMock.On("ShareFile", fileId, "grantee").Return(nil)
+
+	recorder := s.serve(s.newRequest("PUT", "/files/"+fileId+"/grants/grantee", true))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiShareFilePreflight() {
+	fileId := s.FileMetadataFixture.Identifier
+	req := s.newRequest("OPTIONS", "/files/"+fileId+"/grants/grantee", false)
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	assert.Contains(
+		s.T(), recorder.Header().Get("Access-Control-Allow-Methods"), "PUT",
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiShareFileWithOwner() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockOwnedFile()
+
+	recorder := s.serve(s.newRequest(
+		"PUT", "/files/"+fileId+"/grants/"+s.UserFixture.Username, true,
+	))
+
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "ShareFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiShareFileWithUnknownUser() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockOwnedFile()
+	s.UserServiceMock.On("GetUserByUsername", "unknown").Return(nil, base.ServiceError{
+		Summary: "User 'unknown' not found",
+		Status:  http.StatusNotFound,
+	})
+
+	recorder := s.serve(s.newRequest("PUT", "/files/"+fileId+"/grants/unknown", true))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "ShareFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiShareFileOfAnotherUser() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(nil, base.NewFileAccessDeniedError(fileId))
+
+	recorder := s.serve(s.newRequest("PUT", "/files/"+fileId+"/grants/grantee", true))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiUnshareFile() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.FileMetadataFixture.SharedWith = []string{"grantee"}
+	s.mockOwnedFile()
+	s.MetadataServiceMock.On("UnshareFile", fileId, "grantee").Return(nil)
+
+	recorder := s.serve(s.newRequest("DELETE", "/files/"+fileId+"/grants/grantee", true))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiUnshareFileNotShared() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockOwnedFile()
+
+	recorder := s.serve(s.newRequest("DELETE", "/files/"+fileId+"/grants/grantee", true))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "UnshareFile", mock.Anything, mock.Anything)
+}
+
+func (s *FilesApiTestSuite) TestApiGetSharedFileMetadataList() {
+	s.FileMetadataFixture.Username = "owner"
+	s.FileMetadataFixture.SharedWith = []string{s.UserFixture.Username, "another"}
+	s.MetadataServiceMock.On(
+		"GetSharedFileMetadataList", mock.Anything, s.UserFixture.Username,
+	).Return(&api.FileMetadataListResponse{
+		Records: []*api.FileMetadata{s.FileMetadataFixture},
+	}, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/shared", true))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	var response api.FileMetadataListResponse
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Len(s.T(), response.Records, 1)
+	assert.Equal(s.T(), "owner", response.Records[0].Username)
+	assert.Empty(s.T(), response.Records[0].SharedWith)
+	assert.NotContains(s.T(), recorder.Body.String(), "another")
+}
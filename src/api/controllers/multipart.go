@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"stealthy-backend/base"
+)
+
+// sizeLimitedReader counts bytes read from the underlying reader and
+// fails once more than Limit bytes were read.
+type sizeLimitedReader struct {
+	Reader    io.Reader
+	Limit     int64
+	BytesRead int64
+}
+
+func (reader *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	reader.BytesRead += int64(n)
+	if reader.Exceeded() {
+		return n, fmt.Errorf("content exceeds %d bytes", reader.Limit)
+	}
+	return n, err
+}
+
+func (reader *sizeLimitedReader) Exceeded() bool {
+	return reader.BytesRead > reader.Limit
+}
+
+type uploadForm struct {
+	Values   url.Values
+	FilePart *multipart.Part
+}
+
+// readUploadForm reads form fields until the first file part is reached.
+// Form fields sent after the file part are not read, so clients have to
+// send them first.
+func readUploadForm(reader *multipart.Reader) (*uploadForm, error) {
+	form := &uploadForm{Values: url.Values{}}
+	var formBytes int64
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("form field '%s' required", base.FileFormField)
+		} else if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == base.FileFormField && part.FileName() != "" {
+			form.FilePart = part
+			return form, nil
+		}
+
+		value, err := io.ReadAll(io.LimitReader(
+			part, base.MaxFormFieldsBytes-formBytes+1,
+		))
+		if err != nil {
+			return nil, err
+		}
+		formBytes += int64(len(value))
+		if formBytes > base.MaxFormFieldsBytes {
+			return nil, fmt.Errorf(
+				"form fields exceed %d bytes", base.MaxFormFieldsBytes,
+			)
+		}
+		form.Values.Add(part.FormName(), string(value))
+	}
+}
+
+// nextFilePart skips form fields until the next file part, nil is returned
+// once the form is read.
+func nextFilePart(reader *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if part.FormName() == base.FileFormField && part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"net/url"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const presignPathSuffix string = "/presign"
+
+// ipAllowed tells if the client address matches allowed address or network
+// in CIDR notation.
+func ipAllowed(allowed string, client string) bool {
+	clientIP := net.ParseIP(client)
+	if clientIP == nil {
+		return false
+	}
+	if strings.Contains(allowed, "/") {
+		_, network, err := net.ParseCIDR(allowed)
+		return err == nil && network.Contains(clientIP)
+	}
+	return clientIP.Equal(net.ParseIP(allowed))
+}
+
+// requestedBytes returns number of content bytes the request asks for.
+// Files with download limit are always sent whole, as are files requested
+// with ranges which can not be parsed.
+func requestedBytes(request *http.Request, fileMetadata *api.FileMetadata) int64 {
+	size := fileMetadata.Size
+	header := request.Header.Get("Range")
+	if fileMetadata.MaxDownloads > 0 || !strings.HasPrefix(header, "bytes=") {
+		return size
+	}
+
+	var total int64
+	for _, spec := range strings.Split(strings.TrimPrefix(header, "bytes="), ",") {
+		start, end, found := strings.Cut(strings.TrimSpace(spec), "-")
+		if !found {
+			return size
+		}
+		if start == "" {
+			suffix, err := strconv.ParseInt(end, 10, 64)
+			if err != nil {
+				return size
+			}
+			total += min(suffix, size)
+			continue
+		}
+		first, err := strconv.ParseInt(start, 10, 64)
+		if err != nil {
+			return size
+		}
+		last := size - 1
+		if end != "" {
+			if last, err = strconv.ParseInt(end, 10, 64); err != nil {
+				return size
+			}
+			last = min(last, size-1)
+		}
+		if last >= first {
+			total += last - first + 1
+		}
+	}
+	return total
+}
+
+// parsePresignParams reads constraints of presigned URL from its query.
+func parsePresignParams(query url.Values, fileId string) (*api.PresignParams, error) {
+	params := api.PresignParams{
+		FileIdentifier: fileId,
+		IP:             query.Get(base.IPQueryParam),
+	}
+	expires, err := strconv.ParseInt(query.Get(base.ExpiresQueryParam), 10, 64)
+	if err != nil {
+		return nil, base.NewPresignedUrlInvalidError(
+			"Query parameter '" + base.ExpiresQueryParam + "' is not valid",
+		)
+	}
+	params.Expires = expires
+	if maxBytes := query.Get(base.MaxBytesQueryParam); maxBytes != "" {
+		params.MaxBytes, err = strconv.ParseInt(maxBytes, 10, 64)
+		if err != nil || params.MaxBytes <= 0 {
+			return nil, base.NewPresignedUrlInvalidError(
+				"Query parameter '" + base.MaxBytesQueryParam + "' is not valid",
+			)
+		}
+	}
+	return &params, nil
+}
+
+// checkPresignedUrl verifies signature and constraints of presigned URL.
+// Returns false for plain URLs.
+func (controller FilesController) checkPresignedUrl(
+	c *gin.Context,
+	fileMetadata *api.FileMetadata,
+) (bool, error) {
+	query := c.Request.URL.Query()
+	signature := query.Get(base.SignatureQueryParam)
+	if signature == "" {
+		return false, nil
+	}
+	if !controller.Presign.Enabled() {
+		return false, base.NewPresignedUrlDisabledError()
+	}
+
+	params, err := parsePresignParams(query, fileMetadata.Identifier)
+	if err != nil {
+		return false, err
+	}
+	if !controller.Signer.Verify(params, signature) {
+		return false, base.NewPresignedUrlInvalidError("Signature does not match")
+	}
+	if params.Expires <= time.Now().Unix() {
+		return false, base.NewPresignedUrlExpiredError()
+	}
+	if params.IP != "" && !ipAllowed(params.IP, c.ClientIP()) {
+		return false, base.NewPresignedUrlInvalidError("Client address is not allowed")
+	}
+	if params.MaxBytes > 0 && requestedBytes(c.Request, fileMetadata) > params.MaxBytes {
+		return false, base.NewPresignedUrlMaxBytesError(params.MaxBytes)
+	}
+	return true, nil
+}
+
+// PresignFile Presign file download URL
+// @Summary      Presign file download URL
+// @Description  This method returns short-lived download URL of a file of
+// @Description  authorized user, signed by the server. The URL can be
+// @Description  limited to client address or network and to number of
+// @Description  requested bytes. It is verified without stored state, so
+// @Description  it can not be revoked before expiration. Password of the
+// @Description  file is not asked with presigned URL. URL is relative to
+// @Description  the server origin. Presigned URLs are disabled if the
+// @Description  server has no presign secret key
+// @Tags         Files
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 request body api.PresignRequest false "URL constraints"
+// @Success      200  {object}  api.PresignResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/presign [post]
+func (controller FilesController) PresignFile(c *gin.Context) {
+	base.Logger.Info("Requested presigned file URL")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+	if !controller.Presign.Enabled() {
+		c.Error(base.NewPresignedUrlDisabledError())
+		return
+	}
+
+	fileId := c.Param(base.FileIdPathParam)
+	if fileId == "" {
+		c.Error(base.NewPathParamRequiredError(base.FileIdPathParam))
+		return
+	}
+	fileMetadata, err := controller.FilesMetadataService.GetFileMetadataByOwner(
+		fileId, auth.Username,
+	)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var request api.PresignRequest
+	if c.Request.ContentLength != 0 {
+		if err = bindJSONRequest(c, controller.SchemaValidator, &request); err != nil {
+			return
+		}
+	}
+
+	expires := time.Now().Add(controller.Presign.Lifetime(request.LifetimeSeconds)).Unix()
+	params := api.PresignParams{
+		FileIdentifier: fileId,
+		Expires:        min(expires, fileMetadata.Expiration),
+		IP:             request.IP,
+		MaxBytes:       request.MaxBytes,
+	}
+	query := url.Values{}
+	query.Set(base.ExpiresQueryParam, strconv.FormatInt(params.Expires, 10))
+	if params.IP != "" {
+		query.Set(base.IPQueryParam, params.IP)
+	}
+	if params.MaxBytes > 0 {
+		query.Set(base.MaxBytesQueryParam, strconv.FormatInt(params.MaxBytes, 10))
+	}
+	query.Set(base.SignatureQueryParam, controller.Signer.Sign(&params))
+
+	downloadPath := strings.TrimSuffix(c.Request.URL.Path, presignPathSuffix)
+	c.IndentedJSON(http.StatusOK, &api.PresignResponse{
+		URL:     downloadPath + "?" + query.Encode(),
+		Expires: params.Expires,
+	})
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"net/http"
+	"net/url"
+	"stealthy-backend/api"
+	"stealthy-backend/api/services"
+	"stealthy-backend/base"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIpAllowed(t *testing.T) {
+	assert.True(t, ipAllowed("203.0.113.5", "203.0.113.5"))
+	assert.True(t, ipAllowed("203.0.113.0/24", "203.0.113.5"))
+	assert.True(t, ipAllowed("2001:db8::/32", "2001:db8::1"))
+	assert.False(t, ipAllowed("203.0.113.5", "203.0.113.6"))
+	assert.False(t, ipAllowed("203.0.113.0/24", "198.51.100.1"))
+	assert.False(t, ipAllowed("203.0.113.5", ""))
+}
+
+func TestRequestedBytes(t *testing.T) {
+	fileMetadata := &api.FileMetadata{Size: 100}
+	for header, expected := range map[string]int64{
+		"":                100,
+		"bytes=0-9":       10,
+		"bytes=90-":       10,
+		"bytes=-20":       20,
+		"bytes=-200":      100,
+		"bytes=0-9, 20-":  90,
+		"bytes=95-200":    5,
+		"bytes=x-9":       100,
+		"items=0-9":       100,
+		"bytes=50-40":     0,
+		"bytes=0-9,-5,5-": 110,
+	} {
+		request := &http.Request{Header: http.Header{}}
+		request.Header.Set("Range", header)
+		assert.Equal(t, expected, requestedBytes(request, fileMetadata), header)
+	}
+
+	request := &http.Request{Header: http.Header{"Range": {"bytes=0-9"}}}
+	limited := &api.FileMetadata{Size: 100, MaxDownloads: 1}
+	assert.Equal(t, int64(100), requestedBytes(request, limited))
+}
+
+// presign requests presigned URL of the fixture file and returns its path
+// relative to the API version.
+func (s *FilesApiTestSuite) presign(body string) string {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(s.FileMetadataFixture, nil).Maybe()
+	req := s.newRequest("POST", "/files/"+fileId+"/presign", true)
+	req.Body = io.NopCloser(strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	var response api.PresignResponse
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	return strings.TrimPrefix(response.URL, s.Config.Server.BasePath+"/v1")
+}
+
+func (s *FilesApiTestSuite) TestApiPresignFile() {
+	before := time.Now().Unix()
+
+	presignedUrl := s.presign(`{"lifetime_seconds": 60, "max_bytes": 2}`)
+
+	parsed, err := url.Parse(presignedUrl)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "/files/"+s.FileMetadataFixture.Identifier, parsed.Path)
+	expires, err := strconv.ParseInt(parsed.Query().Get(base.ExpiresQueryParam), 10, 64)
+	assert.NoError(s.T(), err)
+	assert.InDelta(s.T(), before+60, expires, 1)
+	assert.Equal(s.T(), "2", parsed.Query().Get(base.MaxBytesQueryParam))
+	assert.False(s.T(), parsed.Query().Has(base.IPQueryParam))
+	assert.NotEmpty(s.T(), parsed.Query().Get(base.SignatureQueryParam))
+}
+
+func (s *FilesApiTestSuite) TestApiPresignFileLifetimeLimited() {
+	s.FileMetadataFixture.Expiration = time.Now().Add(48 * time.Hour).Unix()
+
+	presignedUrl := s.presign(`{"lifetime_seconds": 1000000}`)
+
+	parsed, err := url.Parse(presignedUrl)
+	assert.NoError(s.T(), err)
+	expires, err := strconv.ParseInt(parsed.Query().Get(base.ExpiresQueryParam), 10, 64)
+	assert.NoError(s.T(), err)
+	assert.InDelta(s.T(), time.Now().Unix()+s.Config.Presign.SecondsLifetimeMax, expires, 1)
+}
+
+func (s *FilesApiTestSuite) TestApiPresignFileInvalidAddress() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(s.FileMetadataFixture, nil)
+	body := `{"ip": "not an address"}`
+	req := s.newRequest("POST", "/files/"+fileId+"/presign", true)
+	req.Body = io.NopCloser(strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiPresignFileOfAnotherUser() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(nil, base.NewFileAccessDeniedError(fileId))
+
+	recorder := s.serve(s.newRequest("POST", "/files/"+fileId+"/presign", true))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiPresignFileDisabled() {
+	s.Config.Presign.SecretKey = ""
+
+	recorder := s.serve(s.newRequest(
+		"POST", "/files/"+s.FileMetadataFixture.Identifier+"/presign", true,
+	))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(
+		s.T(), "GetFileMetadataByOwner", mock.Anything, mock.Anything,
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPresignedFileDisabled() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.Config.Presign.SecretKey = ""
+	params := api.PresignParams{FileIdentifier: fileId, Expires: time.Now().Unix() + 60}
+	query := url.Values{
+		base.ExpiresQueryParam:   {strconv.FormatInt(params.Expires, 10)},
+		base.SignatureQueryParam: {services.URLSigner{}.Sign(&params)},
+	}
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId+"?"+query.Encode(), false))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPresignedFileWithoutPassword() {
+	s.protectWithPassword("p@ssw0rd")
+	s.Config.Presign.OwnerOnly = true
+	presignedUrl := s.presign("")
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", presignedUrl, false))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), s.FileDataFixture.Data, recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPresignedFileTampered() {
+	presignedUrl := s.presign(`{"max_bytes": 2}`)
+	s.MetadataServiceMock.On("GetFileMetadata", s.FileMetadataFixture.Identifier).Return(
+		s.FileMetadataFixture, nil,
+	)
+
+	tampered := strings.Replace(presignedUrl, "max-bytes=2", "max-bytes=4", 1)
+	recorder := s.serve(s.newRequest("GET", tampered, false))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(
+		s.T(), "RegisterFileDownload", s.FileMetadataFixture.Identifier,
+	)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPresignedFileExpired() {
+	fileId := s.FileMetadataFixture.Identifier
+	params := api.PresignParams{FileIdentifier: fileId, Expires: time.Now().Unix() - 1}
+	signer := services.URLSigner{Key: []byte(s.Config.Presign.SecretKey)}
+	query := url.Values{
+		base.ExpiresQueryParam:   {strconv.FormatInt(params.Expires, 10)},
+		base.SignatureQueryParam: {signer.Sign(&params)},
+	}
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId+"?"+query.Encode(), false))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPresignedFileFromAllowedAddress() {
+	presignedUrl := s.presign(`{"ip": "203.0.113.0/24"}`)
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	req := s.newRequest("GET", presignedUrl, false)
+	req.RemoteAddr = "198.51.100.1:40000"
+	recorder := s.serve(req)
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+
+	req = s.newRequest("GET", presignedUrl, false)
+	req.RemoteAddr = "203.0.113.7:40000"
+	recorder = s.serve(req)
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPresignedFileMaxBytes() {
+	presignedUrl := s.presign(`{"max_bytes": 2}`)
+	s.mockDownloadableFile()
+	s.mockFileContent()
+
+	recorder := s.serve(s.newRequest("GET", presignedUrl, false))
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+
+	req := s.newRequest("GET", presignedUrl, false)
+	req.Header.Set("Range", "bytes=1-2")
+	recorder = s.serve(req)
+	assert.Equal(s.T(), http.StatusPartialContent, recorder.Code)
+	assert.Equal(s.T(), []byte("at"), recorder.Body.Bytes())
+}
+
+func (s *FilesApiTestSuite) TestApiDownloadPlainUrlOwnerOnly() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.Config.Presign.OwnerOnly = true
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+
+	recorder := s.serve(s.newRequest("GET", "/files/"+fileId, false))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", fileId)
+}
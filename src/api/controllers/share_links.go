@@ -0,0 +1,450 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"stealthy-backend/api"
+	"stealthy-backend/api/services"
+	"stealthy-backend/base"
+	"time"
+)
+
+type ShareLinksController struct {
+	Files FilesController
+}
+
+// getOwnedFile returns metadata of the requested file if it belongs to
+// the user.
+func (controller ShareLinksController) getOwnedFile(
+	c *gin.Context,
+	auth *api.User,
+) (*api.FileMetadata, error) {
+	fileId := c.Param(base.FileIdPathParam)
+	if fileId == "" {
+		return nil, base.NewPathParamRequiredError(base.FileIdPathParam)
+	}
+	return controller.Files.FilesMetadataService.GetFileMetadataByOwner(
+		fileId, auth.Username,
+	)
+}
+
+// getOwnedFileId returns ID of the requested file if it belongs to the user.
+func (controller ShareLinksController) getOwnedFileId(
+	c *gin.Context,
+	auth *api.User,
+) (string, error) {
+	fileMetadata, err := controller.getOwnedFile(c, auth)
+	if err != nil {
+		return "", err
+	}
+	return fileMetadata.Identifier, nil
+}
+
+// getFileShareLink returns the requested link, links of other files are
+// not found.
+func (controller ShareLinksController) getFileShareLink(
+	c *gin.Context,
+	fileId string,
+) (*api.ShareLink, error) {
+	token := c.Param(base.ShareTokenPathParam)
+	if token == "" {
+		return nil, base.NewPathParamRequiredError(base.ShareTokenPathParam)
+	}
+	link, err := controller.Files.ShareLinksService.GetShareLink(token)
+	if err != nil {
+		return nil, err
+	}
+	if link.FileIdentifier != fileId {
+		return nil, base.NewShareLinkNotFoundError(token)
+	}
+	return link, nil
+}
+
+// applyShareLinkRequest sets properties which were sent in the request.
+// Expiration has to be in the future, links do not outlive the file, so
+// later expiration is cut to expiration of the file.
+func applyShareLinkRequest(
+	request *api.ShareLinkRequest,
+	link *api.ShareLink,
+	fileMetadata *api.FileMetadata,
+) error {
+	if request.Enabled != nil {
+		link.Enabled = *request.Enabled
+	}
+	if request.ExpiresAt != nil {
+		expiration := *request.ExpiresAt
+		if expiration != 0 && expiration <= time.Now().Unix() {
+			return base.NewShareLinkExpirationError()
+		} else if expiration != 0 {
+			expiration = min(expiration, fileMetadata.Expiration)
+		}
+		link.Expiration = expiration
+	}
+	if request.MaxDownloads != nil {
+		link.MaxDownloads = *request.MaxDownloads
+	}
+	if request.Password == nil {
+		return nil
+	}
+	if *request.Password == "" {
+		link.PasswordProtected = false
+		link.PasswordHash = ""
+		return nil
+	}
+	hash, err := services.GeneratePasswordHash(*request.Password)
+	if err != nil {
+		return base.ServiceError{
+			Summary: "Password processing error",
+			Detail:  err.Error(),
+		}
+	}
+	link.PasswordProtected = true
+	link.PasswordHash = string(hash)
+	return nil
+}
+
+// CreateShareLink Create share link
+// @Summary      Create share link
+// @Description  This method creates a new link to a file of authorized
+// @Description  user. The link has its own random token and optional
+// @Description  expiration, download limit and password. Links are
+// @Description  enabled unless stated otherwise, body may be omitted
+// @Tags         Share links
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 request body api.ShareLinkRequest false "Link properties"
+// @Success      201  {object}  api.ShareLink
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/links [post]
+func (controller ShareLinksController) CreateShareLink(c *gin.Context) {
+	base.Logger.Info("Requested creating share link")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+	fileMetadata, err := controller.getOwnedFile(c, auth)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var request api.ShareLinkRequest
+	if c.Request.ContentLength != 0 {
+		err = bindJSONRequest(c, controller.Files.SchemaValidator, &request)
+		if err != nil {
+			return
+		}
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		c.Error(base.ServiceError{
+			Summary: "Token generation error",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	link := api.ShareLink{
+		Token:          token,
+		FileIdentifier: fileMetadata.Identifier,
+		Username:       auth.Username,
+		Enabled:        true,
+		Creation:       time.Now().Unix(),
+	}
+	if err = applyShareLinkRequest(&request, &link, fileMetadata); err != nil {
+		c.Error(err)
+		return
+	}
+	if err = controller.Files.ShareLinksService.AddShareLink(&link); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, &link)
+}
+
+// GetShareLinks Get share links
+// @Summary      Get share links
+// @Description  This method lists links to a file of authorized user
+// @Description  from the newest one
+// @Tags         Share links
+// @Security     User
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Success      200  {object}  api.ShareLinkListResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/links [get]
+func (controller ShareLinksController) GetShareLinks(c *gin.Context) {
+	base.Logger.Info("Requested share links")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+	fileId, err := controller.getOwnedFileId(c, auth)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	links, err := controller.Files.ShareLinksService.GetFileShareLinks(fileId)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	response := api.ShareLinkListResponse{
+		Records: make([]*api.ShareLink, len(links)),
+	}
+	for i := range links {
+		response.Records[i] = &links[i]
+	}
+	c.IndentedJSON(http.StatusOK, &response)
+}
+
+// GetShareLink Get share link
+// @Summary      Get share link
+// @Description  This method returns a link to a file of authorized user
+// @Tags         Share links
+// @Security     User
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 token path string true "Link token" example(Zk9xM2lTR0VfX3l2T3NhQmR6b0RwZzFx)
+// @Success      200  {object}  api.ShareLink
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/links/{token} [get]
+func (controller ShareLinksController) GetShareLink(c *gin.Context) {
+	base.Logger.Info("Requested share link")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+	fileId, err := controller.getOwnedFileId(c, auth)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	link, err := controller.getFileShareLink(c, fileId)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, link)
+}
+
+// UpdateShareLink Update share link
+// @Summary      Update share link
+// @Description  This method changes properties of a link to a file of
+// @Description  authorized user. Properties which are not sent are kept,
+// @Description  zero expiration or download limit and empty password
+// @Description  remove the limit. Download counter is kept
+// @Tags         Share links
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 token path string true "Link token" example(Zk9xM2lTR0VfX3l2T3NhQmR6b0RwZzFx)
+// @Param 		 request body api.ShareLinkRequest true "Changed link properties"
+// @Success      200  {object}  api.ShareLink
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/links/{token} [patch]
+func (controller ShareLinksController) UpdateShareLink(c *gin.Context) {
+	base.Logger.Info("Requested share link update")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+	fileMetadata, err := controller.getOwnedFile(c, auth)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	link, err := controller.getFileShareLink(c, fileMetadata.Identifier)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var request api.ShareLinkRequest
+	if err = bindJSONRequest(c, controller.Files.SchemaValidator, &request); err != nil {
+		return
+	}
+	if err = applyShareLinkRequest(&request, link, fileMetadata); err != nil {
+		c.Error(err)
+		return
+	}
+	if err = controller.Files.ShareLinksService.UpdateShareLink(link); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, link)
+}
+
+// DeleteShareLink Delete share link
+// @Summary      Delete share link
+// @Description  This method revokes a link to a file of authorized user,
+// @Description  the file and its other links are kept
+// @Tags         Share links
+// @Security     User
+// @Produce      json
+// @Param 		 identifier path string true "File ID" example(YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm)
+// @Param 		 token path string true "Link token" example(Zk9xM2lTR0VfX3l2T3NhQmR6b0RwZzFx)
+// @Success      204
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/files/{identifier}/links/{token} [delete]
+func (controller ShareLinksController) DeleteShareLink(c *gin.Context) {
+	base.Logger.Info("Requested share link deletion")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+	fileId, err := controller.getOwnedFileId(c, auth)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	link, err := controller.getFileShareLink(c, fileId)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err = controller.Files.ShareLinksService.DeleteShareLink(link.Token); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getSharedFile returns metadata of the linked file. Errors of missing
+// files refer to the link, so the file ID is not disclosed.
+func (controller ShareLinksController) getSharedFile(
+	link *api.ShareLink,
+) (*api.FileMetadata, error) {
+	fileMetadata, err := controller.Files.FilesMetadataService.GetFileMetadata(
+		link.FileIdentifier,
+	)
+	var serviceErr base.ServiceError
+	if errors.As(err, &serviceErr) && serviceErr.Status == http.StatusNotFound {
+		return nil, base.NewShareLinkNotFoundError(link.Token)
+	} else if errors.As(err, &serviceErr) && serviceErr.Status == http.StatusGone {
+		return nil, base.NewShareLinkExpiredError(link.Token)
+	} else if err != nil {
+		return nil, err
+	}
+	return fileMetadata, nil
+}
+
+// checkSharePassword verifies password of the link, or password of the
+// file if the link has none. Failed attempts are limited per link.
+func (controller ShareLinksController) checkSharePassword(
+	c *gin.Context,
+	link *api.ShareLink,
+	fileMetadata *api.FileMetadata,
+) error {
+	if link.PasswordProtected {
+		return controller.Files.checkPassword(c, link.Token, link.PasswordHash)
+	}
+	if fileMetadata.PasswordProtected {
+		return controller.Files.checkPassword(c, link.Token, fileMetadata.PasswordHash)
+	}
+	return nil
+}
+
+// DownloadSharedFile Download shared file
+// @Summary      Download shared file
+// @Description  This method downloads a file with a share link. Password
+// @Description  of the link, or of the file if the link has none, is sent
+// @Description  in header or with POST form. Every download is counted
+// @Description  for the link and for the file, attempts are recorded in
+// @Description  access log of the file with the link token. Content is
+// @Description  served as with file download
+// @Tags         Share links
+// @Produce      multipart/form-data
+// @Param 		 token path string true "Link token" example(Zk9xM2lTR0VfX3l2T3NhQmR6b0RwZzFx)
+// @Param 		 X-File-Password header string false "Password of protected link or file"
+// @Param 		 Range header string false "Requested byte ranges" example(bytes=0-1023)
+// @Param 		 If-None-Match header string false "Entity tag of cached file"
+// @Success      200
+// @Success      206
+// @Success      304
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      401  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      429  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/s/{token} [get]
+// @Router       /v1/s/{token} [post]
+func (controller ShareLinksController) DownloadSharedFile(c *gin.Context) {
+	base.Logger.Info("Requested shared file download")
+
+	token := c.Param(base.ShareTokenPathParam)
+	if token == "" {
+		c.Error(base.NewPathParamRequiredError(base.ShareTokenPathParam))
+		return
+	}
+
+	link, err := controller.Files.ShareLinksService.GetShareLink(token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer controller.Files.recordFileAccess(c, link.FileIdentifier, link.Username, token)
+	if err = services.CheckShareLink(link); err != nil {
+		c.Error(err)
+		return
+	}
+	fileMetadata, err := controller.getSharedFile(link)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if err = controller.Files.checkScanStatus(fileMetadata); err != nil {
+		c.Error(err)
+		return
+	}
+	if err = controller.checkSharePassword(c, link, fileMetadata); err != nil {
+		c.Error(err)
+		return
+	}
+
+	setCacheValidators(c, fileMetadata)
+	if isNotModified(c.Request, fileMetadata) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	controller.Files.sendFile(c, fileMetadata, link)
+}
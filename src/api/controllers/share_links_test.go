@@ -0,0 +1,529 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stealthy-backend/api"
+	"stealthy-backend/api/services"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupShareLinksRouter(
+	config *base.BackendConfig,
+	filesController FilesController,
+	authServiceMock *tests.BaseAuthorizationService,
+) *gin.Engine {
+	authController := AuthorizationController{AuthService: authServiceMock}
+	shareLinksController := ShareLinksController{Files: filesController}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.NoRoute(api.NoRouteHandler)
+	router.NoMethod(api.NoMethodHandler)
+	router.Use(api.LogsHandler)
+	router.Use(api.ErrorHandler)
+	router.Use(api.CORSHandler)
+
+	applicationGroup := router.Group(config.Server.BasePath)
+	v1 := applicationGroup.Group("/v1")
+
+	withAuthFilesGroup := v1.Group("/files").Use(authController.Authorize)
+	withAuthFilesGroup.POST(
+		fmt.Sprintf("/:%s/links", base.FileIdPathParam),
+		shareLinksController.CreateShareLink,
+	)
+	withAuthFilesGroup.GET(
+		fmt.Sprintf("/:%s/links", base.FileIdPathParam),
+		shareLinksController.GetShareLinks,
+	)
+	withAuthFilesGroup.GET(
+		fmt.Sprintf("/:%s/links/:%s", base.FileIdPathParam, base.ShareTokenPathParam),
+		shareLinksController.GetShareLink,
+	)
+	withAuthFilesGroup.PATCH(
+		fmt.Sprintf("/:%s/links/:%s", base.FileIdPathParam, base.ShareTokenPathParam),
+		shareLinksController.UpdateShareLink,
+	)
+	withAuthFilesGroup.DELETE(
+		fmt.Sprintf("/:%s/links/:%s", base.FileIdPathParam, base.ShareTokenPathParam),
+		shareLinksController.DeleteShareLink,
+	)
+
+	sharedGroup := v1.Group("/s")
+	sharedGroup.GET(
+		fmt.Sprintf("/:%s", base.ShareTokenPathParam),
+		shareLinksController.DownloadSharedFile,
+	)
+
+	return router
+}
+
+type ShareLinksApiTestSuite struct {
+	suite.Suite
+	Config              *base.BackendConfig
+	AuthToken           string
+	UserFixture         *api.User
+	FileMetadataFixture *api.FileMetadata
+	LinkFixture         *api.ShareLink
+	FilesServiceMock    *tests.BaseFilesService
+	MetadataServiceMock *tests.BaseFilesMetadataService
+	ShareLinksMock      *tests.BaseShareLinksService
+	AccessLogMock       *tests.BaseFileAccessLogService
+	AuthServiceMock     *tests.BaseAuthorizationService
+	Router              *gin.Engine
+}
+
+func (s *ShareLinksApiTestSuite) SetupTest() {
+	s.Config = &base.BackendConfig{}
+	s.Config.SetDefaults()
+	s.Config.Logs.AppName = "sharing-backend-test"
+
+	s.AuthToken = "authorization_token"
+	s.UserFixture = &api.User{Username: "valid_username"}
+	s.FileMetadataFixture = &api.FileMetadata{
+		Identifier: "YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm",
+		Name:       "file.txt",
+		Username:   s.UserFixture.Username,
+		Size:       4,
+		Mimetype:   "text/plain",
+		Creation:   time.Now().Add(-time.Hour).Unix(),
+		Expiration: time.Now().Add(time.Hour).Unix(),
+	}
+	s.LinkFixture = &api.ShareLink{
+		Token:          "Zk9xM2lTR0VfX3l2T3NhQmR6b0RwZzFx",
+		FileIdentifier: s.FileMetadataFixture.Identifier,
+		Username:       s.UserFixture.Username,
+		Enabled:        true,
+		Creation:       time.Now().Add(-time.Minute).Unix(),
+	}
+
+	s.FilesServiceMock = tests.NewBaseFilesService(s.T())
+	s.MetadataServiceMock = tests.NewBaseFilesMetadataService(s.T())
+	s.ShareLinksMock = tests.NewBaseShareLinksService(s.T())
+	s.AccessLogMock = tests.NewBaseFileAccessLogService(s.T())
+	s.AuthServiceMock = tests.NewBaseAuthorizationService(s.T())
+	userServiceMock := tests.NewBaseUserService(s.T())
+	mockUserStorage(userServiceMock, s.UserFixture.Username, &api.UserStorage{})
+	mockShareLinks(s.ShareLinksMock)
+	mockFileAccessLog(s.AccessLogMock, s.MetadataServiceMock)
+	filesController := FilesController{
+		FilesService:         s.FilesServiceMock,
+		FilesMetadataService: s.MetadataServiceMock,
+		ShareLinksService:    s.ShareLinksMock,
+		FileAccessLogService: s.AccessLogMock,
+		UserService:          userServiceMock,
+		Scanning:             &s.Config.Scanning,
+		PasswordLimiter:      services.NewAttemptsLimiter(&s.Config.FilesPassword),
+		SchemaValidator:      base.CreateValidator(),
+	}
+	s.Router = setupShareLinksRouter(s.Config, filesController, s.AuthServiceMock)
+}
+
+func (s *ShareLinksApiTestSuite) serve(req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.Router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// newRequest builds request of the file owner with optional JSON body.
+func (s *ShareLinksApiTestSuite) newRequest(
+	method string,
+	url string,
+	body string,
+) *http.Request {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, getRequestUrl(s.Config, url), reader)
+	assert.NoError(s.T(), err)
+	s.AuthServiceMock.On("ParseToken", s.AuthToken).Return(s.UserFixture, nil).Maybe()
+	req.Header["Authorization"] = []string{s.AuthToken}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+func (s *ShareLinksApiTestSuite) linksUrl() string {
+	return "/files/" + s.FileMetadataFixture.Identifier + "/links"
+}
+
+func (s *ShareLinksApiTestSuite) mockOwnedFile() {
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", s.FileMetadataFixture.Identifier, s.UserFixture.Username,
+	).Return(s.FileMetadataFixture, nil)
+}
+
+func (s *ShareLinksApiTestSuite) mockLink() {
+	s.ShareLinksMock.On("GetShareLink", s.LinkFixture.Token).Return(
+		func(string) (*api.ShareLink, error) { return s.LinkFixture, nil },
+	)
+}
+
+// mockSharedDownload serves the fixture file with the link.
+func (s *ShareLinksApiTestSuite) mockSharedDownload() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockLink()
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+	s.ShareLinksMock.On("RegisterShareLinkDownload", s.LinkFixture.Token).Return(
+		s.LinkFixture, nil,
+	).Maybe()
+	s.MetadataServiceMock.On("RegisterFileDownload", fileId).Return(
+		s.FileMetadataFixture, nil,
+	).Maybe()
+	s.FilesServiceMock.On("OpenFile", mock.Anything).Return(
+		func(*api.FileData) (io.ReadSeekCloser, error) {
+			return services.NopSeekCloser(bytes.NewReader([]byte("data"))), nil
+		},
+	).Maybe()
+}
+
+func (s *ShareLinksApiTestSuite) TestApiCreateShareLink() {
+	s.mockOwnedFile()
+	var added *api.ShareLink
+	s.ShareLinksMock.On("AddShareLink", mock.Anything).Run(func(args mock.Arguments) {
+		added = args.Get(0).(*api.ShareLink)
+	}).Return(nil)
+
+	recorder := s.serve(s.newRequest(
+		"POST", s.linksUrl(), `{"max_downloads": 5, "password": "p@ssw0rd"}`,
+	))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	var response api.ShareLink
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Len(s.T(), response.Token, 32)
+	assert.Equal(s.T(), added.Token, response.Token)
+	assert.Equal(s.T(), s.FileMetadataFixture.Identifier, added.FileIdentifier)
+	assert.Equal(s.T(), s.UserFixture.Username, added.Username)
+	assert.True(s.T(), response.Enabled)
+	assert.True(s.T(), response.PasswordProtected)
+	assert.Equal(s.T(), int64(5), response.MaxDownloads)
+	assert.NoError(s.T(), bcrypt.CompareHashAndPassword(
+		[]byte(added.PasswordHash), []byte("p@ssw0rd"),
+	))
+	assert.NotContains(s.T(), recorder.Body.String(), added.PasswordHash)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiCreateShareLinkWithoutBody() {
+	s.mockOwnedFile()
+	s.ShareLinksMock.On("AddShareLink", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newRequest("POST", s.linksUrl(), ""))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	var response api.ShareLink
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.True(s.T(), response.Enabled)
+	assert.False(s.T(), response.PasswordProtected)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiCreateShareLinksHaveDistinctTokens() {
+	s.mockOwnedFile()
+	tokens := map[string]bool{}
+	s.ShareLinksMock.On("AddShareLink", mock.Anything).Run(func(args mock.Arguments) {
+		tokens[args.Get(0).(*api.ShareLink).Token] = true
+	}).Return(nil)
+
+	s.serve(s.newRequest("POST", s.linksUrl(), ""))
+	s.serve(s.newRequest("POST", s.linksUrl(), ""))
+
+	assert.Len(s.T(), tokens, 2)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiCreateShareLinkInvalidPassword() {
+	s.mockOwnedFile()
+
+	recorder := s.serve(s.newRequest("POST", s.linksUrl(), `{"password": "short"}`))
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+	s.ShareLinksMock.AssertNotCalled(s.T(), "AddShareLink", mock.Anything)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiCreateShareLinkExpired() {
+	s.mockOwnedFile()
+
+	recorder := s.serve(s.newRequest("POST", s.linksUrl(), fmt.Sprintf(
+		`{"expires_at": %d}`, time.Now().Add(-time.Minute).Unix(),
+	)))
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+	s.ShareLinksMock.AssertNotCalled(s.T(), "AddShareLink", mock.Anything)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiCreateShareLinkOutlivingFile() {
+	s.mockOwnedFile()
+	s.ShareLinksMock.On("AddShareLink", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newRequest("POST", s.linksUrl(), fmt.Sprintf(
+		`{"expires_at": %d}`, time.Now().Add(24*time.Hour).Unix(),
+	)))
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	var response api.ShareLink
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(s.T(), s.FileMetadataFixture.Expiration, response.Expiration)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiCreateShareLinkOfAnotherUser() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.MetadataServiceMock.On(
+		"GetFileMetadataByOwner", fileId, s.UserFixture.Username,
+	).Return(nil, base.NewFileAccessDeniedError(fileId))
+
+	recorder := s.serve(s.newRequest("POST", s.linksUrl(), ""))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.ShareLinksMock.AssertNotCalled(s.T(), "AddShareLink", mock.Anything)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiGetShareLinks() {
+	s.mockOwnedFile()
+	second := *s.LinkFixture
+	second.Token = "second"
+	s.ShareLinksMock.On("GetFileShareLinks", s.FileMetadataFixture.Identifier).Return(
+		[]api.ShareLink{second, *s.LinkFixture}, nil,
+	)
+
+	recorder := s.serve(s.newRequest("GET", s.linksUrl(), ""))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	var response api.ShareLinkListResponse
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Len(s.T(), response.Records, 2)
+	assert.Equal(s.T(), "second", response.Records[0].Token)
+	assert.Equal(s.T(), s.LinkFixture.Token, response.Records[1].Token)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiGetShareLinkOfAnotherFile() {
+	s.mockOwnedFile()
+	s.LinkFixture.FileIdentifier = "another"
+	s.mockLink()
+
+	recorder := s.serve(s.newRequest(
+		"GET", s.linksUrl()+"/"+s.LinkFixture.Token, "",
+	))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiUpdateShareLink() {
+	s.mockOwnedFile()
+	s.LinkFixture.PasswordProtected = true
+	s.LinkFixture.PasswordHash = "hash"
+	s.LinkFixture.MaxDownloads = 5
+	s.LinkFixture.DownloadCount = 2
+	s.mockLink()
+	s.ShareLinksMock.On("UpdateShareLink", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newRequest(
+		"PATCH",
+		s.linksUrl()+"/"+s.LinkFixture.Token,
+		`{"enabled": false, "password": ""}`,
+	))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	s.ShareLinksMock.AssertCalled(s.T(), "UpdateShareLink", &api.ShareLink{
+		Token:          s.LinkFixture.Token,
+		FileIdentifier: s.FileMetadataFixture.Identifier,
+		Username:       s.UserFixture.Username,
+		Enabled:        false,
+		Creation:       s.LinkFixture.Creation,
+		MaxDownloads:   5,
+		DownloadCount:  2,
+	})
+}
+
+func (s *ShareLinksApiTestSuite) TestApiUpdateShareLinkExpired() {
+	s.mockOwnedFile()
+	s.mockLink()
+
+	recorder := s.serve(s.newRequest(
+		"PATCH",
+		s.linksUrl()+"/"+s.LinkFixture.Token,
+		fmt.Sprintf(`{"expires_at": %d}`, time.Now().Add(-time.Minute).Unix()),
+	))
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+	s.ShareLinksMock.AssertNotCalled(s.T(), "UpdateShareLink", mock.Anything)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiUpdateShareLinkRemovesExpiration() {
+	s.mockOwnedFile()
+	s.LinkFixture.Expiration = time.Now().Add(time.Minute).Unix()
+	s.mockLink()
+	s.ShareLinksMock.On("UpdateShareLink", mock.Anything).Return(nil)
+
+	recorder := s.serve(s.newRequest(
+		"PATCH", s.linksUrl()+"/"+s.LinkFixture.Token, `{"expires_at": 0}`,
+	))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Zero(s.T(), s.LinkFixture.Expiration)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDeleteShareLink() {
+	s.mockOwnedFile()
+	s.mockLink()
+	s.ShareLinksMock.On("DeleteShareLink", s.LinkFixture.Token).Return(nil)
+
+	recorder := s.serve(s.newRequest(
+		"DELETE", s.linksUrl()+"/"+s.LinkFixture.Token, "",
+	))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFile() {
+	s.mockSharedDownload()
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), "data", recorder.Body.String())
+	s.ShareLinksMock.AssertCalled(s.T(), "RegisterShareLinkDownload", s.LinkFixture.Token)
+	s.MetadataServiceMock.AssertCalled(
+		s.T(), "RegisterFileDownload", s.FileMetadataFixture.Identifier,
+	)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileRangeNotCounted() {
+	s.mockSharedDownload()
+	req := s.newRequest("GET", "/s/"+s.LinkFixture.Token, "")
+	req.Header.Set("Range", "bytes=1-2")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusPartialContent, recorder.Code)
+	assert.Equal(s.T(), "at", recorder.Body.String())
+	s.ShareLinksMock.AssertNotCalled(s.T(), "RegisterShareLinkDownload", mock.Anything)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileLinkLimitServedWhole() {
+	s.LinkFixture.MaxDownloads = 3
+	s.mockSharedDownload()
+	req := s.newRequest("GET", "/s/"+s.LinkFixture.Token, "")
+	req.Header.Set("Range", "bytes=1-2")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), "data", recorder.Body.String())
+	assert.Equal(s.T(), "none", recorder.Header().Get("Accept-Ranges"))
+	s.ShareLinksMock.AssertCalled(s.T(), "RegisterShareLinkDownload", s.LinkFixture.Token)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileContentMissing() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockLink()
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(s.FileMetadataFixture, nil)
+	s.FilesServiceMock.On("OpenFile", mock.Anything).Return(
+		nil, base.NewFileNotFoundError(fileId),
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	s.ShareLinksMock.AssertNotCalled(s.T(), "RegisterShareLinkDownload", mock.Anything)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", mock.Anything)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileDisabledLink() {
+	s.LinkFixture.Enabled = false
+	s.mockLink()
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	s.ShareLinksMock.AssertNotCalled(s.T(), "RegisterShareLinkDownload", mock.Anything)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileExpiredLink() {
+	s.LinkFixture.Expiration = time.Now().Add(-time.Second).Unix()
+	s.mockLink()
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileLinkLimitReached() {
+	s.mockSharedDownload()
+	s.ShareLinksMock.ExpectedCalls = nil
+	s.mockLink()
+	s.ShareLinksMock.On("RegisterShareLinkDownload", s.LinkFixture.Token).Return(
+		nil, base.NewShareLinkDownloadLimitError(s.LinkFixture.Token),
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusGone, recorder.Code)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "RegisterFileDownload", mock.Anything)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileDeleted() {
+	fileId := s.FileMetadataFixture.Identifier
+	s.mockLink()
+	s.MetadataServiceMock.On("GetFileMetadata", fileId).Return(
+		nil, base.NewFileNotFoundError(fileId),
+	)
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	assert.NotContains(s.T(), recorder.Body.String(), fileId)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileLinkPassword() {
+	linkHash, err := services.GeneratePasswordHash("link_p@ss")
+	assert.NoError(s.T(), err)
+	fileHash, err := services.GeneratePasswordHash("p@ssw0rd")
+	assert.NoError(s.T(), err)
+	s.LinkFixture.PasswordProtected = true
+	s.LinkFixture.PasswordHash = string(linkHash)
+	s.FileMetadataFixture.PasswordProtected = true
+	s.FileMetadataFixture.PasswordHash = string(fileHash)
+	s.mockSharedDownload()
+
+	req := s.newRequest("GET", "/s/"+s.LinkFixture.Token, "")
+	req.Header.Set(base.FilePasswordHeader, "p@ssw0rd")
+	recorder := s.serve(req)
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	assert.NotContains(s.T(), recorder.Body.String(), s.FileMetadataFixture.Identifier)
+
+	req = s.newRequest("GET", "/s/"+s.LinkFixture.Token, "")
+	req.Header.Set(base.FilePasswordHeader, "link_p@ss")
+	recorder = s.serve(req)
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+}
+
+func (s *ShareLinksApiTestSuite) TestApiDownloadSharedFileFilePassword() {
+	hash, err := services.GeneratePasswordHash("p@ssw0rd")
+	assert.NoError(s.T(), err)
+	s.FileMetadataFixture.PasswordProtected = true
+	s.FileMetadataFixture.PasswordHash = string(hash)
+	s.mockSharedDownload()
+
+	recorder := s.serve(s.newRequest("GET", "/s/"+s.LinkFixture.Token, ""))
+
+	assert.Equal(s.T(), http.StatusUnauthorized, recorder.Code)
+	s.ShareLinksMock.AssertNotCalled(s.T(), "RegisterShareLinkDownload", mock.Anything)
+}
+
+func TestShareLinksApi(t *testing.T) {
+	suite.Run(t, new(ShareLinksApiTestSuite))
+}
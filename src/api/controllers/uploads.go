@@ -0,0 +1,595 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"stealthy-backend/api"
+	"stealthy-backend/api/services"
+	"stealthy-backend/base"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadsController implements resumable uploads with tus protocol
+// (https://tus.io/protocols/resumable-upload). Finished uploads are
+// stored as regular files.
+type UploadsController struct {
+	Files          FilesController
+	UploadsService services.BaseUploadsService
+	UploadsConfig  *base.UploadsConfig
+}
+
+// interruptedReader ends the content when reading of the underlying reader
+// fails, so content received before a connection loss is kept. The read
+// error is available in Err.
+type interruptedReader struct {
+	Reader io.Reader
+	Err    error
+}
+
+func (reader *interruptedReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		reader.Err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// chunksReader reads stored upload chunks one after another. Only one
+// chunk is open at a time.
+type chunksReader struct {
+	FilesService services.BaseFilesService
+	Chunks       []api.UploadChunk
+	current      io.ReadCloser
+	currentId    string
+}
+
+func (reader *chunksReader) Read(p []byte) (int, error) {
+	for {
+		if reader.current == nil {
+			if len(reader.Chunks) == 0 {
+				return 0, io.EOF
+			}
+			chunk := reader.Chunks[0]
+			reader.Chunks = reader.Chunks[1:]
+			stream, err := reader.FilesService.OpenFile(&api.FileData{
+				Identifier: chunk.Identifier,
+				Encryption: chunk.Encryption,
+			})
+			if err != nil {
+				return 0, err
+			}
+			reader.current, reader.currentId = stream, chunk.Identifier
+		}
+
+		n, err := reader.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			reader.Close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (reader *chunksReader) Close() {
+	if reader.current != nil {
+		services.CloseFileStream(reader.current, reader.currentId)
+		reader.current = nil
+	}
+}
+
+// parseUploadMetadata parses Upload-Metadata header, which consists of
+// comma separated pairs of key and base64 encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+		if _, exists := metadata[key]; exists {
+			return nil, fmt.Errorf("duplicate metadata key '%s'", key)
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("metadata '%s': %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// metadataValues returns upload metadata as values of upload form.
+func metadataValues(metadata map[string]string) url.Values {
+	values := url.Values{}
+	for key, value := range metadata {
+		values.Set(key, value)
+	}
+	return values
+}
+
+func parseUploadHeader(c *gin.Context, header string) (int64, error) {
+	value, err := strconv.ParseInt(c.GetHeader(header), 10, 64)
+	if err != nil {
+		return 0, base.NewHeaderError(header, err)
+	} else if value < 0 {
+		return 0, base.NewHeaderError(header, fmt.Errorf("negative value"))
+	}
+	return value, nil
+}
+
+func setUploadHeaders(c *gin.Context, upload *api.Upload) {
+	c.Header(base.UploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	c.Header(
+		base.UploadExpiresHeader,
+		upload.ExpirationDate.UTC().Format(http.TimeFormat),
+	)
+	if upload.FileIdentifier != "" {
+		c.Header(base.FileIdentifierHeader, upload.FileIdentifier)
+	}
+}
+
+// CheckTusResumable rejects requests of unsupported protocol version.
+func (controller UploadsController) CheckTusResumable(c *gin.Context) {
+	c.Header(base.TusResumableHeader, base.TusVersion)
+	if version := c.GetHeader(base.TusResumableHeader); version != base.TusVersion {
+		c.Header(base.TusVersionHeader, base.TusVersion)
+		c.Error(base.NewTusVersionError(version))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// DescribeUploads Get uploads configuration
+// @Summary      Get tus protocol configuration
+// @Description  This method returns supported tus protocol version,
+// @Description  extensions and maximal upload size in headers
+// @Tags         Uploads
+// @Success      204
+// @Header       204  {string}  Tus-Version    "Supported protocol versions"
+// @Header       204  {string}  Tus-Extension  "Supported protocol extensions"
+// @Header       204  {int}     Tus-Max-Size   "Maximal upload size in bytes"
+// @Router       /v1/uploads [options]
+func (controller UploadsController) DescribeUploads(c *gin.Context) {
+	c.Header(base.TusResumableHeader, base.TusVersion)
+	c.Header(base.TusVersionHeader, base.TusVersion)
+	c.Header(base.TusExtensionHeader, base.TusExtensions)
+	c.Header(
+		base.TusMaxSizeHeader,
+		strconv.FormatInt(controller.Files.UploadConfig.MaxFileBytes, 10),
+	)
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload Create upload
+// @Summary      Create resumable upload
+// @Description  This method creates a resumable upload of declared
+// @Description  non-zero length. File name is required in metadata, other
+// @Description  metadata keys match upload form fields: filetype,
+// @Description  lifetime_minutes, expires_at, max_downloads, password,
+// @Description  encryption_params
+// @Tags         Uploads
+// @Security     User
+// @Param 		 Tus-Resumable header string true "Protocol version" example(1.0.0)
+// @Param 		 Upload-Length header int true "Size of the file in bytes"
+// @Param 		 Upload-Metadata header string true "Comma separated keys with base64 encoded values" example(filename ZmlsZS50eHQ=)
+// @Success      201
+// @Header       201  {string}  Location           "Upload URL"
+// @Header       201  {string}  Upload-Expires     "Upload expiration"
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      412  {object}  api.ErrorResponse
+// @Failure      413  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Failure      507  {object}  api.ErrorResponse
+// @Router       /v1/uploads [post]
+func (controller UploadsController) CreateUpload(c *gin.Context) {
+	base.Logger.Info("Requested upload creation")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+
+	length, err := parseUploadHeader(c, base.UploadLengthHeader)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if length == 0 {
+		// Empty files are not stored, as with regular uploads.
+		c.Error(base.NewHeaderError(base.UploadLengthHeader, errors.New("empty upload")))
+		return
+	}
+	maxFileBytes, err := controller.Files.checkStorageQuota(auth.Username, length)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if length > maxFileBytes {
+		c.Error(base.NewFileTooLargeError(maxFileBytes))
+		return
+	}
+
+	metadata, err := parseUploadMetadata(c.GetHeader(base.UploadMetadataHeader))
+	if err != nil {
+		c.Error(base.NewHeaderError(base.UploadMetadataHeader, err))
+		return
+	}
+	upload, err := controller.newUpload(metadata)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	upload.Username = auth.Username
+	upload.Length = length
+
+	// Declared length is counted in storage usage until the upload is
+	// finished, the file created from the upload takes the reservation.
+	if err = controller.Files.UserService.ReserveStorage(auth.Username, length); err != nil {
+		c.Error(err)
+		return
+	}
+	if err = controller.UploadsService.AddUpload(upload); err != nil {
+		controller.releaseStorage(upload)
+		c.Error(err)
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.Identifier)
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+// newUpload validates upload metadata, so the file can be created once
+// the content is received. Download password is kept hashed only.
+func (controller UploadsController) newUpload(
+	metadata map[string]string,
+) (*api.Upload, error) {
+	name := metadata[base.FileNameUploadMetadata]
+	if err := controller.Files.SchemaValidator.Var(name, "required,filename"); err != nil {
+		return nil, base.NewHeaderError(
+			base.UploadMetadataHeader,
+			fmt.Errorf("invalid metadata '%s'", base.FileNameUploadMetadata),
+		)
+	}
+	fileMetadata, err := controller.Files.buildFileMetadata(
+		name, metadata[base.FileTypeUploadMetadata], metadataValues(metadata),
+	)
+	if err != nil {
+		return nil, err
+	}
+	delete(metadata, base.PasswordFormField)
+
+	creation := time.Now()
+	return &api.Upload{
+		Identifier:     generateShortUUID(),
+		Chunks:         []api.UploadChunk{},
+		Metadata:       metadata,
+		PasswordHash:   fileMetadata.PasswordHash,
+		Creation:       creation.Unix(),
+		ExpirationDate: controller.UploadsConfig.Expiration(creation),
+	}, nil
+}
+
+// GetUploadOffset Get upload offset
+// @Summary      Get offset of resumable upload
+// @Description  This method returns number of received bytes of the
+// @Description  upload, identifier of created file is returned once
+// @Description  the upload is finished
+// @Tags         Uploads
+// @Security     User
+// @Param 		 identifier path string true "Upload ID"
+// @Param 		 Tus-Resumable header string true "Protocol version" example(1.0.0)
+// @Success      200
+// @Header       200  {int}     Upload-Offset      "Received bytes"
+// @Header       200  {int}     Upload-Length      "Size of the file in bytes"
+// @Header       200  {string}  X-File-Identifier  "File ID of finished upload"
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      412  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/uploads/{identifier} [head]
+func (controller UploadsController) GetUploadOffset(c *gin.Context) {
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+
+	upload, err := controller.UploadsService.GetUploadByOwner(
+		c.Param(base.UploadIdPathParam), auth.Username,
+	)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header(base.UploadLengthHeader, strconv.FormatInt(upload.Length, 10))
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// AppendUploadContent Upload content
+// @Summary      Upload content of resumable upload
+// @Description  This method appends content at the specified offset,
+// @Description  the file is created once all content is received
+// @Tags         Uploads
+// @Security     User
+// @Accept       application/offset+octet-stream
+// @Param 		 identifier path string true "Upload ID"
+// @Param 		 Tus-Resumable header string true "Protocol version" example(1.0.0)
+// @Param 		 Upload-Offset header int true "Offset of sent content"
+// @Success      204
+// @Header       204  {int}     Upload-Offset      "Received bytes"
+// @Header       204  {string}  Upload-Expires     "Upload expiration"
+// @Header       204  {string}  X-File-Identifier  "File ID of finished upload"
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      409  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      412  {object}  api.ErrorResponse
+// @Failure      413  {object}  api.ErrorResponse
+// @Failure      415  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Failure      507  {object}  api.ErrorResponse
+// @Router       /v1/uploads/{identifier} [patch]
+func (controller UploadsController) AppendUploadContent(c *gin.Context) {
+	base.Logger.Info("Requested upload content")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if contentType != base.TusContentType {
+		c.Error(base.NewUploadContentTypeError())
+		return
+	}
+	offset, err := parseUploadHeader(c, base.UploadOffsetHeader)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	uploadId := c.Param(base.UploadIdPathParam)
+	upload, err := controller.UploadsService.GetUploadByOwner(uploadId, auth.Username)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if offset != upload.Offset {
+		c.Error(base.NewUploadOffsetError(uploadId, upload.Offset))
+		return
+	}
+	if upload.FileIdentifier != "" {
+		// Repeated request of already finished upload.
+		setUploadHeaders(c, upload)
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	body := &interruptedReader{Reader: c.Request.Body}
+	upload, err = controller.appendChunk(upload, body)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if body.Err != nil {
+		c.Error(base.NewFilesRequestError(body.Err))
+		return
+	}
+	if upload.Offset == upload.Length {
+		if err = controller.finishUpload(upload); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// appendChunk stores received content as a new chunk of the upload.
+func (controller UploadsController) appendChunk(
+	upload *api.Upload,
+	body io.Reader,
+) (*api.Upload, error) {
+	chunk := api.UploadChunk{Identifier: generateShortUUID()}
+	content := &sizeLimitedReader{
+		Reader: body,
+		Limit:  upload.Length - upload.Offset,
+	}
+	// Chunk expires together with the upload prolonged by this request,
+	// so TTL indexes do not remove content of an unfinished upload.
+	chunkData := api.FileData{
+		Identifier:     chunk.Identifier,
+		ExpirationDate: controller.UploadsConfig.Expiration(time.Now()),
+	}
+	_, err := controller.Files.FilesService.AddFile(&chunkData, content)
+	if content.Exceeded() {
+		return nil, base.NewUploadLengthExceededError(upload.Length)
+	} else if err != nil {
+		return nil, err
+	}
+	if content.BytesRead == 0 {
+		controller.Files.removeFileData(chunk.Identifier)
+		return upload, nil
+	}
+
+	chunk.Size = content.BytesRead
+	chunk.Encryption = chunkData.Encryption
+	updated, err := controller.UploadsService.AppendUploadChunk(
+		upload.Identifier, upload.Offset, &chunk,
+	)
+	if err != nil {
+		controller.Files.removeFileData(chunk.Identifier)
+		return nil, err
+	}
+	return updated, nil
+}
+
+// finishUpload creates a file from the upload chunks.
+func (controller UploadsController) finishUpload(upload *api.Upload) error {
+	fileMetadata, err := controller.Files.buildFileMetadata(
+		upload.Metadata[base.FileNameUploadMetadata],
+		upload.Metadata[base.FileTypeUploadMetadata],
+		metadataValues(upload.Metadata),
+	)
+	if err != nil {
+		return err
+	}
+	fileMetadata.Username = upload.Username
+	if upload.PasswordHash != "" {
+		fileMetadata.PasswordProtected = true
+		fileMetadata.PasswordHash = upload.PasswordHash
+	}
+
+	content := &chunksReader{
+		FilesService: controller.Files.FilesService,
+		Chunks:       upload.Chunks,
+	}
+	defer content.Close()
+	response, err := controller.Files.storeFile(
+		fileMetadata, content, &contentDigests{}, upload.Length, true,
+	)
+	if err != nil {
+		if fileMetadata.ScanStatus == base.ScanStatusInfected {
+			// Reserved storage was released with the purged file, so
+			// the upload is not kept either.
+			controller.deleteUpload(upload.Identifier)
+		}
+		return err
+	}
+
+	finished, err := controller.UploadsService.FinishUpload(
+		upload.Identifier, response.Identifier,
+	)
+	if err != nil {
+		controller.discardFile(fileMetadata)
+		return err
+	}
+	if finished.FileIdentifier != response.Identifier {
+		// Upload was finished by a concurrent request, its file is kept.
+		controller.discardFile(fileMetadata)
+	} else {
+		controller.removeChunks(upload)
+	}
+	upload.FileIdentifier = finished.FileIdentifier
+	upload.Chunks = finished.Chunks
+	return nil
+}
+
+func (controller UploadsController) removeChunks(upload *api.Upload) {
+	for _, chunk := range upload.Chunks {
+		controller.Files.removeFileData(chunk.Identifier)
+	}
+}
+
+// discardFile removes the file created from the upload which could not be
+// linked with it. Storage stays reserved for the upload, so the file is
+// not uncounted.
+func (controller UploadsController) discardFile(fileMetadata *api.FileMetadata) {
+	fileId := fileMetadata.Identifier
+	controller.Files.removeFileData(fileId)
+	if err := controller.Files.FilesMetadataService.DeleteFileMetadata(fileId); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"error":      err.Error(),
+		}).Error("Discard file metadata error")
+	}
+}
+
+// deleteUpload removes the upload and its chunks. Errors are only logged,
+// expired uploads are removed by the sweeper anyway.
+func (controller UploadsController) deleteUpload(uploadId string) {
+	upload, err := controller.UploadsService.DeleteUpload(uploadId)
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": uploadId,
+			"error":      err.Error(),
+		}).Error("Delete upload error")
+		return
+	}
+	controller.removeChunks(upload)
+}
+
+// releaseStorage uncounts storage reserved for the upload unless it is
+// finished, storage of finished upload is counted for its file. Errors are
+// only logged since the upload is already deleted.
+func (controller UploadsController) releaseStorage(upload *api.Upload) {
+	if upload.FileIdentifier != "" {
+		return
+	}
+	err := controller.Files.UserService.ReleaseStorage(
+		upload.Username,
+		&api.UserUsage{Files: 1, Bytes: upload.Length},
+	)
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": upload.Identifier,
+			"username":   upload.Username,
+			"error":      err.Error(),
+		}).Error("Release storage usage error")
+	}
+}
+
+// TerminateUpload Terminate upload
+// @Summary      Terminate resumable upload
+// @Description  This method deletes the upload and received content,
+// @Description  the file of finished upload is kept
+// @Tags         Uploads
+// @Security     User
+// @Param 		 identifier path string true "Upload ID"
+// @Param 		 Tus-Resumable header string true "Protocol version" example(1.0.0)
+// @Success      204
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      410  {object}  api.ErrorResponse
+// @Failure      412  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/uploads/{identifier} [delete]
+func (controller UploadsController) TerminateUpload(c *gin.Context) {
+	base.Logger.Info("Requested upload termination")
+
+	auth, err := GetAuthenticatedUser(c)
+	if err != nil {
+		return
+	}
+
+	uploadId := c.Param(base.UploadIdPathParam)
+	upload, err := controller.UploadsService.GetUploadByOwner(uploadId, auth.Username)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	upload, err = controller.UploadsService.DeleteUpload(uploadId)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	controller.removeChunks(upload)
+	controller.releaseStorage(upload)
+
+	c.Status(http.StatusNoContent)
+}
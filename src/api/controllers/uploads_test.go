@@ -0,0 +1,564 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stealthy-backend/api"
+	"stealthy-backend/api/services"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupUploadsRouter(
+	config *base.BackendConfig,
+	filesController FilesController,
+	uploadsService services.BaseUploadsService,
+	authService services.BaseAuthorizationService,
+) *gin.Engine {
+	authController := AuthorizationController{
+		AuthService: authService,
+	}
+	uploadsController := UploadsController{
+		Files:          filesController,
+		UploadsService: uploadsService,
+		UploadsConfig:  &config.Uploads,
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.NoRoute(api.NoRouteHandler)
+	router.NoMethod(api.NoMethodHandler)
+	router.Use(api.LogsHandler)
+	router.Use(api.ErrorHandler)
+	router.Use(api.CORSHandler)
+
+	applicationGroup := router.Group(config.Server.BasePath)
+	v1 := applicationGroup.Group("/v1")
+
+	uploadsGroup := v1.Group("/uploads")
+	uploadsGroup.OPTIONS("", uploadsController.DescribeUploads)
+
+	withAuthUploadsGroup := v1.Group("/uploads").Use(
+		uploadsController.CheckTusResumable, authController.Authorize,
+	)
+	withAuthUploadsGroup.POST("", uploadsController.CreateUpload)
+	withAuthUploadsGroup.HEAD(
+		fmt.Sprintf("/:%s", base.UploadIdPathParam),
+		uploadsController.GetUploadOffset,
+	)
+	withAuthUploadsGroup.PATCH(
+		fmt.Sprintf("/:%s", base.UploadIdPathParam),
+		uploadsController.AppendUploadContent,
+	)
+	withAuthUploadsGroup.DELETE(
+		fmt.Sprintf("/:%s", base.UploadIdPathParam),
+		uploadsController.TerminateUpload,
+	)
+
+	return router
+}
+
+type UploadsApiTestSuite struct {
+	suite.Suite
+	Config              *base.BackendConfig
+	AuthToken           string
+	UserFixture         *api.User
+	UploadFixture       *api.Upload
+	StoredContent       map[string][]byte
+	FilesServiceMock    *tests.BaseFilesService
+	MetadataServiceMock *tests.BaseFilesMetadataService
+	UserServiceMock     *tests.BaseUserService
+	UploadsServiceMock  *tests.BaseUploadsService
+	AuthServiceMock     *tests.BaseAuthorizationService
+	ScannerMock         *tests.BaseScanner
+	Router              *gin.Engine
+}
+
+func (s *UploadsApiTestSuite) SetupTest() {
+	s.Config = &base.BackendConfig{}
+	s.Config.SetDefaults()
+	s.Config.Logs.AppName = "sharing-backend-test"
+
+	s.AuthToken = "authorization_token"
+	s.UserFixture = &api.User{Username: "valid_username"}
+	s.UploadFixture = &api.Upload{
+		Identifier:     "upload",
+		Username:       s.UserFixture.Username,
+		Length:         8,
+		Chunks:         []api.UploadChunk{},
+		Metadata:       map[string]string{base.FileNameUploadMetadata: "file.txt"},
+		Creation:       time.Now().Unix(),
+		ExpirationDate: time.Now().Add(time.Hour),
+	}
+	s.StoredContent = map[string][]byte{}
+
+	s.FilesServiceMock = tests.NewBaseFilesService(s.T())
+	s.MetadataServiceMock = tests.NewBaseFilesMetadataService(s.T())
+	s.UploadsServiceMock = tests.NewBaseUploadsService(s.T())
+	s.UserServiceMock = tests.NewBaseUserService(s.T())
+	s.AuthServiceMock = tests.NewBaseAuthorizationService(s.T())
+	s.ScannerMock = tests.NewBaseScanner(s.T())
+	mockUserStorage(s.UserServiceMock, s.UserFixture.Username, &api.UserStorage{})
+	shareLinksServiceMock := tests.NewBaseShareLinksService(s.T())
+	mockScanner(s.ScannerMock, s.MetadataServiceMock)
+	mockShareLinks(shareLinksServiceMock)
+	filesController := FilesController{
+		FilesService:         s.FilesServiceMock,
+		FilesMetadataService: s.MetadataServiceMock,
+		ShareLinksService:    shareLinksServiceMock,
+		UserService:          s.UserServiceMock,
+		FilesExpConfig:       &s.Config.FilesExpConfig,
+		UploadConfig:         &s.Config.Upload,
+		ContentTypes:         &s.Config.ContentTypes,
+		Scanning:             &s.Config.Scanning,
+		Scanner:              s.ScannerMock,
+		PasswordLimiter:      services.NewAttemptsLimiter(&s.Config.FilesPassword),
+		SchemaValidator:      base.CreateValidator(),
+	}
+	s.Router = setupUploadsRouter(
+		s.Config, filesController, s.UploadsServiceMock, s.AuthServiceMock,
+	)
+}
+
+func (s *UploadsApiTestSuite) serve(req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.Router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (s *UploadsApiTestSuite) newRequest(
+	method string,
+	url string,
+	body io.Reader,
+) *http.Request {
+	req, err := http.NewRequest(method, getRequestUrl(s.Config, url), body)
+	assert.NoError(s.T(), err)
+	s.AuthServiceMock.On("ParseToken", s.AuthToken).Return(s.UserFixture, nil).Maybe()
+	req.Header.Set("Authorization", s.AuthToken)
+	req.Header.Set(base.TusResumableHeader, base.TusVersion)
+	return req
+}
+
+func (s *UploadsApiTestSuite) newPatchRequest(offset int64, content string) *http.Request {
+	req := s.newRequest(
+		"PATCH", "/uploads/"+s.UploadFixture.Identifier, strings.NewReader(content),
+	)
+	req.Header.Set("Content-Type", base.TusContentType)
+	req.Header.Set(base.UploadOffsetHeader, fmt.Sprint(offset))
+	return req
+}
+
+// mockStorage keeps stored content in memory.
+func (s *UploadsApiTestSuite) mockStorage() {
+	s.FilesServiceMock.On("AddFile", mock.Anything, mock.Anything).Return(
+		func(request *api.FileData, reader io.Reader) (*api.AddFileResponse, error) {
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, base.NewFilesRequestError(err)
+			}
+			s.StoredContent[request.Identifier] = content
+			return &api.AddFileResponse{Identifier: request.Identifier}, nil
+		},
+	).Maybe()
+	s.FilesServiceMock.On("OpenFile", mock.Anything).Return(
+		func(file *api.FileData) (io.ReadSeekCloser, error) {
+			content := s.StoredContent[file.Identifier]
+			return services.NopSeekCloser(bytes.NewReader(content)), nil
+		},
+	).Maybe()
+	s.FilesServiceMock.On("DeleteFile", mock.Anything).Return(
+		func(fileId string) error {
+			delete(s.StoredContent, fileId)
+			return nil
+		},
+	).Maybe()
+}
+
+func (s *UploadsApiTestSuite) mockGetUpload() {
+	s.UploadsServiceMock.On(
+		"GetUploadByOwner", s.UploadFixture.Identifier, s.UserFixture.Username,
+	).Return(s.UploadFixture, nil)
+}
+
+// mockAppendChunk records appended chunk in the upload fixture.
+func (s *UploadsApiTestSuite) mockAppendChunk() {
+	s.UploadsServiceMock.On(
+		"AppendUploadChunk", s.UploadFixture.Identifier, mock.Anything, mock.Anything,
+	).Return(func(
+		uploadId string,
+		offset int64,
+		chunk *api.UploadChunk,
+	) (*api.Upload, error) {
+		upload := *s.UploadFixture
+		upload.Offset += chunk.Size
+		upload.Chunks = append(upload.Chunks, *chunk)
+		return &upload, nil
+	})
+}
+
+// mockFinishUpload links upload with the stored file, or with the file of
+// a concurrent request if finishedFileId is set.
+func (s *UploadsApiTestSuite) mockFinishUpload(finishedFileId string) {
+	s.UploadsServiceMock.On(
+		"FinishUpload", s.UploadFixture.Identifier, mock.Anything,
+	).Return(func(uploadId string, fileId string) (*api.Upload, error) {
+		upload := *s.UploadFixture
+		upload.Offset = upload.Length
+		upload.Chunks = []api.UploadChunk{}
+		upload.FileIdentifier = fileId
+		if finishedFileId != "" {
+			upload.FileIdentifier = finishedFileId
+		}
+		return &upload, nil
+	})
+}
+
+func (s *UploadsApiTestSuite) TestApiDescribeUploads() {
+	req, err := http.NewRequest("OPTIONS", getRequestUrl(s.Config, "/uploads"), nil)
+	assert.NoError(s.T(), err)
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	assert.Equal(s.T(), base.TusVersion, recorder.Header().Get(base.TusVersionHeader))
+	assert.Equal(s.T(), base.TusExtensions, recorder.Header().Get(base.TusExtensionHeader))
+	assert.Equal(
+		s.T(),
+		fmt.Sprint(s.Config.Upload.MaxFileBytes),
+		recorder.Header().Get(base.TusMaxSizeHeader),
+	)
+}
+
+func (s *UploadsApiTestSuite) TestApiUnsupportedTusVersion() {
+	req := s.newRequest("POST", "/uploads", nil)
+	req.Header.Set(base.TusResumableHeader, "0.2.2")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusPreconditionFailed, recorder.Code)
+	assert.Equal(s.T(), base.TusVersion, recorder.Header().Get(base.TusVersionHeader))
+}
+
+func (s *UploadsApiTestSuite) TestApiCreateUpload() {
+	var created *api.Upload
+	s.UploadsServiceMock.On("AddUpload", mock.MatchedBy(func(upload *api.Upload) bool {
+		created = upload
+		return true
+	})).Return(nil)
+	req := s.newRequest("POST", "/uploads", nil)
+	req.Header.Set(base.UploadLengthHeader, "8")
+	req.Header.Set(base.UploadMetadataHeader, fmt.Sprintf(
+		"filename %s,password %s,is_confidential",
+		base64.StdEncoding.EncodeToString([]byte("file.txt")),
+		base64.StdEncoding.EncodeToString([]byte("password")),
+	))
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusCreated, recorder.Code)
+	assert.Equal(
+		s.T(),
+		getRequestUrl(s.Config, "/uploads/"+created.Identifier),
+		recorder.Header().Get("Location"),
+	)
+	assert.Equal(s.T(), base.TusVersion, recorder.Header().Get(base.TusResumableHeader))
+	assert.Equal(s.T(), s.UserFixture.Username, created.Username)
+	assert.Equal(s.T(), int64(8), created.Length)
+	assert.Equal(s.T(), map[string]string{
+		"filename": "file.txt", "is_confidential": "",
+	}, created.Metadata)
+	assert.True(s.T(), services.CheckPasswordEquals("password", created.PasswordHash))
+	s.UserServiceMock.AssertCalled(
+		s.T(), "ReserveStorage", s.UserFixture.Username, int64(8),
+	)
+}
+
+func (s *UploadsApiTestSuite) TestApiCreateUploadQuotaExceededConcurrently() {
+	s.UserServiceMock.ExpectedCalls = nil
+	s.UserServiceMock.On("GetUserStorage", s.UserFixture.Username).Return(
+		&api.UserStorage{}, nil,
+	)
+	s.UserServiceMock.On("ReserveStorage", s.UserFixture.Username, int64(8)).Return(
+		base.NewStorageQuotaError("Quota allows 1 files"),
+	)
+	req := s.newRequest("POST", "/uploads", nil)
+	req.Header.Set(base.UploadLengthHeader, "8")
+	req.Header.Set(base.UploadMetadataHeader, "filename "+
+		base64.StdEncoding.EncodeToString([]byte("file.txt")))
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusInsufficientStorage, recorder.Code)
+	s.UploadsServiceMock.AssertNotCalled(s.T(), "AddUpload", mock.Anything)
+}
+
+func (s *UploadsApiTestSuite) TestApiCreateUploadTooLarge() {
+	req := s.newRequest("POST", "/uploads", nil)
+	req.Header.Set(base.UploadLengthHeader, fmt.Sprint(s.Config.Upload.MaxFileBytes+1))
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func (s *UploadsApiTestSuite) TestApiCreateUploadEmpty() {
+	req := s.newRequest("POST", "/uploads", nil)
+	req.Header.Set(base.UploadLengthHeader, "0")
+	req.Header.Set(base.UploadMetadataHeader, "filename "+
+		base64.StdEncoding.EncodeToString([]byte("file.txt")))
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	s.UploadsServiceMock.AssertNotCalled(s.T(), "AddUpload", mock.Anything)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *UploadsApiTestSuite) TestApiCreateUploadWithoutFilename() {
+	req := s.newRequest("POST", "/uploads", nil)
+	req.Header.Set(base.UploadLengthHeader, "8")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	s.UploadsServiceMock.AssertNotCalled(s.T(), "AddUpload", mock.Anything)
+}
+
+func (s *UploadsApiTestSuite) TestApiGetUploadOffset() {
+	s.UploadFixture.Offset = 3
+	s.mockGetUpload()
+
+	recorder := s.serve(s.newRequest("HEAD", "/uploads/"+s.UploadFixture.Identifier, nil))
+
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+	assert.Equal(s.T(), "3", recorder.Header().Get(base.UploadOffsetHeader))
+	assert.Equal(s.T(), "8", recorder.Header().Get(base.UploadLengthHeader))
+	assert.Equal(s.T(), "no-store", recorder.Header().Get("Cache-Control"))
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContent() {
+	s.mockStorage()
+	s.mockGetUpload()
+	s.mockAppendChunk()
+
+	recorder := s.serve(s.newPatchRequest(0, "data"))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	assert.Equal(s.T(), "4", recorder.Header().Get(base.UploadOffsetHeader))
+	assert.Empty(s.T(), recorder.Header().Get(base.FileIdentifierHeader))
+	assert.Len(s.T(), s.StoredContent, 1)
+	s.MetadataServiceMock.AssertNotCalled(s.T(), "AddFileMetadata", mock.Anything)
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContentChunkExpiration() {
+	var chunkData *api.FileData
+	s.FilesServiceMock.On("AddFile", mock.MatchedBy(func(request *api.FileData) bool {
+		chunkData = request
+		return true
+	}), mock.Anything).Return(
+		func(request *api.FileData, reader io.Reader) (*api.AddFileResponse, error) {
+			_, err := io.ReadAll(reader)
+			return &api.AddFileResponse{Identifier: request.Identifier}, err
+		},
+	)
+	s.mockGetUpload()
+	s.mockAppendChunk()
+
+	recorder := s.serve(s.newPatchRequest(0, "data"))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	assert.False(s.T(), chunkData.ExpirationDate.Before(s.UploadFixture.ExpirationDate))
+	assert.WithinDuration(
+		s.T(),
+		s.Config.Uploads.Expiration(time.Now()),
+		chunkData.ExpirationDate,
+		time.Minute,
+	)
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContentFinishes() {
+	s.UploadFixture.Offset = 4
+	s.UploadFixture.Chunks = []api.UploadChunk{{Identifier: "chunk", Size: 4}}
+	s.StoredContent["chunk"] = []byte("file")
+	s.mockStorage()
+	s.mockGetUpload()
+	s.mockAppendChunk()
+	var fileId string
+	s.MetadataServiceMock.On("AddFileMetadata", mock.MatchedBy(
+		func(fileMetadata *api.FileMetadata) bool {
+			fileId = fileMetadata.Identifier
+			return fileMetadata.Name == "file.txt" &&
+				fileMetadata.Username == s.UserFixture.Username &&
+				fileMetadata.Size == 8 &&
+				fileMetadata.SHA256 == fmt.Sprintf("%x", sha256.Sum256([]byte("filedata")))
+		},
+	)).Return(func(fileMetadata *api.FileMetadata) (*api.AddFileResponse, error) {
+		return &api.AddFileResponse{Identifier: fileMetadata.Identifier}, nil
+	})
+	s.mockFinishUpload("")
+
+	recorder := s.serve(s.newPatchRequest(4, "data"))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	assert.Equal(s.T(), "8", recorder.Header().Get(base.UploadOffsetHeader))
+	assert.Equal(s.T(), fileId, recorder.Header().Get(base.FileIdentifierHeader))
+	assert.Equal(s.T(), map[string][]byte{fileId: []byte("filedata")}, s.StoredContent)
+	s.UserServiceMock.AssertNotCalled(
+		s.T(), "ReserveStorage", mock.Anything, mock.Anything,
+	)
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContentInfected() {
+	s.UploadFixture.Offset = 8
+	s.UploadFixture.Chunks = []api.UploadChunk{{Identifier: "chunk", Size: 8}}
+	s.StoredContent["chunk"] = []byte("filedata")
+	s.mockStorage()
+	s.mockGetUpload()
+	s.ScannerMock.ExpectedCalls = nil
+	s.ScannerMock.On("Scan", mock.Anything).Return(
+		&api.ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, nil,
+	)
+	s.MetadataServiceMock.On("AddFileMetadata", mock.Anything).Return(
+		func(fileMetadata *api.FileMetadata) (*api.AddFileResponse, error) {
+			return &api.AddFileResponse{Identifier: fileMetadata.Identifier}, nil
+		},
+	)
+	s.MetadataServiceMock.On("DeleteFileMetadata", mock.Anything).Return(nil)
+	s.UploadsServiceMock.On("DeleteUpload", s.UploadFixture.Identifier).Return(
+		s.UploadFixture, nil,
+	)
+
+	recorder := s.serve(s.newPatchRequest(8, ""))
+
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, recorder.Code)
+	assert.Empty(s.T(), s.StoredContent)
+	s.UserServiceMock.AssertNumberOfCalls(s.T(), "ReleaseStorage", 1)
+	s.UploadsServiceMock.AssertNotCalled(
+		s.T(), "FinishUpload", mock.Anything, mock.Anything,
+	)
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContentFinishedConcurrently() {
+	s.UploadFixture.Offset = 8
+	s.UploadFixture.Chunks = []api.UploadChunk{{Identifier: "chunk", Size: 8}}
+	s.StoredContent["chunk"] = []byte("filedata")
+	s.mockStorage()
+	s.mockGetUpload()
+	var fileId string
+	s.MetadataServiceMock.On("AddFileMetadata", mock.MatchedBy(
+		func(fileMetadata *api.FileMetadata) bool {
+			fileId = fileMetadata.Identifier
+			return true
+		},
+	)).Return(func(fileMetadata *api.FileMetadata) (*api.AddFileResponse, error) {
+		return &api.AddFileResponse{Identifier: fileMetadata.Identifier}, nil
+	})
+	s.MetadataServiceMock.On("DeleteFileMetadata", mock.Anything).Return(nil)
+	s.mockFinishUpload("finished_file")
+
+	recorder := s.serve(s.newPatchRequest(8, ""))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	assert.Equal(s.T(), "finished_file", recorder.Header().Get(base.FileIdentifierHeader))
+	assert.Equal(s.T(), map[string][]byte{"chunk": []byte("filedata")}, s.StoredContent)
+	s.MetadataServiceMock.AssertCalled(s.T(), "DeleteFileMetadata", fileId)
+	s.UserServiceMock.AssertNotCalled(
+		s.T(), "ReleaseStorage", mock.Anything, mock.Anything,
+	)
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContentOffsetMismatch() {
+	s.mockGetUpload()
+
+	recorder := s.serve(s.newPatchRequest(2, "data"))
+
+	assert.Equal(s.T(), http.StatusConflict, recorder.Code)
+	s.FilesServiceMock.AssertNotCalled(s.T(), "AddFile", mock.Anything, mock.Anything)
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContentExceedsLength() {
+	s.mockStorage()
+	s.mockGetUpload()
+
+	recorder := s.serve(s.newPatchRequest(0, "too long data"))
+
+	assert.Equal(s.T(), http.StatusRequestEntityTooLarge, recorder.Code)
+	s.UploadsServiceMock.AssertNotCalled(
+		s.T(), "AppendUploadChunk", mock.Anything, mock.Anything, mock.Anything,
+	)
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContentInvalidType() {
+	req := s.newPatchRequest(0, "data")
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	recorder := s.serve(req)
+
+	assert.Equal(s.T(), http.StatusUnsupportedMediaType, recorder.Code)
+}
+
+func (s *UploadsApiTestSuite) TestApiAppendUploadContentOfAnotherUser() {
+	uploadId := s.UploadFixture.Identifier
+	s.UploadsServiceMock.On(
+		"GetUploadByOwner", uploadId, s.UserFixture.Username,
+	).Return(nil, base.NewUploadAccessDeniedError(uploadId))
+
+	recorder := s.serve(s.newPatchRequest(0, "data"))
+
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+}
+
+func (s *UploadsApiTestSuite) TestApiTerminateUpload() {
+	s.UploadFixture.Chunks = []api.UploadChunk{{Identifier: "chunk", Size: 4}}
+	s.StoredContent["chunk"] = []byte("data")
+	s.mockStorage()
+	s.mockGetUpload()
+	s.UploadsServiceMock.On("DeleteUpload", s.UploadFixture.Identifier).Return(
+		s.UploadFixture, nil,
+	)
+
+	recorder := s.serve(s.newRequest(
+		"DELETE", "/uploads/"+s.UploadFixture.Identifier, nil,
+	))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	assert.Empty(s.T(), s.StoredContent)
+	s.UserServiceMock.AssertCalled(
+		s.T(), "ReleaseStorage", s.UserFixture.Username,
+		&api.UserUsage{Files: 1, Bytes: 8},
+	)
+}
+
+func (s *UploadsApiTestSuite) TestApiTerminateFinishedUpload() {
+	s.mockGetUpload()
+	finished := *s.UploadFixture
+	finished.FileIdentifier = "file"
+	s.UploadsServiceMock.On("DeleteUpload", s.UploadFixture.Identifier).Return(
+		&finished, nil,
+	)
+
+	recorder := s.serve(s.newRequest(
+		"DELETE", "/uploads/"+s.UploadFixture.Identifier, nil,
+	))
+
+	assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+	s.UserServiceMock.AssertNotCalled(
+		s.T(), "ReleaseStorage", mock.Anything, mock.Anything,
+	)
+}
+
+func TestUploadsApi(t *testing.T) {
+	suite.Run(t, new(UploadsApiTestSuite))
+}
@@ -88,6 +88,10 @@ func (s *UsersApiTestSuite) TestApiGetUser() {
 	usersServiceMock := tests.NewBaseUserService(s.T())
 	authServiceMock := tests.NewBaseAuthorizationService(s.T())
 	authServiceMock.On("ParseToken", s.AuthToken).Return(s.UserFixture, nil)
+	s.UserResponseFixture.Storage = &api.UserStorage{
+		Quota: api.UserQuota{MaxTotalBytes: 1 << 30, MaxFiles: 1000},
+		Usage: api.UserUsage{Bytes: 12894, Files: 1},
+	}
 	usersServiceMock.On("GetUserPublicData", s.UserFixture.Username).Return(
 		s.UserResponseFixture, nil,
 	)
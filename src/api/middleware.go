@@ -101,12 +101,29 @@ func CORSHandler(c *gin.Context) {
 	c.Writer.Header().Set(
 		"Access-Control-Allow-Headers",
 		"Content-Type, Content-Length, Accept-Encoding, Authorization, "+
-			"Content-Disposition")
-	c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
-	c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET")
-
-	if c.Request.Method == "OPTIONS" {
-		c.AbortWithStatus(204)
+			"Content-Disposition, Range, If-Range, If-None-Match, "+
+			"If-Modified-Since, "+base.FilePasswordHeader+", "+
+			base.DigestHeader+", "+base.ContentMD5Header+", "+
+			base.TusResumableHeader+", "+base.UploadLengthHeader+", "+
+			base.UploadOffsetHeader+", "+base.UploadMetadataHeader)
+	c.Writer.Header().Set(
+		"Access-Control-Expose-Headers",
+		"Content-Disposition, Content-Range, Accept-Ranges, ETag, Last-Modified, "+
+			"Location, "+base.DigestHeader+", "+base.ReprDigestHeader+", "+
+			base.FileIdentifierHeader+", "+base.EncryptionParamsHeader+", "+
+			base.TusResumableHeader+", "+
+			base.TusVersionHeader+", "+base.TusExtensionHeader+", "+
+			base.TusMaxSizeHeader+", "+base.UploadLengthHeader+", "+
+			base.UploadOffsetHeader+", "+base.UploadExpiresHeader)
+	c.Writer.Header().Set(
+		"Access-Control-Allow-Methods", "POST, OPTIONS, GET, HEAD, PUT, PATCH, DELETE",
+	)
+
+	// Only preflight requests are answered here, other OPTIONS requests
+	// are routed, e.g. tus protocol discovery.
+	if c.Request.Method == http.MethodOptions &&
+		c.GetHeader("Access-Control-Request-Method") != "" {
+		c.AbortWithStatus(http.StatusNoContent)
 		return
 	}
 
@@ -1,10 +1,28 @@
 package api
 
+import "time"
+
 type User struct {
-	Username     string `json:"username" validate:"required,username"`
-	PasswordHash string `json:"password_hash" bson:"password_hash"`
+	Username     string     `json:"username" validate:"required,username"`
+	PasswordHash string     `json:"password_hash" bson:"password_hash"`
+	Quota        *UserQuota `json:"-" bson:"quota,omitempty"`
+	Usage        UserUsage  `json:"-" bson:"usage"`
 }
 
+// UserQuota limits storage of a user, zero value means no limit. Limits
+// set for a user override configured defaults.
+type UserQuota struct {
+	MaxTotalBytes int64 `json:"max_total_bytes" bson:"max_total_bytes,omitempty" example:"1073741824"`
+	MaxFiles      int64 `json:"max_files" bson:"max_files,omitempty" example:"1000"`
+	MaxFileBytes  int64 `json:"max_file_bytes" bson:"max_file_bytes,omitempty" example:"104857600"`
+} //@name UserQuota
+
+// UserUsage counts not yet purged files of a user.
+type UserUsage struct {
+	Bytes int64 `json:"bytes" bson:"bytes" example:"12894"`
+	Files int64 `json:"files" bson:"files" example:"1"`
+} //@name UserUsage
+
 type FileMetadata struct {
 	Identifier string `json:"identifier" bson:"identifier" validate:"required" example:"YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm"`
 	Name       string `json:"name" validate:"required,filename" example:"my_image.png"`
@@ -13,9 +31,138 @@ type FileMetadata struct {
 	Mimetype   string `json:"mimetype" validate:"required" example:"image/png"`
 	Creation   int64  `json:"creation" validate:"required" example:"1699651187"`
 	Expiration int64  `json:"expiration" validate:"required" example:"1699644399"`
+
+	DeclaredMimetype string `json:"declared_mimetype,omitempty" bson:"declared_mimetype,omitempty" example:"image/png"`
+	DetectedMimetype string `json:"detected_mimetype,omitempty" bson:"detected_mimetype,omitempty" example:"image/png"`
+
+	MaxDownloads  int64 `json:"max_downloads" bson:"max_downloads" validate:"gte=0" example:"1"`
+	DownloadCount int64 `json:"download_count" bson:"download_count" validate:"gte=0" example:"0"`
+
+	// Counters of download attempts recorded in access log.
+	AccessCount int64 `json:"access_count" bson:"access_count,omitempty" example:"3"`
+	BytesSent   int64 `json:"bytes_sent" bson:"bytes_sent,omitempty" example:"25788"`
+	LastAccess  int64 `json:"last_access,omitempty" bson:"last_access,omitempty" example:"1699651187"`
+
+	PasswordProtected bool   `json:"password_protected" bson:"password_protected" example:"false"`
+	PasswordHash      string `json:"-" bson:"password_hash,omitempty"`
+
+	Encryption *FileEncryption `json:"-" bson:"encryption,omitempty"`
+
+	EndToEndEncrypted bool   `json:"end_to_end_encrypted" bson:"end_to_end_encrypted,omitempty" example:"false"`
+	EncryptionParams  string `json:"encryption_params,omitempty" bson:"encryption_params,omitempty" validate:"max=1024,printascii" example:"eyJhbGciOiJBRVMtR0NNIiwiaXYiOiIuLi4ifQ"`
+
+	SHA256 string `json:"sha256,omitempty" bson:"sha256,omitempty" example:"3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"`
+	MD5    string `json:"md5,omitempty" bson:"md5,omitempty" example:"8d777f385d3dfec8815d20f7496026dc"`
+
+	ScanStatus string `json:"scan_status,omitempty" bson:"scan_status,omitempty" validate:"omitempty,oneof=pending clean infected error" example:"clean"`
+
+	// Authenticated files are downloaded by signed in users, private files
+	// only by the owner and users the file is shared with. Files without
+	// visibility are public. Other users are not told whom it is shared with.
+	Visibility string   `json:"visibility,omitempty" bson:"visibility,omitempty" validate:"omitempty,oneof=public authenticated private" example:"public"`
+	SharedWith []string `json:"shared_with,omitempty" bson:"shared_with,omitempty" example:"jane_doe"`
+
+	ExpirationDate time.Time `json:"-" bson:"expiration_date"`
 } //@name FileMetadata
 
 type FileData struct {
-	Identifier string `json:"identifier" bson:"identifier" validate:"required"`
-	Data       []byte `json:"data" validate:"required"`
+	Identifier     string          `json:"identifier" bson:"identifier" validate:"required"`
+	Data           []byte          `json:"data" validate:"required"`
+	ExpirationDate time.Time       `json:"-" bson:"expiration_date,omitempty"`
+	Encryption     *FileEncryption `json:"-" bson:"-"`
+}
+
+// FileEncryption describes encryption of stored file content. Data key is
+// kept wrapped with the master key identified by KeyId.
+type FileEncryption struct {
+	Algorithm  string `bson:"algorithm"`
+	KeyId      string `bson:"key_id"`
+	WrappedKey []byte `bson:"wrapped_key"`
+	Nonce      []byte `bson:"nonce"`
+	ChunkSize  int64  `bson:"chunk_size"`
+}
+
+type UploadChunk struct {
+	Identifier string          `bson:"identifier"`
+	Size       int64           `bson:"size"`
+	Encryption *FileEncryption `bson:"encryption,omitempty"`
+}
+
+// Upload keeps state of a resumable upload. Received content is stored
+// in chunks, which are joined into a file when the upload is finished.
+type Upload struct {
+	Identifier     string            `bson:"identifier"`
+	Username       string            `bson:"username"`
+	Length         int64             `bson:"length"`
+	Offset         int64             `bson:"offset"`
+	Chunks         []UploadChunk     `bson:"chunks"`
+	Metadata       map[string]string `bson:"metadata"`
+	PasswordHash   string            `bson:"password_hash,omitempty"`
+	FileIdentifier string            `bson:"file_identifier,omitempty"`
+	Creation       int64             `bson:"creation"`
+	ExpirationDate time.Time         `bson:"expiration_date"`
+}
+
+// Bundle groups files uploaded in one request, so they are shared with
+// one link. It expires together with the last of its files.
+type Bundle struct {
+	Identifier     string    `bson:"identifier"`
+	Username       string    `bson:"username"`
+	Files          []string  `bson:"files"`
+	Creation       int64     `bson:"creation"`
+	Expiration     int64     `bson:"expiration"`
+	ExpirationDate time.Time `bson:"expiration_date"`
+}
+
+// ShareLink grants access to a file with its own token, so the access can
+// be limited or revoked without changes of the file. Zero expiration means
+// the link is valid as long as the file.
+type ShareLink struct {
+	Token             string `json:"token" bson:"token" example:"Zk9xM2lTR0VfX3l2T3NhQmR6b0RwZzFx"`
+	FileIdentifier    string `json:"file_identifier" bson:"file_identifier" example:"YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm"`
+	Username          string `json:"-" bson:"username"`
+	Enabled           bool   `json:"enabled" bson:"enabled" example:"true"`
+	Creation          int64  `json:"creation" bson:"creation" example:"1699651187"`
+	Expiration        int64  `json:"expiration" bson:"expiration" example:"1699644399"`
+	MaxDownloads      int64  `json:"max_downloads" bson:"max_downloads" example:"0"`
+	DownloadCount     int64  `json:"download_count" bson:"download_count" example:"0"`
+	PasswordProtected bool   `json:"password_protected" bson:"password_protected" example:"false"`
+	PasswordHash      string `json:"-" bson:"password_hash,omitempty"`
+} //@name ShareLink
+
+// FileAccess records a download attempt of a file. Share link is the token
+// of the link the file was requested with, username is empty for anonymous
+// requests.
+type FileAccess struct {
+	FileIdentifier string    `json:"-" bson:"file_identifier"`
+	Owner          string    `json:"-" bson:"owner"`
+	Time           int64     `json:"time" bson:"time" example:"1699651187"`
+	ShareLink      string    `json:"share_link,omitempty" bson:"share_link,omitempty" example:"Zk9xM2lTR0VfX3l2T3NhQmR6b0RwZzFx"`
+	ClientIP       string    `json:"client_ip" bson:"client_ip" example:"203.0.113.5"`
+	UserAgent      string    `json:"user_agent,omitempty" bson:"user_agent,omitempty" example:"curl/8.4.0"`
+	Username       string    `json:"username,omitempty" bson:"username,omitempty" example:"jane_doe"`
+	Outcome        string    `json:"outcome" bson:"outcome" example:"downloaded"`
+	Status         int       `json:"status" bson:"status" example:"200"`
+	BytesSent      int64     `json:"bytes_sent" bson:"bytes_sent" example:"12894"`
+	ExpirationDate time.Time `json:"-" bson:"expiration_date"`
+} //@name FileAccess
+
+// PresignParams are constraints of presigned download URL covered by its
+// signature. Empty IP and zero max bytes mean no constraint.
+type PresignParams struct {
+	FileIdentifier string
+	Expires        int64
+	IP             string
+	MaxBytes       int64
+}
+
+type StoredFileInfo struct {
+	Identifier string `bson:"identifier"`
+	Size       int64  `bson:"size"`
+}
+
+// ScanResult tells if malware was found in scanned content.
+type ScanResult struct {
+	Infected  bool
+	Signature string
 }
@@ -17,19 +17,97 @@ type SignInRequest struct {
 	SignUpRequest
 } //@name SignInRequest
 
+type FilePasswordForm struct {
+	Password string `json:"password" validate:"required,password" example:"p@ssw0rd"`
+} //@name FilePasswordForm
+
+type FileEncryptionParamsForm struct {
+	Params string `json:"encryption_params" validate:"required,max=1024,printascii" example:"eyJhbGciOiJBRVMtR0NNIiwiaXYiOiIuLi4ifQ"`
+} //@name FileEncryptionParamsForm
+
+type FileVisibilityForm struct {
+	Visibility string `json:"visibility" validate:"required,oneof=public authenticated private" example:"private"`
+} //@name FileVisibilityForm
+
 type AddFileResponse struct {
 	Identifier string `json:"identifier" bson:"identifier" validate:"required" example:"YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm"`
+	SHA256     string `json:"sha256,omitempty" example:"3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"`
+	MD5        string `json:"md5,omitempty" example:"8d777f385d3dfec8815d20f7496026dc"`
 } //@name AddFileResponse
 
+type AddBundleResponse struct {
+	Identifier string             `json:"identifier" example:"NWJlODYxZjctZDNkYi00ZTJiLWI0ZGYtMzIyNDhkNDQ0ZjA4"`
+	Files      []*AddFileResponse `json:"files"`
+} //@name AddBundleResponse
+
+// BundleFile describes a file of a bundle to anyone having the bundle
+// link, owner and stored details are not included.
+type BundleFile struct {
+	Identifier        string `json:"identifier" example:"YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm"`
+	Name              string `json:"name" example:"my_image.png"`
+	Size              int64  `json:"size" example:"12894"`
+	Mimetype          string `json:"mimetype" example:"image/png"`
+	Expiration        int64  `json:"expiration" example:"1699644399"`
+	PasswordProtected bool   `json:"password_protected" example:"false"`
+	EndToEndEncrypted bool   `json:"end_to_end_encrypted" example:"false"`
+	SHA256            string `json:"sha256,omitempty" example:"3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"`
+} //@name BundleFile
+
+type BundleResponse struct {
+	Identifier string        `json:"identifier" example:"NWJlODYxZjctZDNkYi00ZTJiLWI0ZGYtMzIyNDhkNDQ0ZjA4"`
+	Creation   int64         `json:"creation" example:"1699651187"`
+	Expiration int64         `json:"expiration" example:"1699644399"`
+	Files      []*BundleFile `json:"files"`
+} //@name BundleResponse
+
+// ShareLinkRequest sets properties of a share link, fields which are not
+// sent are left unchanged. Zero expiration and download limit remove the
+// limits, empty password removes the password.
+type ShareLinkRequest struct {
+	Enabled      *bool   `json:"enabled" example:"true"`
+	ExpiresAt    *int64  `json:"expires_at" validate:"omitempty,gte=0" example:"1699644399"`
+	MaxDownloads *int64  `json:"max_downloads" validate:"omitempty,gte=0" example:"10"`
+	Password     *string `json:"password" validate:"omitempty,eq=|password" example:"p@ssw0rd"`
+} //@name ShareLinkRequest
+
+type ShareLinkListResponse struct {
+	Records []*ShareLink `json:"records"`
+} //@name ShareLinkListResponse
+
+type FileAccessListResponse struct {
+	Records []*FileAccess `json:"records"`
+	Total   int64         `json:"total" example:"3"`
+} //@name FileAccessListResponse
+
+// PresignRequest sets constraints of presigned download URL. IP may be an
+// address or a network in CIDR notation. Zero values mean the default
+// lifetime and no size limit.
+type PresignRequest struct {
+	LifetimeSeconds int64  `json:"lifetime_seconds" validate:"gte=0" example:"900"`
+	IP              string `json:"ip" validate:"omitempty,ip|cidr" example:"203.0.113.0/24"`
+	MaxBytes        int64  `json:"max_bytes" validate:"gte=0" example:"0"`
+} //@name PresignRequest
+
+type PresignResponse struct {
+	URL     string `json:"url" example:"/backend/v1/files/YTE1YzhmMjMtYTEwMi00ZmQ0LTk1ZWUtZmM4ZDAyMjc3MmNm?expires=1699644399&signature=3q2-7w"`
+	Expires int64  `json:"expires" example:"1699644399"`
+} //@name PresignResponse
+
 type ErrorResponse struct {
 	Summary string `json:"summary" validate:"required" example:"Invalid authorization token"`
 	Detail  any    `json:"detail"`
 } //@name ErrorResponse
 
 type UserResponse struct {
-	Username string `json:"username" validate:"required,username" example:"john_doe"`
+	Username string       `json:"username" validate:"required,username" example:"john_doe"`
+	Storage  *UserStorage `json:"storage,omitempty"`
 } //@name UserResponse
 
+type UserStorage struct {
+	Quota UserQuota `json:"quota"`
+	Usage UserUsage `json:"usage"`
+} //@name UserStorage
+
 type FileMetadataListResponse struct {
 	Records []*FileMetadata `json:"records" validate:"required,records"`
 	Total   int64           `json:"total" validate:"gte=0" example:"10"`
@@ -39,3 +117,8 @@ type PaginationQueryParameters struct {
 	Skip  int64 `validate:"gte=0" query:"skip" example:"3" default:"0"`
 	Limit int64 `validate:"gte=1" query:"limit" example:"20" default:"20"`
 } //@name PaginationQueryParameters
+
+type FileMetadataListQueryParameters struct {
+	PaginationQueryParameters
+	IncludeExpired bool `query:"include_expired" example:"false" default:"false"`
+} //@name FileMetadataListQueryParameters
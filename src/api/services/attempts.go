@@ -0,0 +1,88 @@
+package services
+
+import (
+	"stealthy-backend/base"
+	"sync"
+	"time"
+)
+
+type attemptsWindow struct {
+	Failures int
+	Started  time.Time
+}
+
+// AttemptsLimiter counts failed attempts per key in a fixed time window.
+// State is kept in memory of the current process.
+type AttemptsLimiter struct {
+	Config      *base.FilesPasswordConfig
+	mutex       sync.Mutex
+	windows     map[string]*attemptsWindow
+	lastCleanup time.Time
+}
+
+func NewAttemptsLimiter(config *base.FilesPasswordConfig) *AttemptsLimiter {
+	return &AttemptsLimiter{
+		Config:      config,
+		windows:     map[string]*attemptsWindow{},
+		lastCleanup: time.Now(),
+	}
+}
+
+func (limiter *AttemptsLimiter) windowDuration() time.Duration {
+	return time.Duration(limiter.Config.SecondsAttemptsWindow) * time.Second
+}
+
+func (limiter *AttemptsLimiter) cleanup(now time.Time) {
+	if now.Sub(limiter.lastCleanup) < limiter.windowDuration() {
+		return
+	}
+	for key, window := range limiter.windows {
+		if now.Sub(window.Started) >= limiter.windowDuration() {
+			delete(limiter.windows, key)
+		}
+	}
+	limiter.lastCleanup = now
+}
+
+func (limiter *AttemptsLimiter) activeWindow(
+	key string,
+	now time.Time,
+) *attemptsWindow {
+	limiter.cleanup(now)
+	window, exists := limiter.windows[key]
+	if exists && now.Sub(window.Started) >= limiter.windowDuration() {
+		delete(limiter.windows, key)
+		return nil
+	}
+	return window
+}
+
+// Allow reserves an attempt of the key unless its attempts are exhausted.
+// The attempt counts as failed until it is released, so concurrent
+// attempts can not exceed the limit.
+func (limiter *AttemptsLimiter) Allow(key string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	window := limiter.activeWindow(key, now)
+	if window == nil {
+		window = &attemptsWindow{Started: now}
+		limiter.windows[key] = window
+	} else if window.Failures >= limiter.Config.MaxAttempts {
+		return false
+	}
+	window.Failures++
+	return true
+}
+
+// Release gives back an attempt reserved by Allow which did not fail.
+func (limiter *AttemptsLimiter) Release(key string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	window := limiter.activeWindow(key, time.Now())
+	if window != nil && window.Failures > 0 {
+		window.Failures--
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"github.com/stretchr/testify/assert"
+	"stealthy-backend/base"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAttemptsLimiterConcurrentAttempts(t *testing.T) {
+	limiter := NewAttemptsLimiter(&base.FilesPasswordConfig{
+		MaxAttempts: 3, SecondsAttemptsWindow: 60,
+	})
+
+	var allowed atomic.Int32
+	var group sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if limiter.Allow("key") {
+				allowed.Add(1)
+			}
+		}()
+	}
+	group.Wait()
+
+	assert.Equal(t, int32(3), allowed.Load())
+	assert.True(t, limiter.Allow("another_key"))
+}
+
+func TestAttemptsLimiterRelease(t *testing.T) {
+	limiter := NewAttemptsLimiter(&base.FilesPasswordConfig{
+		MaxAttempts: 1, SecondsAttemptsWindow: 60,
+	})
+
+	assert.True(t, limiter.Allow("key"))
+	limiter.Release("key")
+	assert.True(t, limiter.Allow("key"))
+	assert.False(t, limiter.Allow("key"))
+}
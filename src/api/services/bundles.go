@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"time"
+)
+
+type BaseBundlesService interface {
+	AddBundle(bundle *api.Bundle) error
+	GetBundle(bundleId string) (*api.Bundle, error)
+	DeleteExpiredBundles() (int64, error)
+}
+
+type BundlesService struct {
+	BaseBundlesService
+	Context    *context.Context
+	Collection mongoifc.Collection
+}
+
+func (service BundlesService) AddBundle(bundle *api.Bundle) error {
+	if _, err := service.Collection.InsertOne(*service.Context, bundle); err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+// GetBundle returns not expired bundle. Files of the bundle may be
+// deleted by their owner meanwhile.
+func (service BundlesService) GetBundle(bundleId string) (*api.Bundle, error) {
+	var bundle api.Bundle
+	err := service.Collection.FindOne(*service.Context, bson.D{
+		primitive.E{Key: "identifier", Value: bundleId},
+	}).Decode(&bundle)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewBundleNotFoundError(bundleId)
+	} else if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	if bundle.Expiration <= time.Now().Unix() {
+		return nil, base.NewBundleExpiredError(bundleId)
+	}
+	return &bundle, nil
+}
+
+// DeleteExpiredBundles removes bundles whose files are all expired, the
+// files themselves are purged separately.
+func (service BundlesService) DeleteExpiredBundles() (int64, error) {
+	result, err := service.Collection.DeleteMany(*service.Context, bson.D{
+		primitive.E{Key: "expiration", Value: bson.D{
+			primitive.E{Key: "$lte", Value: time.Now().Unix()},
+		}},
+	})
+	if err != nil {
+		return 0, base.NewDatabaseError(err)
+	}
+	return result.DeletedCount, nil
+}
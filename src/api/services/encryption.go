@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"strings"
+)
+
+const EncryptionAlgorithm string = "AES-256-GCM"
+const encryptionKeyBytes int = 32
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// KeyRing keeps master keys. Data keys of new files are wrapped with the
+// current master key, previous master keys only unwrap data keys which
+// were not re-wrapped yet.
+type KeyRing struct {
+	currentId string
+	masters   map[string]cipher.AEAD
+	chunkSize int64
+}
+
+func NewKeyRing(config *base.EncryptionConfig) (*KeyRing, error) {
+	encoded := config.MasterKey
+	if config.MasterKeyFile != "" {
+		content, err := os.ReadFile(config.MasterKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("master key file read error: %w", err)
+		}
+		encoded = string(content)
+	}
+
+	ring := &KeyRing{masters: map[string]cipher.AEAD{}, chunkSize: config.ChunkBytes}
+	currentId, err := ring.addMasterKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	ring.currentId = currentId
+	for _, previous := range config.PreviousMasterKeys {
+		if _, err := ring.addMasterKey(previous); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// addMasterKey registers master key, its identifier is derived from the
+// key, so the key used to wrap a data key can be found.
+func (ring *KeyRing) addMasterKey(encoded string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("master key is not base64 encoded: %w", err)
+	} else if len(key) != encryptionKeyBytes {
+		return "", fmt.Errorf("master key has to be %d bytes long", encryptionKeyBytes)
+	}
+	master, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(key)
+	keyId := hex.EncodeToString(sum[:8])
+	ring.masters[keyId] = master
+	return keyId, nil
+}
+
+func (ring *KeyRing) CurrentKeyId() string {
+	return ring.currentId
+}
+
+// NewFileEncryption generates data key of a new file.
+func (ring *KeyRing) NewFileEncryption() (*api.FileEncryption, []byte, error) {
+	dataKey, err := randomBytes(encryptionKeyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := randomBytes(chunkNonceBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrappedKey, err := ring.wrapKey(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &api.FileEncryption{
+		Algorithm:  EncryptionAlgorithm,
+		KeyId:      ring.currentId,
+		WrappedKey: wrappedKey,
+		Nonce:      nonce,
+		ChunkSize:  ring.chunkSize,
+	}, dataKey, nil
+}
+
+func (ring *KeyRing) wrapKey(dataKey []byte) ([]byte, error) {
+	master := ring.masters[ring.currentId]
+	nonce, err := randomBytes(master.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return master.Seal(nonce, nonce, dataKey, []byte(ring.currentId)), nil
+}
+
+func (ring *KeyRing) UnwrapKey(encryption *api.FileEncryption) ([]byte, error) {
+	if encryption.Algorithm != EncryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported algorithm '%s'", encryption.Algorithm)
+	}
+	master, exists := ring.masters[encryption.KeyId]
+	if !exists {
+		return nil, fmt.Errorf("master key '%s' is not configured", encryption.KeyId)
+	}
+	nonceSize := master.NonceSize()
+	if len(encryption.WrappedKey) < nonceSize {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+	dataKey, err := master.Open(
+		nil,
+		encryption.WrappedKey[:nonceSize],
+		encryption.WrappedKey[nonceSize:],
+		[]byte(encryption.KeyId),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("data key unwrap error: %w", err)
+	}
+	return dataKey, nil
+}
+
+// Rewrap wraps data key with the current master key, encrypted content
+// stays untouched.
+func (ring *KeyRing) Rewrap(encryption *api.FileEncryption) (*api.FileEncryption, error) {
+	dataKey, err := ring.UnwrapKey(encryption)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := ring.wrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped := *encryption
+	rewrapped.KeyId = ring.currentId
+	rewrapped.WrappedKey = wrappedKey
+	return &rewrapped, nil
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"stealthy-backend/api"
+)
+
+const chunkNonceBytes int = 12
+const chunkTagBytes int64 = 16
+
+// ErrFileContentCorrupted is returned when encrypted content fails
+// authentication.
+var ErrFileContentCorrupted = errors.New("file content authentication failed")
+
+// chunkNonce derives nonce of a content chunk from the file nonce.
+func chunkNonce(nonce []byte, index int64) []byte {
+	result := make([]byte, len(nonce))
+	copy(result, nonce)
+	for i := 0; i < 8; i++ {
+		result[len(result)-1-i] ^= byte(index >> (8 * i))
+	}
+	return result
+}
+
+// chunkAdditionalData binds a chunk to its position, so chunks can not be
+// reordered, and marks the last chunk, so content can not be truncated.
+func chunkAdditionalData(index int64, last bool) []byte {
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint64(data, uint64(index))
+	if last {
+		data[8] = 1
+	}
+	return data
+}
+
+// encryptingReader encrypts content in chunks of ChunkSize bytes. The last
+// chunk is always shorter than ChunkSize, it is empty when content size
+// is a multiple of ChunkSize.
+type encryptingReader struct {
+	source    io.Reader
+	aead      cipher.AEAD
+	nonce     []byte
+	index     int64
+	plain     []byte
+	sealed    []byte
+	pending   []byte
+	finished  bool
+	chunkSize int64
+}
+
+func newEncryptingReader(
+	source io.Reader,
+	dataKey []byte,
+	encryption *api.FileEncryption,
+) (io.Reader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingReader{
+		source:    source,
+		aead:      aead,
+		nonce:     encryption.Nonce,
+		plain:     make([]byte, encryption.ChunkSize),
+		chunkSize: encryption.ChunkSize,
+	}, nil
+}
+
+func (reader *encryptingReader) Read(p []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.finished {
+			return 0, io.EOF
+		}
+		if err := reader.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+func (reader *encryptingReader) sealChunk() error {
+	n, err := io.ReadFull(reader.source, reader.plain)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	last := int64(n) < reader.chunkSize
+	reader.sealed = reader.aead.Seal(
+		reader.sealed[:0],
+		chunkNonce(reader.nonce, reader.index),
+		reader.plain[:n],
+		chunkAdditionalData(reader.index, last),
+	)
+	reader.pending = reader.sealed
+	reader.index++
+	reader.finished = last
+	return nil
+}
+
+// decryptingReader decrypts content written by encryptingReader. Chunks
+// are decrypted on demand, so the content can be read from any offset.
+type decryptingReader struct {
+	source       io.ReadSeekCloser
+	aead         cipher.AEAD
+	nonce        []byte
+	chunkSize    int64
+	chunks       int64
+	size         int64
+	sealedSize   int64
+	offset       int64
+	sourceOffset int64
+	index        int64
+	sealed       []byte
+	plain        []byte
+}
+
+func newDecryptingReader(
+	source io.ReadSeekCloser,
+	dataKey []byte,
+	encryption *api.FileEncryption,
+) (io.ReadSeekCloser, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	sealedSize, err := source.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedChunk := encryption.ChunkSize + chunkTagBytes
+	chunks := sealedSize/sealedChunk + 1
+	if sealedSize%sealedChunk < chunkTagBytes {
+		return nil, ErrFileContentCorrupted
+	}
+	return &decryptingReader{
+		source:       source,
+		aead:         aead,
+		nonce:        encryption.Nonce,
+		chunkSize:    encryption.ChunkSize,
+		chunks:       chunks,
+		size:         sealedSize - chunks*chunkTagBytes,
+		sealedSize:   sealedSize,
+		sourceOffset: sealedSize,
+		index:        -1,
+		sealed:       make([]byte, sealedChunk),
+		plain:        make([]byte, 0, encryption.ChunkSize),
+	}, nil
+}
+
+func (reader *decryptingReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+	index := reader.offset / reader.chunkSize
+	if index != reader.index {
+		if err := reader.openChunk(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, reader.plain[reader.offset-index*reader.chunkSize:])
+	reader.offset += int64(n)
+	return n, nil
+}
+
+func (reader *decryptingReader) openChunk(index int64) error {
+	reader.index = -1
+	sealedChunk := reader.chunkSize + chunkTagBytes
+	start := index * sealedChunk
+	length := min(sealedChunk, reader.sealedSize-start)
+	if reader.sourceOffset != start {
+		if _, err := reader.source.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		reader.sourceOffset = start
+	}
+
+	n, err := io.ReadFull(reader.source, reader.sealed[:length])
+	reader.sourceOffset += int64(n)
+	if err != nil {
+		return err
+	}
+	plain, err := reader.aead.Open(
+		reader.plain[:0],
+		chunkNonce(reader.nonce, index),
+		reader.sealed[:length],
+		chunkAdditionalData(index, index == reader.chunks-1),
+	)
+	if err != nil {
+		return ErrFileContentCorrupted
+	}
+	reader.plain = plain
+	reader.index = index
+	return nil
+}
+
+func (reader *decryptingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	reader.offset = offset
+	return offset, nil
+}
+
+func (reader *decryptingReader) Close() error {
+	return reader.source.Close()
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"testing"
+)
+
+func newMasterKey() string {
+	key := make([]byte, encryptionKeyBytes)
+	_, _ = rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newTestKeyRing(t *testing.T, chunkBytes int64) *KeyRing {
+	keys, err := NewKeyRing(&base.EncryptionConfig{
+		MasterKey: newMasterKey(), ChunkBytes: chunkBytes,
+	})
+	assert.Nil(t, err)
+	return keys
+}
+
+func encryptContent(t *testing.T, keys *KeyRing, content []byte) ([]byte, *api.FileEncryption) {
+	encryption, dataKey, err := keys.NewFileEncryption()
+	assert.Nil(t, err)
+	reader, err := newEncryptingReader(bytes.NewReader(content), dataKey, encryption)
+	assert.Nil(t, err)
+	sealed, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	return sealed, encryption
+}
+
+func openContent(keys *KeyRing, sealed []byte, encryption *api.FileEncryption) (io.ReadSeekCloser, error) {
+	dataKey, err := keys.UnwrapKey(encryption)
+	if err != nil {
+		return nil, err
+	}
+	return newDecryptingReader(NopSeekCloser(bytes.NewReader(sealed)), dataKey, encryption)
+}
+
+func TestNewKeyRingRejectsInvalidKey(t *testing.T) {
+	_, err := NewKeyRing(&base.EncryptionConfig{MasterKey: "c2hvcnQ=", ChunkBytes: 1024})
+	assert.NotNil(t, err)
+}
+
+func TestEncryptedContentRoundTrip(t *testing.T) {
+	keys := newTestKeyRing(t, 1024)
+	for _, size := range []int{0, 1, 1023, 1024, 1025, 4096, 5000} {
+		content := make([]byte, size)
+		_, _ = rand.Read(content)
+
+		sealed, encryption := encryptContent(t, keys, content)
+		assert.Equal(t, int64(size)+int64(size/1024+1)*chunkTagBytes, int64(len(sealed)))
+
+		stream, err := openContent(keys, sealed, encryption)
+		assert.Nil(t, err)
+		decrypted, err := io.ReadAll(stream)
+		assert.Nil(t, err)
+		assert.Equal(t, content, decrypted, "size %d", size)
+	}
+}
+
+func TestEncryptedContentSeek(t *testing.T) {
+	keys := newTestKeyRing(t, 1024)
+	content := make([]byte, 5000)
+	_, _ = rand.Read(content)
+	sealed, encryption := encryptContent(t, keys, content)
+
+	stream, err := openContent(keys, sealed, encryption)
+	assert.Nil(t, err)
+	size, err := stream.Seek(0, io.SeekEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	_, err = stream.Seek(1000, io.SeekStart)
+	assert.Nil(t, err)
+	part := make([]byte, 2100)
+	_, err = io.ReadFull(stream, part)
+	assert.Nil(t, err)
+	assert.Equal(t, content[1000:3100], part)
+}
+
+func TestEncryptedContentTampered(t *testing.T) {
+	keys := newTestKeyRing(t, 1024)
+	content := make([]byte, 3000)
+	sealed, encryption := encryptContent(t, keys, content)
+
+	tampered := bytes.Clone(sealed)
+	tampered[1500] ^= 1
+	stream, err := openContent(keys, tampered, encryption)
+	assert.Nil(t, err)
+	_, err = io.ReadAll(stream)
+	assert.True(t, errors.Is(err, ErrFileContentCorrupted))
+}
+
+func TestEncryptedContentTruncated(t *testing.T) {
+	keys := newTestKeyRing(t, 1024)
+	content := make([]byte, 3000)
+	sealed, encryption := encryptContent(t, keys, content)
+
+	// Content cut at a chunk boundary has to be detected as well.
+	stream, err := openContent(keys, sealed[:2*(1024+16)], encryption)
+	if err == nil {
+		_, err = io.ReadAll(stream)
+	}
+	assert.True(t, errors.Is(err, ErrFileContentCorrupted))
+}
+
+func TestKeyRingRewrap(t *testing.T) {
+	previousKey, currentKey := newMasterKey(), newMasterKey()
+	previousKeys, err := NewKeyRing(&base.EncryptionConfig{
+		MasterKey: previousKey, ChunkBytes: 1024,
+	})
+	assert.Nil(t, err)
+	content := []byte("secret content")
+	sealed, encryption := encryptContent(t, previousKeys, content)
+
+	keys, err := NewKeyRing(&base.EncryptionConfig{
+		MasterKey:          currentKey,
+		PreviousMasterKeys: []string{previousKey},
+		ChunkBytes:         1024,
+	})
+	assert.Nil(t, err)
+	rewrapped, err := keys.Rewrap(encryption)
+	assert.Nil(t, err)
+	assert.Equal(t, keys.CurrentKeyId(), rewrapped.KeyId)
+	assert.NotEqual(t, encryption.KeyId, rewrapped.KeyId)
+	assert.Equal(t, encryption.Nonce, rewrapped.Nonce)
+
+	// Rewrapped key opens content once the previous master key is dropped.
+	currentKeys, err := NewKeyRing(&base.EncryptionConfig{
+		MasterKey: currentKey, ChunkBytes: 1024,
+	})
+	assert.Nil(t, err)
+	stream, err := openContent(currentKeys, sealed, rewrapped)
+	assert.Nil(t, err)
+	decrypted, err := io.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.Equal(t, content, decrypted)
+}
+
+func TestKeyRingUnknownMasterKey(t *testing.T) {
+	sealed, encryption := encryptContent(t, newTestKeyRing(t, 1024), []byte("data"))
+
+	_, err := openContent(newTestKeyRing(t, 1024), sealed, encryption)
+	assert.NotNil(t, err)
+}
+
+func TestFilesServiceEncryptsContent(t *testing.T) {
+	driver := &LocalStorageDriver{Directory: t.TempDir()}
+	service := FilesService{Driver: driver, Keys: newTestKeyRing(t, 1024)}
+	content := bytes.Repeat([]byte("stealthy"), 500)
+
+	request := &api.FileData{Identifier: "encrypted"}
+	_, err := service.AddFile(request, bytes.NewReader(content))
+	assert.Nil(t, err)
+	assert.NotNil(t, request.Encryption)
+
+	stored, err := driver.Get(request.Identifier)
+	assert.Nil(t, err)
+	storedContent, _ := io.ReadAll(stored)
+	_ = stored.Close()
+	assert.NotContains(t, string(storedContent), "stealthy")
+
+	file, err := service.GetFile(request)
+	assert.Nil(t, err)
+	assert.Equal(t, content, file.Data)
+}
+
+func TestFilesServiceEncryptedWithoutKeys(t *testing.T) {
+	driver := &LocalStorageDriver{Directory: t.TempDir()}
+	request := &api.FileData{Identifier: "encrypted"}
+	_, err := FilesService{Driver: driver, Keys: newTestKeyRing(t, 1024)}.AddFile(
+		request, bytes.NewReader([]byte("data")),
+	)
+	assert.Nil(t, err)
+
+	_, err = FilesService{Driver: driver}.OpenFile(request)
+	assert.Equal(t, "File content encryption error", err.(base.ServiceError).Summary)
+}
+
+func TestFilesServiceTruncatedContent(t *testing.T) {
+	driver := &LocalStorageDriver{Directory: t.TempDir()}
+	service := FilesService{Driver: driver, Keys: newTestKeyRing(t, 1024)}
+	request := &api.FileData{Identifier: "encrypted"}
+	_, err := service.AddFile(request, bytes.NewReader([]byte("data")))
+	assert.Nil(t, err)
+
+	assert.Nil(t, driver.Delete(request.Identifier))
+	_, err = driver.Put(
+		&api.FileData{Identifier: request.Identifier}, bytes.NewReader([]byte("data")),
+	)
+	assert.Nil(t, err)
+
+	_, err = service.OpenFile(request)
+	assert.Equal(t, "File content encryption error", err.(base.ServiceError).Summary)
+	assert.True(t, errors.Is(err, ErrFileContentCorrupted))
+}
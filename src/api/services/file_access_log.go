@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"time"
+)
+
+type BaseFileAccessLogService interface {
+	AddFileAccess(access *api.FileAccess) error
+	GetFileAccesses(
+		fileId string,
+		owner string,
+		queryParams *api.PaginationQueryParameters,
+	) (*api.FileAccessListResponse, error)
+	DeleteExpiredFileAccesses() (int64, error)
+}
+
+// FileAccessLogService keeps download attempts of files. Records are kept
+// for configured days regardless of the file, so the owner can see them
+// even after the file was purged.
+type FileAccessLogService struct {
+	BaseFileAccessLogService
+	Context    *context.Context
+	Collection mongoifc.Collection
+	Config     *base.AccessLogConfig
+}
+
+func (service FileAccessLogService) AddFileAccess(access *api.FileAccess) error {
+	access.ExpirationDate = service.Config.Expiration(time.Unix(access.Time, 0))
+	if _, err := service.Collection.InsertOne(*service.Context, access); err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+// GetFileAccesses returns download attempts of a file of the owner from
+// the newest one.
+func (service FileAccessLogService) GetFileAccesses(
+	fileId string,
+	owner string,
+	queryParams *api.PaginationQueryParameters,
+) (*api.FileAccessListResponse, error) {
+	filter := bson.D{
+		primitive.E{Key: "file_identifier", Value: fileId},
+		primitive.E{Key: "owner", Value: owner},
+	}
+	total, err := service.Collection.CountDocuments(*service.Context, filter)
+	if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+
+	findOptions := options.Find().
+		SetSkip(queryParams.Skip).
+		SetLimit(queryParams.Limit).
+		SetSort(bson.D{{Key: "time", Value: -1}})
+	cursor, err := service.Collection.Find(*service.Context, filter, findOptions)
+	if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	defer func(cursor mongoifc.Cursor, ctx *context.Context) {
+		err := cursor.Close(*ctx)
+		if err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Close cursor error")
+		}
+	}(cursor, service.Context)
+
+	response := &api.FileAccessListResponse{
+		Records: []*api.FileAccess{},
+		Total:   total,
+	}
+	for cursor.Next(*service.Context) {
+		var access api.FileAccess
+		if err := cursor.Decode(&access); err != nil {
+			return nil, base.NewDatabaseError(err)
+		}
+		response.Records = append(response.Records, &access)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	return response, nil
+}
+
+// DeleteExpiredFileAccesses removes records kept longer than configured.
+func (service FileAccessLogService) DeleteExpiredFileAccesses() (int64, error) {
+	result, err := service.Collection.DeleteMany(*service.Context, bson.D{
+		primitive.E{Key: "expiration_date", Value: bson.D{
+			primitive.E{Key: "$lte", Value: time.Now()},
+		}},
+	})
+	if err != nil {
+		return 0, base.NewDatabaseError(err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
+	"go.mongodb.org/mongo-driver/mongo"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"testing"
+	"time"
+)
+
+func TestAddFileAccessSetsExpiration(t *testing.T) {
+	dbContext := context.TODO()
+	accessTime := time.Date(2023, time.November, 10, 12, 0, 0, 0, time.UTC)
+	access := &api.FileAccess{FileIdentifier: "file", Time: accessTime.Unix()}
+
+	collectionMock := new(mongoMock.Collection)
+	collectionMock.On("InsertOne", dbContext, access).Return(
+		&mongo.InsertOneResult{}, nil,
+	)
+
+	service := FileAccessLogService{
+		Context:    &dbContext,
+		Collection: collectionMock,
+		Config:     &base.AccessLogConfig{DaysRetention: 30},
+	}
+	err := service.AddFileAccess(access)
+
+	assert.Nil(t, err)
+	assert.True(t, accessTime.AddDate(0, 0, 30).Equal(access.ExpirationDate))
+}
+
+func TestAddFileAccessDatabaseError(t *testing.T) {
+	dbContext := context.TODO()
+	collectionMock := new(mongoMock.Collection)
+	collectionMock.On("InsertOne", dbContext, mock.Anything).Return(
+		nil, errors.New("connection lost"),
+	)
+
+	service := FileAccessLogService{
+		Context:    &dbContext,
+		Collection: collectionMock,
+		Config:     &base.AccessLogConfig{DaysRetention: 30},
+	}
+	err := service.AddFileAccess(&api.FileAccess{FileIdentifier: "file"})
+
+	assert.Equal(t, base.NewDatabaseError(errors.New("connection lost")), err)
+}
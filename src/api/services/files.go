@@ -1,14 +1,9 @@
 package services
 
 import (
-	"context"
 	"errors"
-	"fmt"
-	"github.com/sv-tools/mongoifc"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/sirupsen/logrus"
+	"io"
 	"net/http"
 	"stealthy-backend/api"
 	"stealthy-backend/base"
@@ -16,64 +11,155 @@ import (
 
 type BaseFilesService interface {
 	CheckFileDataExists(fileId string) (bool, error)
-	AddFile(request *api.FileData) (*api.AddFileResponse, error)
-	GetFile(fileId string) (*api.FileData, error)
+	AddFile(request *api.FileData, content io.Reader) (*api.AddFileResponse, error)
+	GetFile(file *api.FileData) (*api.FileData, error)
+	OpenFile(file *api.FileData) (io.ReadSeekCloser, error)
+	DeleteFile(fileId string) error
+	DeleteFiles(fileIds []string) (int64, error)
 }
 
+// trackingReader remembers the error returned by the underlying reader,
+// so storage errors can be told apart from request body read errors.
+type trackingReader struct {
+	Reader io.Reader
+	Err    error
+}
+
+func (reader *trackingReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		reader.Err = err
+	}
+	return n, err
+}
+
+func CloseFileStream(stream io.Closer, fileId string) {
+	if err := stream.Close(); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+			"error":      err.Error(),
+		}).Warn("Close file stream error")
+	}
+}
+
+func isFileNotFoundError(err error) bool {
+	var serviceErr base.ServiceError
+	return errors.As(err, &serviceErr) && serviceErr.Status == http.StatusNotFound
+}
+
+// FilesService keeps file content in the storage selected by Driver.
+// Content is encrypted with a new data key of each file if Keys are set.
 type FilesService struct {
 	BaseFilesService
-	Context    *context.Context
-	Collection mongoifc.Collection
+	Driver BaseStorageDriver
+	Keys   *KeyRing
 }
 
 func (service FilesService) CheckFileDataExists(fileId string) (bool, error) {
-	var data api.FileData
-	opts := options.FindOne().SetProjection(bson.D{{Key: "identifier", Value: 1}})
-	err := service.Collection.FindOne(*service.Context, bson.D{
-		primitive.E{Key: "identifier", Value: fileId},
-	}, opts).Decode(&data)
-
+	_, err := service.Driver.Stat(fileId)
 	if err == nil {
 		return true, nil
-	} else if errors.Is(err, mongo.ErrNoDocuments) {
+	} else if isFileNotFoundError(err) {
 		return false, nil
-	} else {
-		return false, base.NewDatabaseError(err)
 	}
+	return false, err
 }
 
-func (service FilesService) AddFile(request *api.FileData) (*api.AddFileResponse, error) {
+// AddFile stores file content. Encryption of the stored content is set
+// in the request, it has to be kept to read the content.
+func (service FilesService) AddFile(
+	request *api.FileData,
+	content io.Reader,
+) (*api.AddFileResponse, error) {
 	exists, err := service.CheckFileDataExists(request.Identifier)
-	if exists && err != nil {
+	if err != nil {
 		return nil, err
 	} else if exists {
-		err := base.ServiceError{
-			Summary: fmt.Sprintf("File '%s' already exist", request.Identifier),
-			Status:  http.StatusBadRequest,
+		return nil, base.NewFileAlreadyExistsError(request.Identifier)
+	}
+
+	if service.Keys != nil {
+		encryption, dataKey, err := service.Keys.NewFileEncryption()
+		if err != nil {
+			return nil, base.NewEncryptionError(err)
 		}
-		return nil, err
-	} else {
-		if _, err := service.Collection.InsertOne(*service.Context, request); err != nil {
-			return nil, base.NewDatabaseError(err)
+		content, err = newEncryptingReader(content, dataKey, encryption)
+		if err != nil {
+			return nil, base.NewEncryptionError(err)
 		}
-		return &api.AddFileResponse{Identifier: request.Identifier}, nil
+		request.Encryption = encryption
+	}
+
+	if _, err := service.Driver.Put(request, content); err != nil {
+		return nil, err
 	}
+	return &api.AddFileResponse{Identifier: request.Identifier}, nil
 }
 
-func (service FilesService) GetFile(fileId string) (*api.FileData, error) {
-	var fileData api.FileData
-	err := service.Collection.FindOne(*service.Context, bson.D{
-		primitive.E{Key: "identifier", Value: fileId},
-	}).Decode(&fileData)
+func (service FilesService) GetFile(file *api.FileData) (*api.FileData, error) {
+	stream, err := service.OpenFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseFileStream(stream, file.Identifier)
 
-	if err == nil {
-		return &fileData, nil
-	} else if errors.Is(err, mongo.ErrNoDocuments) {
-		return nil, base.ServiceError{
-			Summary: fmt.Sprintf("File '%s' not found", fileId),
-			Status:  http.StatusNotFound,
+	data, err := io.ReadAll(stream)
+	if errors.Is(err, ErrFileContentCorrupted) {
+		return nil, base.NewEncryptionError(err)
+	} else if err != nil {
+		return nil, base.NewStorageError(err)
+	}
+	return &api.FileData{Identifier: file.Identifier, Data: data}, nil
+}
+
+// OpenFile returns stream of file content, encrypted content is decrypted
+// while it is read. Damaged encrypted content fails with
+// ErrFileContentCorrupted, wrapped in encryption error if it is found
+// while the stream is opened.
+func (service FilesService) OpenFile(file *api.FileData) (io.ReadSeekCloser, error) {
+	stream, err := service.Driver.Get(file.Identifier)
+	if err != nil || file.Encryption == nil {
+		return stream, err
+	}
+	if service.Keys == nil {
+		CloseFileStream(stream, file.Identifier)
+		return nil, base.NewEncryptionError(errors.New("encryption keys not set"))
+	}
+
+	dataKey, err := service.Keys.UnwrapKey(file.Encryption)
+	if err != nil {
+		CloseFileStream(stream, file.Identifier)
+		return nil, base.NewEncryptionError(err)
+	}
+	reader, err := newDecryptingReader(stream, dataKey, file.Encryption)
+	if errors.Is(err, ErrFileContentCorrupted) {
+		CloseFileStream(stream, file.Identifier)
+		return nil, base.NewEncryptionError(err)
+	} else if err != nil {
+		CloseFileStream(stream, file.Identifier)
+		return nil, base.NewStorageError(err)
+	}
+	return reader, nil
+}
+
+// DeleteFile removes file content. Missing content is not an error, so
+// partially deleted files can be purged again.
+func (service FilesService) DeleteFile(fileId string) error {
+	if err := service.Driver.Delete(fileId); err != nil && !isFileNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+func (service FilesService) DeleteFiles(fileIds []string) (int64, error) {
+	var deleted int64
+	for _, fileId := range fileIds {
+		err := service.Driver.Delete(fileId)
+		if err == nil {
+			deleted++
+		} else if !isFileNotFoundError(err) {
+			return deleted, err
 		}
-	} else {
-		return nil, base.NewDatabaseError(err)
 	}
+	return deleted, nil
 }
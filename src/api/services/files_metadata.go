@@ -3,26 +3,38 @@ package services
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/sv-tools/mongoifc"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"net/http"
 	"stealthy-backend/api"
 	"stealthy-backend/base"
+	"time"
 )
 
 type BaseFilesMetadataService interface {
 	CheckFileMetadataExists(fileId string) (bool, error)
 	AddFileMetadata(request *api.FileMetadata) (*api.AddFileResponse, error)
 	GetFileMetadataList(
-		queryParams *api.PaginationQueryParameters,
+		queryParams *api.FileMetadataListQueryParameters,
+		username string,
+	) (*api.FileMetadataListResponse, error)
+	GetSharedFileMetadataList(
+		queryParams *api.FileMetadataListQueryParameters,
 		username string,
 	) (*api.FileMetadataListResponse, error)
 	GetFileMetadata(fileId string) (*api.FileMetadata, error)
+	GetFileMetadataByOwner(fileId string, username string) (*api.FileMetadata, error)
+	GetFilesMetadata(fileIds []string) ([]api.FileMetadata, error)
+	RegisterFileDownload(fileId string) (*api.FileMetadata, error)
+	RegisterFileAccess(access *api.FileAccess) error
+	SetScanStatus(fileId string, status string) error
+	ShareFile(fileId string, username string) error
+	UnshareFile(fileId string, username string) error
+	DeleteFileMetadata(fileId string) error
+	GetExpiredFiles(limit int64) ([]api.FileMetadata, error)
 }
 
 type FilesMetadataService struct {
@@ -31,6 +43,15 @@ type FilesMetadataService struct {
 	Collection mongoifc.Collection
 }
 
+func IsFileExpired(fileMetadata *api.FileMetadata) bool {
+	return fileMetadata.Expiration <= time.Now().Unix()
+}
+
+func IsDownloadLimitReached(fileMetadata *api.FileMetadata) bool {
+	return fileMetadata.MaxDownloads > 0 &&
+		fileMetadata.DownloadCount >= fileMetadata.MaxDownloads
+}
+
 func (service FilesMetadataService) CheckFileMetadataExists(
 	fileId string,
 ) (bool, error) {
@@ -56,24 +77,48 @@ func (service FilesMetadataService) AddFileMetadata(
 	if exists && err != nil {
 		return nil, err
 	} else if exists {
-		err := base.ServiceError{
-			Summary: fmt.Sprintf("File '%s' already exist", request.Identifier),
-			Status:  http.StatusBadRequest,
-		}
-		return nil, err
+		return nil, base.NewFileAlreadyExistsError(request.Identifier)
 	} else {
 		if _, err := service.Collection.InsertOne(
 			*service.Context, &request,
 		); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, base.NewFileAlreadyExistsError(request.Identifier)
+			}
 			return nil, base.NewDatabaseError(err)
 		}
-		return &api.AddFileResponse{Identifier: request.Identifier}, nil
+		return &api.AddFileResponse{
+			Identifier: request.Identifier,
+			SHA256:     request.SHA256,
+			MD5:        request.MD5,
+		}, nil
 	}
 }
 
 func (service FilesMetadataService) GetFileMetadataList(
-	queryParams *api.PaginationQueryParameters,
+	queryParams *api.FileMetadataListQueryParameters,
 	username string,
+) (*api.FileMetadataListResponse, error) {
+	return service.listFileMetadata(queryParams, bson.D{
+		primitive.E{Key: "username", Value: username},
+	})
+}
+
+// GetSharedFileMetadataList returns files other users shared with the user.
+func (service FilesMetadataService) GetSharedFileMetadataList(
+	queryParams *api.FileMetadataListQueryParameters,
+	username string,
+) (*api.FileMetadataListResponse, error) {
+	return service.listFileMetadata(queryParams, bson.D{
+		primitive.E{Key: "shared_with", Value: username},
+	})
+}
+
+// listFileMetadata returns a page of files matching the filter from the
+// newest one.
+func (service FilesMetadataService) listFileMetadata(
+	queryParams *api.FileMetadataListQueryParameters,
+	filter bson.D,
 ) (*api.FileMetadataListResponse, error) {
 	metadataListResponse := api.FileMetadataListResponse{}
 
@@ -81,8 +126,12 @@ func (service FilesMetadataService) GetFileMetadataList(
 		SetSkip(queryParams.Skip).
 		SetLimit(queryParams.Limit).
 		SetSort(bson.M{"creation": -1})
-	filter := bson.D{
-		primitive.E{Key: "username", Value: username},
+	if !queryParams.IncludeExpired {
+		filter = append(filter, primitive.E{
+			Key: "expiration", Value: bson.D{
+				primitive.E{Key: "$gt", Value: time.Now().Unix()},
+			},
+		})
 	}
 
 	total, err := service.Collection.CountDocuments(*service.Context, filter)
@@ -122,7 +171,7 @@ func (service FilesMetadataService) GetFileMetadataList(
 	return &metadataListResponse, nil
 }
 
-func (service FilesMetadataService) GetFileMetadata(
+func (service FilesMetadataService) findFileMetadata(
 	fileId string,
 ) (*api.FileMetadata, error) {
 	var fileData api.FileMetadata
@@ -133,11 +182,262 @@ func (service FilesMetadataService) GetFileMetadata(
 	if err == nil {
 		return &fileData, nil
 	} else if errors.Is(err, mongo.ErrNoDocuments) {
-		return nil, base.ServiceError{
-			Summary: fmt.Sprintf("File '%s' not found", fileId),
-			Status:  http.StatusNotFound,
-		}
+		return nil, base.NewFileNotFoundError(fileId)
 	} else {
 		return nil, base.NewDatabaseError(err)
 	}
 }
+
+func (service FilesMetadataService) GetFileMetadata(
+	fileId string,
+) (*api.FileMetadata, error) {
+	fileMetadata, err := service.findFileMetadata(fileId)
+	if err != nil {
+		return nil, err
+	}
+	if IsFileExpired(fileMetadata) {
+		return nil, base.NewFileExpiredError(fileId)
+	}
+	return fileMetadata, nil
+}
+
+// GetFileMetadataByOwner returns file metadata regardless of expiration
+// if the file belongs to the specified user.
+func (service FilesMetadataService) GetFileMetadataByOwner(
+	fileId string,
+	username string,
+) (*api.FileMetadata, error) {
+	fileMetadata, err := service.findFileMetadata(fileId)
+	if err != nil {
+		return nil, err
+	}
+	if fileMetadata.Username != username {
+		return nil, base.NewFileAccessDeniedError(fileId)
+	}
+	return fileMetadata, nil
+}
+
+// GetFilesMetadata returns metadata of not expired files in the order of
+// requested identifiers, missing files are left out.
+func (service FilesMetadataService) GetFilesMetadata(
+	fileIds []string,
+) ([]api.FileMetadata, error) {
+	filter := bson.D{
+		primitive.E{Key: "identifier", Value: bson.D{
+			primitive.E{Key: "$in", Value: fileIds},
+		}},
+		primitive.E{Key: "expiration", Value: bson.D{
+			primitive.E{Key: "$gt", Value: time.Now().Unix()},
+		}},
+	}
+	cursor, err := service.Collection.Find(*service.Context, filter)
+	if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	defer func(cursor mongoifc.Cursor, ctx *context.Context) {
+		err := cursor.Close(*ctx)
+		if err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Close cursor error")
+		}
+	}(cursor, service.Context)
+
+	found := map[string]api.FileMetadata{}
+	for cursor.Next(*service.Context) {
+		var fileMetadata api.FileMetadata
+		if err := cursor.Decode(&fileMetadata); err != nil {
+			return nil, base.NewDatabaseError(err)
+		}
+		found[fileMetadata.Identifier] = fileMetadata
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+
+	files := []api.FileMetadata{}
+	for _, fileId := range fileIds {
+		if fileMetadata, exists := found[fileId]; exists {
+			files = append(files, fileMetadata)
+		}
+	}
+	return files, nil
+}
+
+// RegisterFileDownload atomically increments the file download counter
+// unless the file is expired or its download limit is already reached.
+// Returns file metadata with the incremented counter.
+func (service FilesMetadataService) RegisterFileDownload(
+	fileId string,
+) (*api.FileMetadata, error) {
+	filter := bson.D{
+		primitive.E{Key: "identifier", Value: fileId},
+		primitive.E{Key: "expiration", Value: bson.D{
+			primitive.E{Key: "$gt", Value: time.Now().Unix()},
+		}},
+		primitive.E{Key: "$or", Value: bson.A{
+			bson.D{primitive.E{Key: "max_downloads", Value: bson.D{
+				primitive.E{Key: "$in", Value: bson.A{0, nil}},
+			}}},
+			bson.D{primitive.E{Key: "$expr", Value: bson.D{
+				primitive.E{Key: "$lt", Value: bson.A{
+					"$download_count", "$max_downloads",
+				}},
+			}}},
+		}},
+	}
+	update := bson.D{
+		primitive.E{Key: "$inc", Value: bson.D{
+			primitive.E{Key: "download_count", Value: 1},
+		}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var fileMetadata api.FileMetadata
+	err := service.Collection.FindOneAndUpdate(
+		*service.Context, filter, update, opts,
+	).Decode(&fileMetadata)
+	if err == nil {
+		return &fileMetadata, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewDatabaseError(err)
+	}
+
+	if _, err := service.GetFileMetadata(fileId); err != nil {
+		return nil, err
+	}
+	return nil, base.NewFileDownloadLimitError(fileId)
+}
+
+// RegisterFileAccess updates access counters of the file with recorded
+// download attempt. Files purged meanwhile are not reported.
+func (service FilesMetadataService) RegisterFileAccess(access *api.FileAccess) error {
+	_, err := service.Collection.UpdateOne(
+		*service.Context,
+		bson.D{primitive.E{Key: "identifier", Value: access.FileIdentifier}},
+		bson.D{
+			primitive.E{Key: "$inc", Value: bson.D{
+				primitive.E{Key: "access_count", Value: 1},
+				primitive.E{Key: "bytes_sent", Value: access.BytesSent},
+			}},
+			primitive.E{Key: "$max", Value: bson.D{
+				primitive.E{Key: "last_access", Value: access.Time},
+			}},
+		},
+	)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+// SetScanStatus saves result of the file malware scan.
+func (service FilesMetadataService) SetScanStatus(
+	fileId string,
+	status string,
+) error {
+	result, err := service.Collection.UpdateOne(
+		*service.Context,
+		bson.D{primitive.E{Key: "identifier", Value: fileId}},
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "scan_status", Value: status},
+		}}},
+	)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	if result.MatchedCount == 0 {
+		return base.NewFileNotFoundError(fileId)
+	}
+	return nil
+}
+
+// ShareFile grants the user access to the file, granting it again has no
+// effect.
+func (service FilesMetadataService) ShareFile(fileId string, username string) error {
+	return service.updateGrants(fileId, bson.D{primitive.E{
+		Key: "$addToSet", Value: bson.D{primitive.E{Key: "shared_with", Value: username}},
+	}})
+}
+
+// UnshareFile revokes access of the user to the file.
+func (service FilesMetadataService) UnshareFile(fileId string, username string) error {
+	return service.updateGrants(fileId, bson.D{primitive.E{
+		Key: "$pull", Value: bson.D{primitive.E{Key: "shared_with", Value: username}},
+	}})
+}
+
+func (service FilesMetadataService) updateGrants(fileId string, update bson.D) error {
+	result, err := service.Collection.UpdateOne(
+		*service.Context,
+		bson.D{primitive.E{Key: "identifier", Value: fileId}},
+		update,
+	)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	if result.MatchedCount == 0 {
+		return base.NewFileNotFoundError(fileId)
+	}
+	return nil
+}
+
+func (service FilesMetadataService) DeleteFileMetadata(fileId string) error {
+	result, err := service.Collection.DeleteOne(*service.Context, bson.D{
+		primitive.E{Key: "identifier", Value: fileId},
+	})
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	if result.DeletedCount == 0 {
+		return base.NewFileNotFoundError(fileId)
+	}
+	return nil
+}
+
+// GetExpiredFiles returns identifiers, owners and sizes of expired files,
+// the rest of metadata is not loaded.
+func (service FilesMetadataService) GetExpiredFiles(
+	limit int64,
+) ([]api.FileMetadata, error) {
+	findOptions := options.Find().
+		SetLimit(limit).
+		SetSort(bson.M{"expiration": 1}).
+		SetProjection(bson.D{
+			{Key: "identifier", Value: 1},
+			{Key: "username", Value: 1},
+			{Key: "size", Value: 1},
+		})
+	filter := bson.D{
+		primitive.E{Key: "expiration", Value: bson.D{
+			primitive.E{Key: "$lte", Value: time.Now().Unix()},
+		}},
+	}
+
+	cursor, err := service.Collection.Find(*service.Context, filter, findOptions)
+	if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	defer func(cursor mongoifc.Cursor, ctx *context.Context) {
+		err := cursor.Close(*ctx)
+		if err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Close cursor error")
+		}
+	}(cursor, service.Context)
+
+	files := []api.FileMetadata{}
+	for cursor.Next(*service.Context) {
+		var fileMetadata api.FileMetadata
+		if err := cursor.Decode(&fileMetadata); err != nil {
+			return nil, base.NewDatabaseError(err)
+		}
+		files = append(files, fileMetadata)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+
+	return files, nil
+}
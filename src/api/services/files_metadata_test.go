@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"github.com/jinzhu/copier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"testing"
+	"time"
+)
+
+func mockFindFileMetadata(
+	collectionMock *mongoMock.Collection,
+	dbContext context.Context,
+	fileMetadata *api.FileMetadata,
+	err error,
+) {
+	resultMock := new(mongoMock.SingleResult)
+	resultMock.On("Decode", &api.FileMetadata{}).Return(func(
+		v interface{},
+	) error {
+		if v != nil && err == nil {
+			copier.Copy(v, fileMetadata)
+		}
+		return err
+	})
+	collectionMock.On("FindOne", dbContext, bson.D{
+		primitive.E{Key: "identifier", Value: fileMetadata.Identifier},
+	}).Return(resultMock)
+}
+
+func TestGetFileMetadata(t *testing.T) {
+	dbContext := context.TODO()
+	fileMetadata := tests.FileMetadataFactory.Build()
+	fileMetadata.Expiration = time.Now().Add(time.Hour).Unix()
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindFileMetadata(collectionMock, dbContext, &fileMetadata, nil)
+
+	service := FilesMetadataService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.GetFileMetadata(fileMetadata.Identifier)
+
+	assert.Equal(t, &fileMetadata, result)
+	assert.Nil(t, err)
+}
+
+func TestGetFileMetadataExpired(t *testing.T) {
+	dbContext := context.TODO()
+	fileMetadata := tests.FileMetadataFactory.Build()
+	fileMetadata.Expiration = time.Now().Add(-time.Minute).Unix()
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindFileMetadata(collectionMock, dbContext, &fileMetadata, nil)
+
+	service := FilesMetadataService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.GetFileMetadata(fileMetadata.Identifier)
+
+	assert.Nil(t, result)
+	assert.Equal(t, base.NewFileExpiredError(fileMetadata.Identifier), err)
+}
+
+func TestGetFileMetadataNotFound(t *testing.T) {
+	dbContext := context.TODO()
+	fileMetadata := tests.FileMetadataFactory.Build()
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindFileMetadata(
+		collectionMock, dbContext, &fileMetadata, mongo.ErrNoDocuments,
+	)
+
+	service := FilesMetadataService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.GetFileMetadata(fileMetadata.Identifier)
+
+	assert.Nil(t, result)
+	assert.Equal(t, base.NewFileNotFoundError(fileMetadata.Identifier), err)
+}
+
+func TestRegisterFileDownloadLimitReached(t *testing.T) {
+	dbContext := context.TODO()
+	fileMetadata := tests.FileMetadataFactory.Build()
+	fileMetadata.Expiration = time.Now().Add(time.Hour).Unix()
+	fileMetadata.MaxDownloads = 1
+	fileMetadata.DownloadCount = 1
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	collectionMock := new(mongoMock.Collection)
+	updateResultMock := new(mongoMock.SingleResult)
+	updateResultMock.On("Decode", &api.FileMetadata{}).Return(mongo.ErrNoDocuments)
+	collectionMock.On(
+		"FindOneAndUpdate", dbContext, mock.Anything, mock.Anything, opts,
+	).Return(updateResultMock)
+	mockFindFileMetadata(collectionMock, dbContext, &fileMetadata, nil)
+
+	service := FilesMetadataService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.RegisterFileDownload(fileMetadata.Identifier)
+
+	assert.Nil(t, result)
+	assert.Equal(t, base.NewFileDownloadLimitError(fileMetadata.Identifier), err)
+}
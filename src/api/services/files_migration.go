@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+)
+
+const migrationBatchSize int32 = 16
+
+type MigrationResult struct {
+	Migrated int64
+	Skipped  int64
+}
+
+// FilesMigration moves file content stored as documents of the files
+// collection into another storage backend. Content is copied as stored,
+// so encrypted content stays readable with keys kept in metadata.
+type FilesMigration struct {
+	Source *MongoStorageDriver
+	Target BaseStorageDriver
+}
+
+// MigrateFiles copies every file document to the target storage and
+// deletes the document afterwards, so the migration can be restarted
+// after a failure. Files already present in the target are not copied.
+func (migration FilesMigration) MigrateFiles() (*MigrationResult, error) {
+	result := &MigrationResult{}
+	ctx := migration.Source.Context
+
+	cursor, err := migration.Source.Collection.Find(
+		*ctx, bson.D{}, options.Find().SetBatchSize(migrationBatchSize),
+	)
+	if err != nil {
+		return result, base.NewDatabaseError(err)
+	}
+	defer func(cursor mongoifc.Cursor, ctx *context.Context) {
+		err := cursor.Close(*ctx)
+		if err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Close cursor error")
+		}
+	}(cursor, ctx)
+
+	for cursor.Next(*ctx) {
+		var fileData api.FileData
+		if err := cursor.Decode(&fileData); err != nil {
+			return result, base.NewDatabaseError(err)
+		}
+		migrated, err := migration.migrateFile(&fileData)
+		if err != nil {
+			return result, err
+		}
+		if migrated {
+			result.Migrated++
+		} else {
+			result.Skipped++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return result, base.NewDatabaseError(err)
+	}
+	return result, nil
+}
+
+func (migration FilesMigration) migrateFile(fileData *api.FileData) (bool, error) {
+	_, err := migration.Target.Stat(fileData.Identifier)
+	exists := err == nil
+	if err != nil && !isFileNotFoundError(err) {
+		return false, err
+	}
+	if !exists {
+		_, err = migration.Target.Put(&api.FileData{
+			Identifier:     fileData.Identifier,
+			ExpirationDate: fileData.ExpirationDate,
+		}, bytes.NewReader(fileData.Data))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = migration.Source.Delete(fileData.Identifier)
+	if err != nil && !isFileNotFoundError(err) {
+		return false, err
+	}
+	base.Logger.WithFields(logrus.Fields{
+		"identifier": fileData.Identifier,
+		"copied":     !exists,
+	}).Debug("File migrated")
+	return !exists, nil
+}
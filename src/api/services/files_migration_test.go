@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jinzhu/copier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"testing"
+)
+
+func mockFilesCursor(
+	collectionMock *mongoMock.Collection,
+	dbContext context.Context,
+	files []api.FileData,
+) *mongoMock.Cursor {
+	cursorMock := new(mongoMock.Cursor)
+	collectionMock.On(
+		"Find", dbContext, bson.D{},
+		options.Find().SetBatchSize(migrationBatchSize),
+	).Return(cursorMock, nil)
+	for _, file := range files {
+		file := file
+		cursorMock.On("Next", dbContext).Return(true).Once()
+		cursorMock.On("Decode", &api.FileData{}).Return(func(v interface{}) error {
+			return copier.Copy(v, &file)
+		}).Once()
+	}
+	cursorMock.On("Next", dbContext).Return(false).Once()
+	cursorMock.On("Close", dbContext).Return(nil)
+	return cursorMock
+}
+
+func mockDeleteFileDocument(
+	collectionMock *mongoMock.Collection,
+	dbContext context.Context,
+	fileId string,
+) {
+	collectionMock.On("DeleteOne", dbContext, bson.D{
+		primitive.E{Key: "identifier", Value: fileId},
+	}).Return(&mongo.DeleteResult{DeletedCount: 1}, nil)
+}
+
+func TestMigrateFiles(t *testing.T) {
+	dbContext := context.TODO()
+	newFile := tests.FileDataFactory.Build()
+	migratedFile := tests.FileDataFactory.Build()
+
+	collectionMock := new(mongoMock.Collection)
+	cursorMock := mockFilesCursor(
+		collectionMock, dbContext, []api.FileData{newFile, migratedFile},
+	)
+	cursorMock.On("Err").Return(nil)
+	mockDeleteFileDocument(collectionMock, dbContext, newFile.Identifier)
+	mockDeleteFileDocument(collectionMock, dbContext, migratedFile.Identifier)
+
+	targetMock := tests.NewBaseStorageDriver(t)
+	targetMock.On("Stat", newFile.Identifier).Return(
+		nil, base.NewFileNotFoundError(newFile.Identifier),
+	)
+	targetMock.On("Stat", migratedFile.Identifier).Return(
+		&api.StoredFileInfo{Identifier: migratedFile.Identifier}, nil,
+	)
+	targetMock.On("Put", &api.FileData{
+		Identifier:     newFile.Identifier,
+		ExpirationDate: newFile.ExpirationDate,
+	}, mock.Anything).Return(int64(len(newFile.Data)), nil)
+
+	migration := FilesMigration{
+		Source: &MongoStorageDriver{Context: &dbContext, Collection: collectionMock},
+		Target: targetMock,
+	}
+	result, err := migration.MigrateFiles()
+
+	assert.Nil(t, err)
+	assert.Equal(t, &MigrationResult{Migrated: 1, Skipped: 1}, result)
+	collectionMock.AssertExpectations(t)
+}
+
+func TestMigrateFilesKeepsDocumentOnError(t *testing.T) {
+	dbContext := context.TODO()
+	file := tests.FileDataFactory.Build()
+	expectedError := base.NewDatabaseError(errors.New("connection lost"))
+
+	collectionMock := new(mongoMock.Collection)
+	cursorMock := new(mongoMock.Cursor)
+	collectionMock.On(
+		"Find", dbContext, bson.D{},
+		options.Find().SetBatchSize(migrationBatchSize),
+	).Return(cursorMock, nil)
+	cursorMock.On("Next", dbContext).Return(true).Once()
+	cursorMock.On("Decode", &api.FileData{}).Return(func(v interface{}) error {
+		return copier.Copy(v, &file)
+	})
+	cursorMock.On("Close", dbContext).Return(nil)
+
+	targetMock := tests.NewBaseStorageDriver(t)
+	targetMock.On("Stat", file.Identifier).Return(
+		nil, base.NewFileNotFoundError(file.Identifier),
+	)
+	targetMock.On("Put", mock.Anything, mock.Anything).Return(
+		int64(0), expectedError,
+	)
+
+	migration := FilesMigration{
+		Source: &MongoStorageDriver{Context: &dbContext, Collection: collectionMock},
+		Target: targetMock,
+	}
+	result, err := migration.MigrateFiles()
+
+	assert.Equal(t, expectedError, err)
+	assert.Equal(t, &MigrationResult{}, result)
+	collectionMock.AssertNotCalled(t, "DeleteOne", mock.Anything, mock.Anything)
+}
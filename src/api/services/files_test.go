@@ -1,15 +1,10 @@
 package services
 
 import (
-	"context"
+	"bytes"
+	"errors"
 	"fmt"
-	"github.com/jinzhu/copier"
 	"github.com/stretchr/testify/assert"
-	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 	"stealthy-backend/api"
 	"stealthy-backend/base"
@@ -18,19 +13,14 @@ import (
 )
 
 func TestCheckFileExists(t *testing.T) {
-	opts := options.FindOne().SetProjection(bson.D{{Key: "identifier", Value: 1}})
-	dbContext := context.TODO()
 	fileData := tests.FileDataFactory.Build()
-	emptyFileData := api.FileData{}
 
-	collectionMock := new(mongoMock.Collection)
-	resultMock := new(mongoMock.SingleResult)
-	resultMock.On("Decode", &emptyFileData).Return(nil)
-	collectionMock.On("FindOne", dbContext, bson.D{
-		primitive.E{Key: "identifier", Value: fileData.Identifier},
-	}, opts).Return(resultMock)
+	driverMock := new(tests.BaseStorageDriver)
+	driverMock.On("Stat", fileData.Identifier).Return(
+		&api.StoredFileInfo{Identifier: fileData.Identifier}, nil,
+	)
 
-	service := FilesService{Context: &dbContext, Collection: collectionMock}
+	service := FilesService{Driver: driverMock}
 	result, err := service.CheckFileDataExists(fileData.Identifier)
 
 	assert.Equal(t, true, result)
@@ -38,19 +28,14 @@ func TestCheckFileExists(t *testing.T) {
 }
 
 func TestCheckFileDoesNotExist(t *testing.T) {
-	opts := options.FindOne().SetProjection(bson.D{{Key: "identifier", Value: 1}})
-	dbContext := context.TODO()
 	fileData := tests.FileDataFactory.Build()
-	emptyFileData := api.FileData{}
 
-	collectionMock := new(mongoMock.Collection)
-	resultMock := new(mongoMock.SingleResult)
-	resultMock.On("Decode", &emptyFileData).Return(mongo.ErrNoDocuments)
-	collectionMock.On("FindOne", dbContext, bson.D{
-		primitive.E{Key: "identifier", Value: fileData.Identifier},
-	}, opts).Return(resultMock)
+	driverMock := new(tests.BaseStorageDriver)
+	driverMock.On("Stat", fileData.Identifier).Return(
+		nil, base.NewFileNotFoundError(fileData.Identifier),
+	)
 
-	service := FilesService{Context: &dbContext, Collection: collectionMock}
+	service := FilesService{Driver: driverMock}
 	result, err := service.CheckFileDataExists(fileData.Identifier)
 
 	assert.Equal(t, false, result)
@@ -58,95 +43,72 @@ func TestCheckFileDoesNotExist(t *testing.T) {
 }
 
 func TestAddFile(t *testing.T) {
-	opts := options.FindOne().SetProjection(bson.D{{Key: "identifier", Value: 1}})
-	dbContext := context.TODO()
 	fileDataToAdd := tests.FileDataFactory.Build()
-	emptyFileData := api.FileData{}
+	content := bytes.NewReader(fileDataToAdd.Data)
 	expectedResult := api.AddFileResponse{Identifier: fileDataToAdd.Identifier}
 
-	collectionMock := new(mongoMock.Collection)
-	resultMock := new(mongoMock.SingleResult)
-	resultMock.On("Decode", &emptyFileData).Return(mongo.ErrNoDocuments)
-	collectionMock.On("FindOne", dbContext, bson.D{
-		primitive.E{Key: "identifier", Value: fileDataToAdd.Identifier},
-	}, opts).Return(resultMock)
-	collectionMock.On("InsertOne", dbContext, &fileDataToAdd).Return(
-		nil, nil,
+	driverMock := new(tests.BaseStorageDriver)
+	driverMock.On("Stat", fileDataToAdd.Identifier).Return(
+		nil, base.NewFileNotFoundError(fileDataToAdd.Identifier),
+	)
+	driverMock.On("Put", &fileDataToAdd, content).Return(
+		int64(len(fileDataToAdd.Data)), nil,
 	)
 
-	service := FilesService{Context: &dbContext, Collection: collectionMock}
-	result, err := service.AddFile(&fileDataToAdd)
+	service := FilesService{Driver: driverMock}
+	result, err := service.AddFile(&fileDataToAdd, content)
 
 	assert.Equal(t, expectedResult, *result)
 	assert.Nil(t, err)
 }
 
 func TestAddFileAlreadyExist(t *testing.T) {
-	opts := options.FindOne().SetProjection(bson.D{{Key: "identifier", Value: 1}})
-	dbContext := context.TODO()
 	fileDataToAdd := tests.FileDataFactory.Build()
 	expectedError := base.ServiceError{
 		Summary: fmt.Sprintf("File '%s' already exist", fileDataToAdd.Identifier),
 		Status:  http.StatusBadRequest,
 	}
 
-	collectionMock := new(mongoMock.Collection)
-	resultMock := new(mongoMock.SingleResult)
-	resultMock.On("Decode", &api.FileData{}).Return(nil)
-	collectionMock.On("FindOne", dbContext, bson.D{
-		primitive.E{Key: "identifier", Value: fileDataToAdd.Identifier},
-	}, opts).Return(resultMock)
-	collectionMock.On("InsertOne", dbContext, &fileDataToAdd).Return(
-		nil, nil,
+	driverMock := new(tests.BaseStorageDriver)
+	driverMock.On("Stat", fileDataToAdd.Identifier).Return(
+		&api.StoredFileInfo{Identifier: fileDataToAdd.Identifier}, nil,
 	)
 
-	service := FilesService{Context: &dbContext, Collection: collectionMock}
-	result, err := service.AddFile(&fileDataToAdd)
+	service := FilesService{Driver: driverMock}
+	result, err := service.AddFile(&fileDataToAdd, bytes.NewReader(fileDataToAdd.Data))
 
 	assert.Nil(t, result)
 	assert.Equal(t, expectedError, err)
+	driverMock.AssertNotCalled(t, "Put")
 }
 
 func TestGetFile(t *testing.T) {
-	dbContext := context.TODO()
 	fileData := tests.FileDataFactory.Build()
-	emptyFileData := api.FileData{}
-
-	collectionMock := new(mongoMock.Collection)
-	resultMock := new(mongoMock.SingleResult)
-	resultMock.On("Decode", &emptyFileData).Return(func(
-		v interface{},
-	) error {
-		if v != nil {
-			copier.Copy(v, &fileData)
-		}
-		return nil
-	})
-	collectionMock.On("FindOne", dbContext, bson.D{
-		primitive.E{Key: "identifier", Value: fileData.Identifier},
-	}).Return(resultMock)
-
-	service := FilesService{Context: &dbContext, Collection: collectionMock}
-	result, err := service.GetFile(fileData.Identifier)
-
-	assert.Equal(t, &fileData, result)
+
+	driverMock := new(tests.BaseStorageDriver)
+	driverMock.On("Get", fileData.Identifier).Return(
+		NopSeekCloser(bytes.NewReader(fileData.Data)), nil,
+	)
+
+	service := FilesService{Driver: driverMock}
+	result, err := service.GetFile(&api.FileData{Identifier: fileData.Identifier})
+
+	assert.Equal(t, &api.FileData{
+		Identifier: fileData.Identifier, Data: fileData.Data,
+	}, result)
 	assert.Nil(t, err)
 }
 
 func TestGetFileNotFound(t *testing.T) {
-	dbContext := context.TODO()
 	fileData := tests.FileDataFactory.Build()
-	emptyFileData := api.FileData{}
 
-	collectionMock := new(mongoMock.Collection)
-	resultMock := new(mongoMock.SingleResult)
-	resultMock.On("Decode", &emptyFileData).Return(mongo.ErrNoDocuments)
-	collectionMock.On("FindOne", dbContext, bson.D{
-		primitive.E{Key: "identifier", Value: fileData.Identifier},
-	}).Return(resultMock)
+	driverMock := new(tests.BaseStorageDriver)
+	driverMock.On("Get", fileData.Identifier).Return(
+		nil, base.NewFileNotFoundError(fileData.Identifier),
+	)
 
-	service := FilesService{Context: &dbContext, Collection: collectionMock}
-	result, err := service.GetFile(fileData.Identifier)
+	service := FilesService{Driver: driverMock}
+	result, err := service.GetFile(&api.FileData{Identifier: fileData.Identifier})
 
 	assert.Nil(t, result)
 	assert.Equal(t, base.ServiceError{
@@ -154,3 +116,30 @@ func TestGetFileNotFound(t *testing.T) {
 		Status:  http.StatusNotFound,
 	}, err)
 }
+
+func TestDeleteFilesSkipsMissing(t *testing.T) {
+	driverMock := new(tests.BaseStorageDriver)
+	driverMock.On("Delete", "first").Return(nil)
+	driverMock.On("Delete", "second").Return(base.NewFileNotFoundError("second"))
+	driverMock.On("Delete", "third").Return(nil)
+
+	service := FilesService{Driver: driverMock}
+	deleted, err := service.DeleteFiles([]string{"first", "second", "third"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), deleted)
+}
+
+func TestDeleteFilesStopsOnError(t *testing.T) {
+	expectedError := base.NewStorageError(errors.New("permission denied"))
+
+	driverMock := new(tests.BaseStorageDriver)
+	driverMock.On("Delete", "first").Return(expectedError)
+
+	service := FilesService{Driver: driverMock}
+	deleted, err := service.DeleteFiles([]string{"first", "second"})
+
+	assert.Equal(t, expectedError, err)
+	assert.Equal(t, int64(0), deleted)
+	driverMock.AssertNotCalled(t, "Delete", "second")
+}
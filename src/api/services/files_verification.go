@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"hash"
+	"io"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"time"
+)
+
+type VerificationResult struct {
+	Verified  int64
+	Skipped   int64
+	Corrupted []string
+	Missing   []string
+}
+
+// Failed reports if content of any file is lost or damaged.
+func (result *VerificationResult) Failed() bool {
+	return len(result.Corrupted) > 0 || len(result.Missing) > 0
+}
+
+// FilesVerification re-hashes stored content of not expired files and
+// compares it with digests saved on upload.
+type FilesVerification struct {
+	Context      *context.Context
+	Collection   mongoifc.Collection
+	FilesService BaseFilesService
+}
+
+// VerifyFiles checks every not expired file. Files uploaded before content
+// digests were stored are skipped.
+func (verification FilesVerification) VerifyFiles() (*VerificationResult, error) {
+	result := &VerificationResult{Corrupted: []string{}, Missing: []string{}}
+	ctx := verification.Context
+
+	// Expiration date is missing in metadata of files uploaded before it
+	// was introduced, expiration timestamp is set for every file.
+	filter := bson.D{
+		primitive.E{Key: "expiration", Value: bson.D{
+			primitive.E{Key: "$gt", Value: time.Now().Unix()},
+		}},
+	}
+	cursor, err := verification.Collection.Find(
+		*ctx, filter, options.Find().SetBatchSize(migrationBatchSize),
+	)
+	if err != nil {
+		return result, base.NewDatabaseError(err)
+	}
+	defer func(cursor mongoifc.Cursor, ctx *context.Context) {
+		err := cursor.Close(*ctx)
+		if err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Close cursor error")
+		}
+	}(cursor, ctx)
+
+	for cursor.Next(*ctx) {
+		var fileMetadata api.FileMetadata
+		if err := cursor.Decode(&fileMetadata); err != nil {
+			return result, base.NewDatabaseError(err)
+		}
+		if fileMetadata.SHA256 == "" {
+			result.Skipped++
+			continue
+		}
+		if err := verification.verifyFile(&fileMetadata, result); err != nil {
+			return result, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return result, base.NewDatabaseError(err)
+	}
+	return result, nil
+}
+
+func (verification FilesVerification) verifyFile(
+	fileMetadata *api.FileMetadata,
+	result *VerificationResult,
+) error {
+	fileId := fileMetadata.Identifier
+	stream, err := verification.FilesService.OpenFile(&api.FileData{
+		Identifier: fileId,
+		Encryption: fileMetadata.Encryption,
+	})
+	if errors.Is(err, ErrFileContentCorrupted) {
+		verification.reportCorrupted(fileId, result)
+		return nil
+	} else if isFileNotFoundError(err) {
+		base.Logger.WithFields(logrus.Fields{
+			"identifier": fileId,
+		}).Error("File content is missing")
+		result.Missing = append(result.Missing, fileId)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer CloseFileStream(stream, fileId)
+
+	digests := map[string]hash.Hash{fileMetadata.SHA256: sha256.New()}
+	if fileMetadata.MD5 != "" {
+		digests[fileMetadata.MD5] = md5.New()
+	}
+	writers := make([]io.Writer, 0, len(digests))
+	for _, digest := range digests {
+		writers = append(writers, digest)
+	}
+	_, err = io.Copy(io.MultiWriter(writers...), stream)
+	if errors.Is(err, ErrFileContentCorrupted) {
+		verification.reportCorrupted(fileId, result)
+		return nil
+	} else if err != nil {
+		return base.NewStorageError(err)
+	}
+
+	for expected, digest := range digests {
+		if hex.EncodeToString(digest.Sum(nil)) != expected {
+			verification.reportCorrupted(fileId, result)
+			return nil
+		}
+	}
+	result.Verified++
+	return nil
+}
+
+func (verification FilesVerification) reportCorrupted(
+	fileId string,
+	result *VerificationResult,
+) {
+	base.Logger.WithFields(logrus.Fields{
+		"identifier": fileId,
+	}).Error("File content is corrupted")
+	result.Corrupted = append(result.Corrupted, fileId)
+}
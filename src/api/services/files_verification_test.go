@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/copier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
+	"go.mongodb.org/mongo-driver/bson"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"testing"
+)
+
+func mockFilesMetadataCursor(
+	collectionMock *mongoMock.Collection,
+	dbContext context.Context,
+	files []api.FileMetadata,
+) *mongoMock.Cursor {
+	cursorMock := new(mongoMock.Cursor)
+	collectionMock.On("Find", dbContext, mock.Anything, mock.Anything).Return(
+		cursorMock, nil,
+	)
+	for _, file := range files {
+		file := file
+		cursorMock.On("Next", dbContext).Return(true).Once()
+		cursorMock.On("Decode", &api.FileMetadata{}).Return(func(v interface{}) error {
+			return copier.Copy(v, &file)
+		}).Once()
+	}
+	cursorMock.On("Next", dbContext).Return(false).Once()
+	cursorMock.On("Close", dbContext).Return(nil)
+	return cursorMock
+}
+
+func newVerifiedFile(content string) api.FileMetadata {
+	fileMetadata := tests.FileMetadataFactory.Build()
+	fileMetadata.SHA256 = fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	fileMetadata.MD5 = fmt.Sprintf("%x", md5.Sum([]byte(content)))
+	return fileMetadata
+}
+
+func mockFileContent(filesMock *tests.BaseFilesService, fileId string, content string) {
+	filesMock.On("OpenFile", &api.FileData{Identifier: fileId}).Return(
+		NopSeekCloser(bytes.NewReader([]byte(content))), nil,
+	)
+}
+
+func TestVerifyFiles(t *testing.T) {
+	dbContext := context.TODO()
+	validFile := newVerifiedFile("data")
+	corruptedFile := newVerifiedFile("data")
+	missingFile := newVerifiedFile("data")
+	legacyFile := tests.FileMetadataFactory.Build()
+	legacyFile.SHA256 = ""
+
+	collectionMock := new(mongoMock.Collection)
+	cursorMock := mockFilesMetadataCursor(collectionMock, dbContext, []api.FileMetadata{
+		validFile, corruptedFile, missingFile, legacyFile,
+	})
+	cursorMock.On("Err").Return(nil)
+
+	filesMock := tests.NewBaseFilesService(t)
+	mockFileContent(filesMock, validFile.Identifier, "data")
+	mockFileContent(filesMock, corruptedFile.Identifier, "dada")
+	filesMock.On("OpenFile", &api.FileData{Identifier: missingFile.Identifier}).Return(
+		nil, base.NewFileNotFoundError(missingFile.Identifier),
+	)
+
+	verification := FilesVerification{
+		Context:      &dbContext,
+		Collection:   collectionMock,
+		FilesService: filesMock,
+	}
+	result, err := verification.VerifyFiles()
+
+	assert.Nil(t, err)
+	assert.Equal(t, &VerificationResult{
+		Verified:  1,
+		Skipped:   1,
+		Corrupted: []string{corruptedFile.Identifier},
+		Missing:   []string{missingFile.Identifier},
+	}, result)
+	assert.True(t, result.Failed())
+}
+
+func TestVerifyFilesStorageError(t *testing.T) {
+	dbContext := context.TODO()
+	file := newVerifiedFile("data")
+	expectedError := base.NewStorageError(errors.New("connection refused"))
+
+	collectionMock := new(mongoMock.Collection)
+	mockFilesMetadataCursor(collectionMock, dbContext, []api.FileMetadata{file})
+
+	filesMock := tests.NewBaseFilesService(t)
+	filesMock.On("OpenFile", &api.FileData{Identifier: file.Identifier}).Return(
+		nil, expectedError,
+	)
+
+	verification := FilesVerification{
+		Context:      &dbContext,
+		Collection:   collectionMock,
+		FilesService: filesMock,
+	}
+	result, err := verification.VerifyFiles()
+
+	assert.Equal(t, expectedError, err)
+	assert.False(t, result.Failed())
+}
+
+func TestVerifyFilesSelectsByExpiration(t *testing.T) {
+	dbContext := context.TODO()
+	file := newVerifiedFile("data")
+
+	collectionMock := new(mongoMock.Collection)
+	cursorMock := mockFilesMetadataCursor(collectionMock, dbContext, []api.FileMetadata{file})
+	cursorMock.On("Err").Return(nil)
+
+	filesMock := tests.NewBaseFilesService(t)
+	mockFileContent(filesMock, file.Identifier, "data")
+
+	verification := FilesVerification{
+		Context:      &dbContext,
+		Collection:   collectionMock,
+		FilesService: filesMock,
+	}
+	result, err := verification.VerifyFiles()
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Verified)
+	// Expiration timestamp is set also for files uploaded before
+	// expiration date was introduced.
+	filter := collectionMock.Calls[0].Arguments.Get(1).(bson.D)
+	assert.Equal(t, "expiration", filter[0].Key)
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/base"
+)
+
+type collectionIndex struct {
+	Collection base.Collection
+	Model      mongo.IndexModel
+}
+
+type IndexesService struct {
+	Context        *context.Context
+	Database       mongoifc.Database
+	FilesExpConfig *base.FilesExpirationConfig
+}
+
+func newIndex(
+	collection base.Collection,
+	name string,
+	keys bson.D,
+	unique bool,
+) collectionIndex {
+	indexOptions := options.Index().SetName(name)
+	if unique {
+		indexOptions.SetUnique(true)
+	}
+	return collectionIndex{
+		Collection: collection,
+		Model:      mongo.IndexModel{Keys: keys, Options: indexOptions},
+	}
+}
+
+func newTTLIndex(collection base.Collection, name string) collectionIndex {
+	return collectionIndex{
+		Collection: collection,
+		Model: mongo.IndexModel{
+			Keys: bson.D{{Key: "expiration_date", Value: int32(1)}},
+			Options: options.Index().
+				SetName(name).
+				SetExpireAfterSeconds(0),
+		},
+	}
+}
+
+// ttlIndexes only remove content kept in files collection. Metadata of
+// expired files is purged by the sweeper, so quotas, share links and
+// content of other storage drivers are released together with it.
+func ttlIndexes() []collectionIndex {
+	return []collectionIndex{
+		newTTLIndex(base.Files, "expiration_date_ttl"),
+	}
+}
+
+// removedIndexes were created by previous versions and are always dropped.
+func removedIndexes() []collectionIndex {
+	return []collectionIndex{
+		newTTLIndex(base.FilesMetadata, "expiration_date_ttl"),
+	}
+}
+
+func requiredIndexes() []collectionIndex {
+	return []collectionIndex{
+		newIndex(
+			base.Files,
+			"identifier_unique",
+			bson.D{{Key: "identifier", Value: int32(1)}},
+			true,
+		),
+		newIndex(
+			base.FilesMetadata,
+			"identifier_unique",
+			bson.D{{Key: "identifier", Value: int32(1)}},
+			true,
+		),
+		newIndex(
+			base.FilesMetadata,
+			"username_creation",
+			bson.D{
+				{Key: "username", Value: int32(1)},
+				{Key: "creation", Value: int32(-1)},
+			},
+			false,
+		),
+		newIndex(
+			base.FilesMetadata,
+			"shared_with_creation",
+			bson.D{
+				{Key: "shared_with", Value: int32(1)},
+				{Key: "creation", Value: int32(-1)},
+			},
+			false,
+		),
+		newIndex(
+			base.Uploads,
+			"identifier_unique",
+			bson.D{{Key: "identifier", Value: int32(1)}},
+			true,
+		),
+		newIndex(
+			base.Bundles,
+			"identifier_unique",
+			bson.D{{Key: "identifier", Value: int32(1)}},
+			true,
+		),
+		newIndex(
+			base.ShareLinks,
+			"token_unique",
+			bson.D{{Key: "token", Value: int32(1)}},
+			true,
+		),
+		newIndex(
+			base.ShareLinks,
+			"file_identifier_creation",
+			bson.D{
+				{Key: "file_identifier", Value: int32(1)},
+				{Key: "creation", Value: int32(-1)},
+			},
+			false,
+		),
+		newIndex(
+			base.FileAccessLog,
+			"file_identifier_owner_time",
+			bson.D{
+				{Key: "file_identifier", Value: int32(1)},
+				{Key: "owner", Value: int32(1)},
+				{Key: "time", Value: int32(-1)},
+			},
+			false,
+		),
+		newIndex(
+			base.FileAccessLog,
+			"expiration_date",
+			bson.D{{Key: "expiration_date", Value: int32(1)}},
+			false,
+		),
+		newIndex(
+			base.Users,
+			"username_unique",
+			bson.D{{Key: "username", Value: int32(1)}},
+			true,
+		),
+	}
+}
+
+// EnsureIndexes creates indexes the services rely on. Indexes whose
+// definition differs from the expected one are recreated, TTL indexes
+// are dropped when disabled in configuration.
+func (service IndexesService) EnsureIndexes() error {
+	indexes := requiredIndexes()
+	obsoleteIndexes := removedIndexes()
+	if service.FilesExpConfig.TTLIndexes {
+		indexes = append(indexes, ttlIndexes()...)
+	} else {
+		obsoleteIndexes = append(obsoleteIndexes, ttlIndexes()...)
+	}
+
+	for _, index := range indexes {
+		if err := service.ensureIndex(index); err != nil {
+			return err
+		}
+	}
+	for _, index := range obsoleteIndexes {
+		if err := service.dropIndex(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (service IndexesService) findIndex(
+	index collectionIndex,
+) (*mongo.IndexSpecification, error) {
+	specifications, err := service.Database.Collection(
+		string(index.Collection),
+	).Indexes().ListSpecifications(*service.Context)
+	if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	for _, specification := range specifications {
+		if specification.Name == *index.Model.Options.Name {
+			return specification, nil
+		}
+	}
+	return nil, nil
+}
+
+func (service IndexesService) ensureIndex(index collectionIndex) error {
+	indexView := service.Database.Collection(string(index.Collection)).Indexes()
+	logFields := logrus.Fields{
+		"collection": index.Collection,
+		"index":      *index.Model.Options.Name,
+	}
+
+	specification, err := service.findIndex(index)
+	if err != nil {
+		return err
+	}
+	if specification != nil {
+		if IndexMatchesSpecification(&index.Model, specification) {
+			return nil
+		}
+		base.Logger.WithFields(logFields).Info("Recreating outdated index")
+		if _, err := indexView.DropOne(
+			*service.Context, specification.Name,
+		); err != nil {
+			return base.NewDatabaseError(err)
+		}
+	} else {
+		base.Logger.WithFields(logFields).Info("Creating index")
+	}
+
+	if _, err := indexView.CreateOne(*service.Context, index.Model); err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+func (service IndexesService) dropIndex(index collectionIndex) error {
+	specification, err := service.findIndex(index)
+	if err != nil || specification == nil {
+		return err
+	}
+
+	base.Logger.WithFields(logrus.Fields{
+		"collection": index.Collection,
+		"index":      specification.Name,
+	}).Info("Dropping disabled index")
+	if _, err := service.Database.Collection(
+		string(index.Collection),
+	).Indexes().DropOne(*service.Context, specification.Name); err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+func IndexMatchesSpecification(
+	model *mongo.IndexModel,
+	specification *mongo.IndexSpecification,
+) bool {
+	keys := model.Keys.(bson.D)
+	elements, err := specification.KeysDocument.Elements()
+	if err != nil || len(elements) != len(keys) {
+		return false
+	}
+	for i, element := range elements {
+		value, ok := element.Value().AsInt64OK()
+		if !ok || element.Key() != keys[i].Key ||
+			value != int64(keys[i].Value.(int32)) {
+			return false
+		}
+	}
+
+	expectedUnique := model.Options.Unique != nil && *model.Options.Unique
+	actualUnique := specification.Unique != nil && *specification.Unique
+	if expectedUnique != actualUnique {
+		return false
+	}
+
+	if model.Options.ExpireAfterSeconds == nil {
+		return specification.ExpireAfterSeconds == nil
+	}
+	return specification.ExpireAfterSeconds != nil &&
+		*specification.ExpireAfterSeconds == *model.Options.ExpireAfterSeconds
+}
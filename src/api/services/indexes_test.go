@@ -0,0 +1,75 @@
+package services
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"stealthy-backend/base"
+	"testing"
+)
+
+func buildIndexSpecification(
+	t *testing.T,
+	keys bson.D,
+	unique *bool,
+	expireAfterSeconds *int32,
+) *mongo.IndexSpecification {
+	keysDocument, err := bson.Marshal(keys)
+	assert.NoError(t, err)
+	return &mongo.IndexSpecification{
+		Name:               "index",
+		KeysDocument:       keysDocument,
+		Unique:             unique,
+		ExpireAfterSeconds: expireAfterSeconds,
+	}
+}
+
+func TestIndexMatchesSpecification(t *testing.T) {
+	unique := true
+	index := newIndex(
+		base.FilesMetadata,
+		"index",
+		bson.D{{Key: "username", Value: int32(1)}, {Key: "creation", Value: int32(-1)}},
+		true,
+	)
+	specification := buildIndexSpecification(t, bson.D{
+		{Key: "username", Value: 1.0},
+		{Key: "creation", Value: int64(-1)},
+	}, &unique, nil)
+
+	assert.True(t, IndexMatchesSpecification(&index.Model, specification))
+}
+
+func TestIndexDoesNotMatchSpecification(t *testing.T) {
+	unique := true
+	expireAfterSeconds := int32(3600)
+	uniqueIndex := newIndex(
+		base.Files,
+		"index",
+		bson.D{{Key: "identifier", Value: int32(1)}},
+		true,
+	)
+	ttlIndex := newTTLIndex(base.Files, "index")
+
+	assert.False(t, IndexMatchesSpecification(
+		&uniqueIndex.Model,
+		buildIndexSpecification(
+			t, bson.D{{Key: "identifier", Value: int32(1)}}, nil, nil,
+		),
+	))
+	assert.False(t, IndexMatchesSpecification(
+		&uniqueIndex.Model,
+		buildIndexSpecification(
+			t, bson.D{{Key: "identifier", Value: int32(-1)}}, &unique, nil,
+		),
+	))
+	assert.False(t, IndexMatchesSpecification(
+		&ttlIndex.Model,
+		buildIndexSpecification(
+			t,
+			bson.D{{Key: "expiration_date", Value: int32(1)}},
+			nil,
+			&expireAfterSeconds,
+		),
+	))
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+)
+
+type RewrapResult struct {
+	Files  int64
+	Chunks int64
+}
+
+// KeysRewrap wraps data keys of stored files and upload chunks with the
+// current master key after master key rotation. Encrypted content is not
+// read, so rewrap is fast for any amount of stored files.
+type KeysRewrap struct {
+	Context       *context.Context
+	FilesMetadata mongoifc.Collection
+	Uploads       mongoifc.Collection
+	Keys          *KeyRing
+}
+
+func (rewrap KeysRewrap) staleKeyFilter() bson.D {
+	return bson.D{
+		primitive.E{Key: "$exists", Value: true},
+		primitive.E{Key: "$ne", Value: rewrap.Keys.CurrentKeyId()},
+	}
+}
+
+func closeRewrapCursor(cursor mongoifc.Cursor, ctx *context.Context) {
+	if err := cursor.Close(*ctx); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Warn("Close cursor error")
+	}
+}
+
+// RewrapKeys rewraps every data key wrapped with a previous master key.
+// Updates are guarded by the previous key identifier, so rewrap can be
+// restarted after a failure.
+func (rewrap KeysRewrap) RewrapKeys() (*RewrapResult, error) {
+	result := &RewrapResult{}
+	if err := rewrap.rewrapFiles(result); err != nil {
+		return result, err
+	}
+	if err := rewrap.rewrapUploads(result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (rewrap KeysRewrap) rewrapFiles(result *RewrapResult) error {
+	ctx := rewrap.Context
+	filter := bson.D{
+		primitive.E{Key: "encryption.key_id", Value: rewrap.staleKeyFilter()},
+	}
+	cursor, err := rewrap.FilesMetadata.Find(
+		*ctx, filter, options.Find().SetBatchSize(migrationBatchSize),
+	)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	defer closeRewrapCursor(cursor, ctx)
+
+	for cursor.Next(*ctx) {
+		var fileMetadata api.FileMetadata
+		if err := cursor.Decode(&fileMetadata); err != nil {
+			return base.NewDatabaseError(err)
+		}
+		encryption, err := rewrap.Keys.Rewrap(fileMetadata.Encryption)
+		if err != nil {
+			return base.NewEncryptionError(err)
+		}
+		_, err = rewrap.FilesMetadata.UpdateOne(
+			*ctx,
+			bson.D{
+				primitive.E{Key: "identifier", Value: fileMetadata.Identifier},
+				primitive.E{Key: "encryption.key_id", Value: fileMetadata.Encryption.KeyId},
+			},
+			bson.D{primitive.E{Key: "$set", Value: bson.D{
+				primitive.E{Key: "encryption", Value: encryption},
+			}}},
+		)
+		if err != nil {
+			return base.NewDatabaseError(err)
+		}
+		result.Files++
+	}
+	if err := cursor.Err(); err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+func (rewrap KeysRewrap) rewrapUploads(result *RewrapResult) error {
+	ctx := rewrap.Context
+	filter := bson.D{
+		primitive.E{Key: "chunks", Value: bson.D{
+			primitive.E{Key: "$elemMatch", Value: bson.D{
+				primitive.E{Key: "encryption.key_id", Value: rewrap.staleKeyFilter()},
+			}},
+		}},
+	}
+	cursor, err := rewrap.Uploads.Find(
+		*ctx, filter, options.Find().SetBatchSize(migrationBatchSize),
+	)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	defer closeRewrapCursor(cursor, ctx)
+
+	for cursor.Next(*ctx) {
+		var upload api.Upload
+		if err := cursor.Decode(&upload); err != nil {
+			return base.NewDatabaseError(err)
+		}
+		for _, chunk := range upload.Chunks {
+			if err := rewrap.rewrapChunk(upload.Identifier, &chunk, result); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+func (rewrap KeysRewrap) rewrapChunk(
+	uploadId string,
+	chunk *api.UploadChunk,
+	result *RewrapResult,
+) error {
+	if chunk.Encryption == nil || chunk.Encryption.KeyId == rewrap.Keys.CurrentKeyId() {
+		return nil
+	}
+	encryption, err := rewrap.Keys.Rewrap(chunk.Encryption)
+	if err != nil {
+		return base.NewEncryptionError(err)
+	}
+	_, err = rewrap.Uploads.UpdateOne(
+		*rewrap.Context,
+		bson.D{
+			primitive.E{Key: "identifier", Value: uploadId},
+			primitive.E{Key: "chunks", Value: bson.D{
+				primitive.E{Key: "$elemMatch", Value: bson.D{
+					primitive.E{Key: "identifier", Value: chunk.Identifier},
+					primitive.E{Key: "encryption.key_id", Value: chunk.Encryption.KeyId},
+				}},
+			}},
+		},
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "chunks.$.encryption", Value: encryption},
+		}}},
+	)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	result.Chunks++
+	return nil
+}
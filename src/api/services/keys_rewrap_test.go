@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"github.com/jinzhu/copier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
+	"go.mongodb.org/mongo-driver/mongo"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"testing"
+)
+
+func TestRewrapKeys(t *testing.T) {
+	dbContext := context.TODO()
+	previousKey, currentKey := newMasterKey(), newMasterKey()
+	previousKeys, err := NewKeyRing(&base.EncryptionConfig{
+		MasterKey: previousKey, ChunkBytes: 1024,
+	})
+	assert.Nil(t, err)
+	keys, err := NewKeyRing(&base.EncryptionConfig{
+		MasterKey:          currentKey,
+		PreviousMasterKeys: []string{previousKey},
+		ChunkBytes:         1024,
+	})
+	assert.Nil(t, err)
+
+	fileMetadata := tests.FileMetadataFactory.Build()
+	fileMetadata.Encryption, _, _ = previousKeys.NewFileEncryption()
+	staleChunk, _, _ := previousKeys.NewFileEncryption()
+	currentChunk, _, _ := keys.NewFileEncryption()
+	upload := api.Upload{
+		Identifier: "upload",
+		Chunks: []api.UploadChunk{
+			{Identifier: "stale", Encryption: staleChunk},
+			{Identifier: "current", Encryption: currentChunk},
+		},
+	}
+
+	filesMock := new(mongoMock.Collection)
+	mockFilesMetadataCursor(filesMock, dbContext, []api.FileMetadata{fileMetadata}).
+		On("Err").Return(nil)
+	filesMock.On("UpdateOne", dbContext, mock.Anything, mock.Anything).Return(
+		&mongo.UpdateResult{ModifiedCount: 1}, nil,
+	).Once()
+
+	uploadsMock := new(mongoMock.Collection)
+	uploadsCursor := new(mongoMock.Cursor)
+	uploadsMock.On("Find", dbContext, mock.Anything, mock.Anything).Return(uploadsCursor, nil)
+	uploadsCursor.On("Next", dbContext).Return(true).Once()
+	uploadsCursor.On("Decode", &api.Upload{}).Return(func(v interface{}) error {
+		return copier.Copy(v, &upload)
+	}).Once()
+	uploadsCursor.On("Next", dbContext).Return(false).Once()
+	uploadsCursor.On("Err").Return(nil)
+	uploadsCursor.On("Close", dbContext).Return(nil)
+	uploadsMock.On("UpdateOne", dbContext, mock.Anything, mock.Anything).Return(
+		&mongo.UpdateResult{ModifiedCount: 1}, nil,
+	).Once()
+
+	rewrap := KeysRewrap{
+		Context:       &dbContext,
+		FilesMetadata: filesMock,
+		Uploads:       uploadsMock,
+		Keys:          keys,
+	}
+	result, err := rewrap.RewrapKeys()
+
+	assert.Nil(t, err)
+	assert.Equal(t, &RewrapResult{Files: 1, Chunks: 1}, result)
+	filesMock.AssertExpectations(t)
+	uploadsMock.AssertExpectations(t)
+}
+
+func TestRewrapKeysUnknownMasterKey(t *testing.T) {
+	dbContext := context.TODO()
+	fileMetadata := tests.FileMetadataFactory.Build()
+	fileMetadata.Encryption, _, _ = newTestKeyRing(t, 1024).NewFileEncryption()
+
+	filesMock := new(mongoMock.Collection)
+	mockFilesMetadataCursor(filesMock, dbContext, []api.FileMetadata{fileMetadata})
+
+	rewrap := KeysRewrap{
+		Context:       &dbContext,
+		FilesMetadata: filesMock,
+		Keys:          newTestKeyRing(t, 1024),
+	}
+	_, err := rewrap.RewrapKeys()
+
+	assert.Equal(t, "File content encryption error", err.(base.ServiceError).Summary)
+	filesMock.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything)
+}
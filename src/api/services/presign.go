@@ -0,0 +1,37 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"stealthy-backend/api"
+	"strconv"
+	"strings"
+)
+
+// URLSigner signs constraints of presigned download URLs with HMAC-SHA256,
+// so the URLs are verified without any stored state.
+type URLSigner struct {
+	Key []byte
+}
+
+func presignMessage(params *api.PresignParams) []byte {
+	return []byte(strings.Join([]string{
+		params.FileIdentifier,
+		strconv.FormatInt(params.Expires, 10),
+		params.IP,
+		strconv.FormatInt(params.MaxBytes, 10),
+	}, "\n"))
+}
+
+func (signer URLSigner) Sign(params *api.PresignParams) string {
+	mac := hmac.New(sha256.New, signer.Key)
+	mac.Write(presignMessage(params))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify tells if the signature was made for the params, in constant time.
+func (signer URLSigner) Verify(params *api.PresignParams, signature string) bool {
+	expected := signer.Sign(params)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
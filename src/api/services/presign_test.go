@@ -0,0 +1,27 @@
+package services
+
+import (
+	"github.com/stretchr/testify/assert"
+	"stealthy-backend/api"
+	"testing"
+)
+
+func TestURLSignerVerifiesSignedParams(t *testing.T) {
+	signer := URLSigner{Key: []byte("presign_secret_key_of_test_server")}
+	params := api.PresignParams{
+		FileIdentifier: "file", Expires: 1699644399, IP: "203.0.113.0/24", MaxBytes: 10,
+	}
+
+	signature := signer.Sign(&params)
+
+	assert.True(t, signer.Verify(&params, signature))
+	assert.False(t, URLSigner{Key: []byte("another_key")}.Verify(&params, signature))
+	for _, changed := range []api.PresignParams{
+		{FileIdentifier: "other", Expires: 1699644399, IP: "203.0.113.0/24", MaxBytes: 10},
+		{FileIdentifier: "file", Expires: 1699644400, IP: "203.0.113.0/24", MaxBytes: 10},
+		{FileIdentifier: "file", Expires: 1699644399, IP: "", MaxBytes: 10},
+		{FileIdentifier: "file", Expires: 1699644399, IP: "203.0.113.0/24", MaxBytes: 0},
+	} {
+		assert.False(t, signer.Verify(&changed, signature), changed)
+	}
+}
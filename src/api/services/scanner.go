@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"strings"
+	"time"
+)
+
+// clamdChunkBytes is size of content chunks sent to clamd, it has to be
+// less than StreamMaxLength of clamd.
+const clamdChunkBytes = 64 << 10
+
+type BaseScanner interface {
+	Scan(content io.Reader) (*api.ScanResult, error)
+}
+
+// NoopScanner reports any content clean without scanning it.
+type NoopScanner struct {
+	BaseScanner
+}
+
+func (scanner NoopScanner) Scan(io.Reader) (*api.ScanResult, error) {
+	return &api.ScanResult{}, nil
+}
+
+// ClamdScanner streams content to clamd daemon with INSTREAM command.
+// Network is "tcp" or "unix", timeout limits every socket operation, so
+// scanning of large files is not interrupted.
+type ClamdScanner struct {
+	BaseScanner
+	Network string
+	Address string
+	Timeout time.Duration
+}
+
+func (scanner ClamdScanner) Scan(content io.Reader) (*api.ScanResult, error) {
+	conn, err := net.DialTimeout(scanner.Network, scanner.Address, scanner.Timeout)
+	if err != nil {
+		return nil, base.NewScannerError(err)
+	}
+	defer conn.Close()
+
+	if err = scanner.write(conn, []byte("zINSTREAM\x00")); err != nil {
+		return nil, base.NewScannerError(err)
+	}
+	if err = scanner.sendContent(conn, content); err != nil {
+		return nil, err
+	}
+
+	if err = conn.SetReadDeadline(time.Now().Add(scanner.Timeout)); err != nil {
+		return nil, base.NewScannerError(err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return nil, base.NewScannerError(err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// sendContent writes content in chunks prefixed with their length, zero
+// length chunk ends the stream.
+func (scanner ClamdScanner) sendContent(conn net.Conn, content io.Reader) error {
+	buffer := make([]byte, 4+clamdChunkBytes)
+	for {
+		n, err := io.ReadFull(content, buffer[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buffer, uint32(n))
+			if err := scanner.write(conn, buffer[:4+n]); err != nil {
+				return base.NewScannerError(err)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	if err := scanner.write(conn, []byte{0, 0, 0, 0}); err != nil {
+		return base.NewScannerError(err)
+	}
+	return nil
+}
+
+func (scanner ClamdScanner) write(conn net.Conn, data []byte) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(scanner.Timeout)); err != nil {
+		return err
+	}
+	_, err := conn.Write(data)
+	return err
+}
+
+// parseClamdReply reads reply to a stream scan, e.g. "stream: OK" or
+// "stream: Eicar-Signature FOUND".
+func parseClamdReply(reply string) (*api.ScanResult, error) {
+	result, found := strings.CutPrefix(reply, "stream: ")
+	if !found {
+		return nil, base.NewScannerError(
+			fmt.Errorf("unexpected clamd reply '%s'", reply),
+		)
+	}
+	if result == "OK" {
+		return &api.ScanResult{}, nil
+	}
+	if signature, found := strings.CutSuffix(result, " FOUND"); found {
+		return &api.ScanResult{Infected: true, Signature: signature}, nil
+	}
+	return nil, base.NewScannerError(fmt.Errorf("clamd error '%s'", result))
+}
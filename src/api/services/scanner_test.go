@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"path/filepath"
+	"stealthy-backend/api"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd accepts one INSTREAM command and replies with reply function
+// result for the received content.
+func fakeClamd(
+	t *testing.T,
+	listener net.Listener,
+	reply func(content []byte) string,
+) <-chan []byte {
+	received := make(chan []byte, 1)
+	go func() {
+		defer close(received)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		command, err := reader.ReadString(0)
+		assert.NoError(t, err)
+		assert.Equal(t, "zINSTREAM\x00", command)
+
+		content := []byte{}
+		for {
+			var length uint32
+			assert.NoError(t, binary.Read(reader, binary.BigEndian, &length))
+			if length == 0 {
+				break
+			}
+			chunk := make([]byte, length)
+			_, err := io.ReadFull(reader, chunk)
+			assert.NoError(t, err)
+			content = append(content, chunk...)
+		}
+		_, err = conn.Write([]byte(reply(content) + "\x00"))
+		assert.NoError(t, err)
+		received <- content
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return received
+}
+
+func eicarReply(content []byte) string {
+	if bytes.Contains(content, []byte("EICAR")) {
+		return "stream: Eicar-Signature FOUND"
+	}
+	return "stream: OK"
+}
+
+func TestClamdScannerCleanContent(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	received := fakeClamd(t, listener, eicarReply)
+	scanner := ClamdScanner{
+		Network: "tcp", Address: listener.Addr().String(), Timeout: time.Second,
+	}
+	content := bytes.Repeat([]byte("clean content "), clamdChunkBytes/7)
+
+	result, err := scanner.Scan(bytes.NewReader(content))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &api.ScanResult{}, result)
+	assert.Equal(t, content, <-received)
+}
+
+func TestClamdScannerInfectedContent(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	fakeClamd(t, listener, eicarReply)
+	scanner := ClamdScanner{Network: "unix", Address: socket, Timeout: time.Second}
+
+	result, err := scanner.Scan(strings.NewReader("X5O!P%@AP EICAR TEST FILE"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &api.ScanResult{Infected: true, Signature: "Eicar-Signature"}, result)
+}
+
+func TestClamdScannerEmptyContent(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	received := fakeClamd(t, listener, eicarReply)
+	scanner := ClamdScanner{
+		Network: "tcp", Address: listener.Addr().String(), Timeout: time.Second,
+	}
+
+	result, err := scanner.Scan(strings.NewReader(""))
+
+	assert.NoError(t, err)
+	assert.False(t, result.Infected)
+	assert.Empty(t, <-received)
+}
+
+func TestClamdScannerErrorReply(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	fakeClamd(t, listener, func([]byte) string {
+		return "stream: Can't allocate memory ERROR"
+	})
+	scanner := ClamdScanner{
+		Network: "tcp", Address: listener.Addr().String(), Timeout: time.Second,
+	}
+
+	result, err := scanner.Scan(strings.NewReader("content"))
+
+	assert.Nil(t, result)
+	assert.ErrorContains(t, err, "Can't allocate memory ERROR")
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	scanner := ClamdScanner{
+		Network: "unix",
+		Address: filepath.Join(t.TempDir(), "missing.sock"),
+		Timeout: time.Second,
+	}
+
+	result, err := scanner.Scan(strings.NewReader("content"))
+
+	assert.Nil(t, result)
+	assert.Error(t, err)
+}
+
+func TestClamdScannerContentReadError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	scanner := ClamdScanner{
+		Network: "tcp", Address: listener.Addr().String(), Timeout: time.Second,
+	}
+	defer listener.Close()
+
+	result, err := scanner.Scan(failingReader{})
+
+	assert.Nil(t, result)
+	assert.ErrorContains(t, err, "connection reset")
+}
+
+func TestNoopScanner(t *testing.T) {
+	result, err := NoopScanner{}.Scan(strings.NewReader("X5O!P%@AP EICAR"))
+
+	assert.NoError(t, err)
+	assert.False(t, result.Infected)
+}
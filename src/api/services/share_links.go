@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"time"
+)
+
+type BaseShareLinksService interface {
+	AddShareLink(link *api.ShareLink) error
+	GetShareLink(token string) (*api.ShareLink, error)
+	GetFileShareLinks(fileId string) ([]api.ShareLink, error)
+	UpdateShareLink(link *api.ShareLink) error
+	RegisterShareLinkDownload(token string) (*api.ShareLink, error)
+	DeleteShareLink(token string) error
+	DeleteShareLinks(fileIds []string) (int64, error)
+}
+
+type ShareLinksService struct {
+	BaseShareLinksService
+	Context    *context.Context
+	Collection mongoifc.Collection
+}
+
+// CheckShareLink tells why a link can not be used to download its file.
+func CheckShareLink(link *api.ShareLink) error {
+	if !link.Enabled {
+		return base.NewShareLinkDisabledError(link.Token)
+	}
+	if link.Expiration > 0 && link.Expiration <= time.Now().Unix() {
+		return base.NewShareLinkExpiredError(link.Token)
+	}
+	if link.MaxDownloads > 0 && link.DownloadCount >= link.MaxDownloads {
+		return base.NewShareLinkDownloadLimitError(link.Token)
+	}
+	return nil
+}
+
+func (service ShareLinksService) AddShareLink(link *api.ShareLink) error {
+	if _, err := service.Collection.InsertOne(*service.Context, link); err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+func (service ShareLinksService) GetShareLink(token string) (*api.ShareLink, error) {
+	var link api.ShareLink
+	err := service.Collection.FindOne(*service.Context, bson.D{
+		primitive.E{Key: "token", Value: token},
+	}).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewShareLinkNotFoundError(token)
+	} else if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	return &link, nil
+}
+
+// GetFileShareLinks returns links of the file from the newest one.
+func (service ShareLinksService) GetFileShareLinks(
+	fileId string,
+) ([]api.ShareLink, error) {
+	cursor, err := service.Collection.Find(
+		*service.Context,
+		bson.D{primitive.E{Key: "file_identifier", Value: fileId}},
+		options.Find().SetSort(bson.D{{Key: "creation", Value: -1}}),
+	)
+	if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	defer func(cursor mongoifc.Cursor, ctx *context.Context) {
+		err := cursor.Close(*ctx)
+		if err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Close cursor error")
+		}
+	}(cursor, service.Context)
+
+	links := []api.ShareLink{}
+	for cursor.Next(*service.Context) {
+		var link api.ShareLink
+		if err := cursor.Decode(&link); err != nil {
+			return nil, base.NewDatabaseError(err)
+		}
+		links = append(links, link)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	return links, nil
+}
+
+// UpdateShareLink saves settings of the link, download counter is kept.
+func (service ShareLinksService) UpdateShareLink(link *api.ShareLink) error {
+	result, err := service.Collection.UpdateOne(
+		*service.Context,
+		bson.D{primitive.E{Key: "token", Value: link.Token}},
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "enabled", Value: link.Enabled},
+			primitive.E{Key: "expiration", Value: link.Expiration},
+			primitive.E{Key: "max_downloads", Value: link.MaxDownloads},
+			primitive.E{Key: "password_protected", Value: link.PasswordProtected},
+			primitive.E{Key: "password_hash", Value: link.PasswordHash},
+		}}},
+	)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	if result.MatchedCount == 0 {
+		return base.NewShareLinkNotFoundError(link.Token)
+	}
+	return nil
+}
+
+// RegisterShareLinkDownload atomically increments the link download
+// counter unless the link can not be used. Returns the updated link.
+func (service ShareLinksService) RegisterShareLinkDownload(
+	token string,
+) (*api.ShareLink, error) {
+	now := time.Now().Unix()
+	filter := bson.D{
+		primitive.E{Key: "token", Value: token},
+		primitive.E{Key: "enabled", Value: true},
+		primitive.E{Key: "$and", Value: bson.A{
+			bson.D{primitive.E{Key: "$or", Value: bson.A{
+				bson.D{primitive.E{Key: "expiration", Value: 0}},
+				bson.D{primitive.E{Key: "expiration", Value: bson.D{
+					primitive.E{Key: "$gt", Value: now},
+				}}},
+			}}},
+			bson.D{primitive.E{Key: "$or", Value: bson.A{
+				bson.D{primitive.E{Key: "max_downloads", Value: 0}},
+				bson.D{primitive.E{Key: "$expr", Value: bson.D{
+					primitive.E{Key: "$lt", Value: bson.A{
+						"$download_count", "$max_downloads",
+					}},
+				}}},
+			}}},
+		}},
+	}
+	update := bson.D{
+		primitive.E{Key: "$inc", Value: bson.D{
+			primitive.E{Key: "download_count", Value: 1},
+		}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var link api.ShareLink
+	err := service.Collection.FindOneAndUpdate(
+		*service.Context, filter, update, opts,
+	).Decode(&link)
+	if err == nil {
+		return &link, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewDatabaseError(err)
+	}
+
+	current, err := service.GetShareLink(token)
+	if err != nil {
+		return nil, err
+	}
+	if err = CheckShareLink(current); err != nil {
+		return nil, err
+	}
+	return nil, base.NewShareLinkDownloadLimitError(token)
+}
+
+func (service ShareLinksService) DeleteShareLink(token string) error {
+	result, err := service.Collection.DeleteOne(*service.Context, bson.D{
+		primitive.E{Key: "token", Value: token},
+	})
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	if result.DeletedCount == 0 {
+		return base.NewShareLinkNotFoundError(token)
+	}
+	return nil
+}
+
+// DeleteShareLinks removes all links of the files.
+func (service ShareLinksService) DeleteShareLinks(fileIds []string) (int64, error) {
+	result, err := service.Collection.DeleteMany(*service.Context, bson.D{
+		primitive.E{Key: "file_identifier", Value: bson.D{
+			primitive.E{Key: "$in", Value: fileIds},
+		}},
+	})
+	if err != nil {
+		return 0, base.NewDatabaseError(err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"io"
+	"stealthy-backend/api"
+)
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// NopSeekCloser returns a ReadSeekCloser with a no-op Close method
+// wrapping the provided reader.
+func NopSeekCloser(reader io.ReadSeeker) io.ReadSeekCloser {
+	return nopSeekCloser{reader}
+}
+
+// BaseStorageDriver stores file content by file identifier. Content is
+// returned seekable, so parts of a file can be served. Drivers return
+// base.NewFileNotFoundError for missing content and never overwrite
+// existing content on Put.
+type BaseStorageDriver interface {
+	Put(file *api.FileData, content io.Reader) (int64, error)
+	Get(fileId string) (io.ReadSeekCloser, error)
+	Delete(fileId string) error
+	Stat(fileId string) (*api.StoredFileInfo, error)
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+)
+
+// GridFSStorageDriver stores file content in GridFS chunks, so file size
+// is not limited by MongoDB document size. File identifier is used as
+// GridFS file ID.
+type GridFSStorageDriver struct {
+	BaseStorageDriver
+	Context *context.Context
+	Bucket  *gridfs.Bucket
+}
+
+func (driver GridFSStorageDriver) Put(
+	file *api.FileData,
+	content io.Reader,
+) (int64, error) {
+	uploadOptions := options.GridFSUpload().SetMetadata(bson.D{
+		primitive.E{Key: "expiration_date", Value: file.ExpirationDate},
+	})
+	stream, err := driver.Bucket.OpenUploadStreamWithID(
+		file.Identifier, file.Identifier, uploadOptions,
+	)
+	if err != nil {
+		return 0, base.NewDatabaseError(err)
+	}
+
+	source := &trackingReader{Reader: content}
+	written, err := io.Copy(stream, source)
+	if err != nil {
+		_ = stream.Abort()
+		if source.Err != nil {
+			return 0, base.NewFilesRequestError(source.Err)
+		}
+		return 0, base.NewDatabaseError(err)
+	}
+	if err := stream.Close(); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return 0, base.NewFileAlreadyExistsError(file.Identifier)
+		}
+		return 0, base.NewDatabaseError(err)
+	}
+	return written, nil
+}
+
+func (driver GridFSStorageDriver) openStream(
+	fileId string,
+) (*gridfs.DownloadStream, error) {
+	stream, err := driver.Bucket.OpenDownloadStream(fileId)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, base.NewFileNotFoundError(fileId)
+	} else if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	return stream, nil
+}
+
+func (driver GridFSStorageDriver) Get(fileId string) (io.ReadSeekCloser, error) {
+	stream, err := driver.openStream(fileId)
+	if err != nil {
+		return nil, err
+	}
+	return &gridFSFileReader{
+		Driver: driver,
+		FileId: fileId,
+		stream: stream,
+		size:   stream.GetFile().Length,
+	}, nil
+}
+
+// gridFSFileReader adds seeking to GridFS download stream. Stream is moved
+// to requested position on the next read: forward by skipping chunks,
+// backward by opening the stream again.
+type gridFSFileReader struct {
+	Driver         GridFSStorageDriver
+	FileId         string
+	stream         *gridfs.DownloadStream
+	size           int64
+	position       int64
+	streamPosition int64
+}
+
+func (reader *gridFSFileReader) moveStream() error {
+	if reader.position < reader.streamPosition {
+		CloseFileStream(reader.stream, reader.FileId)
+		stream, err := reader.Driver.openStream(reader.FileId)
+		if err != nil {
+			return err
+		}
+		reader.stream = stream
+		reader.streamPosition = 0
+	}
+	if reader.position > reader.streamPosition {
+		skipped, err := reader.stream.Skip(reader.position - reader.streamPosition)
+		reader.streamPosition += skipped
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (reader *gridFSFileReader) Read(p []byte) (int, error) {
+	if reader.position >= reader.size {
+		return 0, io.EOF
+	}
+	if err := reader.moveStream(); err != nil {
+		return 0, err
+	}
+	n, err := reader.stream.Read(p)
+	reader.position += int64(n)
+	reader.streamPosition += int64(n)
+	return n, err
+}
+
+func (reader *gridFSFileReader) Seek(offset int64, whence int) (int64, error) {
+	position := offset
+	switch whence {
+	case io.SeekCurrent:
+		position += reader.position
+	case io.SeekEnd:
+		position += reader.size
+	}
+	if position < 0 {
+		return 0, errors.New("seek to negative position")
+	}
+	reader.position = position
+	return position, nil
+}
+
+func (reader *gridFSFileReader) Close() error {
+	return reader.stream.Close()
+}
+
+func (driver GridFSStorageDriver) Delete(fileId string) error {
+	err := driver.Bucket.DeleteContext(*driver.Context, fileId)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return base.NewFileNotFoundError(fileId)
+	} else if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+func (driver GridFSStorageDriver) Stat(fileId string) (*api.StoredFileInfo, error) {
+	var file gridfs.File
+	err := driver.Bucket.GetFilesCollection().FindOne(
+		*driver.Context, bson.D{primitive.E{Key: "_id", Value: fileId}},
+	).Decode(&file)
+
+	if err == nil {
+		return &api.StoredFileInfo{Identifier: fileId, Size: file.Length}, nil
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewFileNotFoundError(fileId)
+	} else {
+		return nil, base.NewDatabaseError(err)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+)
+
+const localDirectoryPermissions fs.FileMode = 0o750
+const localTempFilePattern string = ".upload-*"
+
+// Identifiers are used as file names, temporary files start with a dot
+// and can not clash with them.
+var localFileIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LocalStorageDriver stores file content on local filesystem. Files are
+// spread over two levels of shard directories named after identifier hash,
+// so a single directory does not grow too large.
+type LocalStorageDriver struct {
+	BaseStorageDriver
+	Directory string
+}
+
+func (driver LocalStorageDriver) filePath(fileId string) (string, bool) {
+	if !localFileIdPattern.MatchString(fileId) {
+		return "", false
+	}
+	hash := sha256.Sum256([]byte(fileId))
+	shard := hex.EncodeToString(hash[:2])
+	return filepath.Join(driver.Directory, shard[:2], shard[2:], fileId), true
+}
+
+func removeTempFile(path string) {
+	if err := os.Remove(path); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"path":  path,
+			"error": err.Error(),
+		}).Warn("Remove temporary file error")
+	}
+}
+
+// Put writes content to a temporary file in the target directory and
+// links it to the file path when the content is complete, so partially
+// written files are never visible and existing files are not replaced.
+func (driver LocalStorageDriver) Put(
+	file *api.FileData,
+	content io.Reader,
+) (int64, error) {
+	path, valid := driver.filePath(file.Identifier)
+	if !valid {
+		return 0, base.NewStorageError(
+			fmt.Errorf("invalid file identifier '%s'", file.Identifier),
+		)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), localDirectoryPermissions); err != nil {
+		return 0, base.NewStorageError(err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), localTempFilePattern)
+	if err != nil {
+		return 0, base.NewStorageError(err)
+	}
+	source := &trackingReader{Reader: content}
+	written, err := io.Copy(temp, source)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeTempFile(temp.Name())
+		if source.Err != nil {
+			return 0, base.NewFilesRequestError(source.Err)
+		}
+		return 0, base.NewStorageError(err)
+	}
+
+	// Link fails if the path exists, unlike rename which replaces it.
+	err = os.Link(temp.Name(), path)
+	removeTempFile(temp.Name())
+	if errors.Is(err, fs.ErrExist) {
+		return 0, base.NewFileAlreadyExistsError(file.Identifier)
+	} else if err != nil {
+		return 0, base.NewStorageError(err)
+	}
+	return written, nil
+}
+
+func (driver LocalStorageDriver) Get(fileId string) (io.ReadSeekCloser, error) {
+	path, valid := driver.filePath(fileId)
+	if !valid {
+		return nil, base.NewFileNotFoundError(fileId)
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, base.NewFileNotFoundError(fileId)
+	} else if err != nil {
+		return nil, base.NewStorageError(err)
+	}
+	return file, nil
+}
+
+func (driver LocalStorageDriver) Delete(fileId string) error {
+	path, valid := driver.filePath(fileId)
+	if !valid {
+		return base.NewFileNotFoundError(fileId)
+	}
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return base.NewFileNotFoundError(fileId)
+	} else if err != nil {
+		return base.NewStorageError(err)
+	}
+	return nil
+}
+
+func (driver LocalStorageDriver) Stat(fileId string) (*api.StoredFileInfo, error) {
+	path, valid := driver.filePath(fileId)
+	if !valid {
+		return nil, base.NewFileNotFoundError(fileId)
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, base.NewFileNotFoundError(fileId)
+	} else if err != nil {
+		return nil, base.NewStorageError(err)
+	}
+	return &api.StoredFileInfo{Identifier: fileId, Size: info.Size()}, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"strings"
+	"testing"
+)
+
+type failingReader struct{}
+
+func (reader failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func countDirectoryFiles(t *testing.T, directory string) int {
+	count := 0
+	err := filepath.WalkDir(directory, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			count++
+		}
+		return err
+	})
+	assert.NoError(t, err)
+	return count
+}
+
+func TestLocalStoragePutAndGet(t *testing.T) {
+	driver := LocalStorageDriver{Directory: t.TempDir()}
+	content := []byte("file content")
+
+	written, err := driver.Put(
+		&api.FileData{Identifier: "file-id_1"}, bytes.NewReader(content),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), written)
+
+	info, err := driver.Stat("file-id_1")
+	assert.Nil(t, err)
+	assert.Equal(t, &api.StoredFileInfo{
+		Identifier: "file-id_1", Size: int64(len(content)),
+	}, info)
+
+	stream, err := driver.Get("file-id_1")
+	assert.Nil(t, err)
+	data, err := io.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.NoError(t, stream.Close())
+	assert.Equal(t, content, data)
+
+	path, _ := driver.filePath("file-id_1")
+	relative, err := filepath.Rel(driver.Directory, path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(filepath.ToSlash(relative), "/"))
+	assert.Equal(t, "file-id_1", filepath.Base(relative))
+}
+
+func TestLocalStoragePutDoesNotOverwrite(t *testing.T) {
+	driver := LocalStorageDriver{Directory: t.TempDir()}
+	file := &api.FileData{Identifier: "identifier"}
+
+	_, err := driver.Put(file, bytes.NewReader([]byte("first")))
+	assert.Nil(t, err)
+	_, err = driver.Put(file, bytes.NewReader([]byte("second")))
+	assert.Equal(t, base.NewFileAlreadyExistsError("identifier"), err)
+
+	stream, err := driver.Get("identifier")
+	assert.Nil(t, err)
+	data, _ := io.ReadAll(stream)
+	assert.NoError(t, stream.Close())
+	assert.Equal(t, []byte("first"), data)
+	assert.Equal(t, 1, countDirectoryFiles(t, driver.Directory))
+}
+
+func TestLocalStorageConcurrentPutStoresOneFile(t *testing.T) {
+	driver := LocalStorageDriver{Directory: t.TempDir()}
+	file := &api.FileData{Identifier: "identifier"}
+
+	results := make(chan error, 8)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			_, err := driver.Put(file, bytes.NewReader([]byte("data")))
+			results <- err
+		}()
+	}
+	stored := 0
+	for i := 0; i < cap(results); i++ {
+		if err := <-results; err == nil {
+			stored++
+		} else {
+			assert.Equal(t, base.NewFileAlreadyExistsError("identifier"), err)
+		}
+	}
+
+	assert.Equal(t, 1, stored)
+	assert.Equal(t, 1, countDirectoryFiles(t, driver.Directory))
+}
+
+func TestLocalStoragePutRemovesPartialFile(t *testing.T) {
+	driver := LocalStorageDriver{Directory: t.TempDir()}
+
+	_, err := driver.Put(&api.FileData{Identifier: "identifier"}, failingReader{})
+
+	assert.Equal(t, base.NewFilesRequestError(errors.New("connection reset")), err)
+	assert.Equal(t, 0, countDirectoryFiles(t, driver.Directory))
+	_, err = driver.Stat("identifier")
+	assert.Equal(t, base.NewFileNotFoundError("identifier"), err)
+}
+
+func TestLocalStorageDelete(t *testing.T) {
+	driver := LocalStorageDriver{Directory: t.TempDir()}
+	_, err := driver.Put(
+		&api.FileData{Identifier: "identifier"}, bytes.NewReader([]byte("data")),
+	)
+	assert.Nil(t, err)
+
+	assert.Nil(t, driver.Delete("identifier"))
+	assert.Equal(t, base.NewFileNotFoundError("identifier"), driver.Delete("identifier"))
+	_, err = driver.Get("identifier")
+	assert.Equal(t, base.NewFileNotFoundError("identifier"), err)
+}
+
+func TestLocalStorageRejectsPathIdentifiers(t *testing.T) {
+	driver := LocalStorageDriver{Directory: t.TempDir()}
+
+	for _, fileId := range []string{"..", "../secret", ".upload-1", ""} {
+		_, err := driver.Stat(fileId)
+		assert.Equal(t, base.NewFileNotFoundError(fileId), err)
+		_, err = driver.Put(&api.FileData{Identifier: fileId}, bytes.NewReader(nil))
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+)
+
+// MongoStorageDriver keeps each file in a single document of the files
+// collection, so content size is limited by MongoDB document size.
+type MongoStorageDriver struct {
+	BaseStorageDriver
+	Context    *context.Context
+	Collection mongoifc.Collection
+}
+
+func (driver MongoStorageDriver) Put(
+	file *api.FileData,
+	content io.Reader,
+) (int64, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return 0, base.NewFilesRequestError(err)
+	}
+
+	document := api.FileData{
+		Identifier:     file.Identifier,
+		Data:           data,
+		ExpirationDate: file.ExpirationDate,
+	}
+	if _, err := driver.Collection.InsertOne(*driver.Context, &document); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return 0, base.NewFileAlreadyExistsError(file.Identifier)
+		}
+		return 0, base.NewDatabaseError(err)
+	}
+	return int64(len(data)), nil
+}
+
+func (driver MongoStorageDriver) Get(fileId string) (io.ReadSeekCloser, error) {
+	var fileData api.FileData
+	err := driver.Collection.FindOne(*driver.Context, bson.D{
+		primitive.E{Key: "identifier", Value: fileId},
+	}).Decode(&fileData)
+
+	if err == nil {
+		return NopSeekCloser(bytes.NewReader(fileData.Data)), nil
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewFileNotFoundError(fileId)
+	} else {
+		return nil, base.NewDatabaseError(err)
+	}
+}
+
+func (driver MongoStorageDriver) Delete(fileId string) error {
+	result, err := driver.Collection.DeleteOne(*driver.Context, bson.D{
+		primitive.E{Key: "identifier", Value: fileId},
+	})
+	if err != nil {
+		return base.NewDatabaseError(err)
+	} else if result.DeletedCount == 0 {
+		return base.NewFileNotFoundError(fileId)
+	}
+	return nil
+}
+
+// Stat computes content size on the server, so file data is not loaded.
+func (driver MongoStorageDriver) Stat(fileId string) (*api.StoredFileInfo, error) {
+	var info api.StoredFileInfo
+	opts := options.FindOne().SetProjection(bson.D{
+		{Key: "identifier", Value: 1},
+		{Key: "size", Value: bson.D{{Key: "$binarySize", Value: "$data"}}},
+	})
+	err := driver.Collection.FindOne(*driver.Context, bson.D{
+		primitive.E{Key: "identifier", Value: fileId},
+	}, opts).Decode(&info)
+
+	if err == nil {
+		info.Identifier = fileId
+		return &info, nil
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewFileNotFoundError(fileId)
+	} else {
+		return nil, base.NewDatabaseError(err)
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"github.com/jinzhu/copier"
+	"github.com/stretchr/testify/assert"
+	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"testing"
+)
+
+func TestMongoStoragePut(t *testing.T) {
+	dbContext := context.TODO()
+	fileData := tests.FileDataFactory.Build()
+
+	collectionMock := new(mongoMock.Collection)
+	collectionMock.On("InsertOne", dbContext, &fileData).Return(nil, nil)
+
+	driver := MongoStorageDriver{Context: &dbContext, Collection: collectionMock}
+	written, err := driver.Put(
+		&api.FileData{
+			Identifier:     fileData.Identifier,
+			ExpirationDate: fileData.ExpirationDate,
+		},
+		bytes.NewReader(fileData.Data),
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(fileData.Data)), written)
+}
+
+func TestMongoStoragePutDuplicateKey(t *testing.T) {
+	dbContext := context.TODO()
+	fileData := tests.FileDataFactory.Build()
+	duplicateKeyError := mongo.WriteException{
+		WriteErrors: []mongo.WriteError{{Code: 11000}},
+	}
+
+	collectionMock := new(mongoMock.Collection)
+	collectionMock.On("InsertOne", dbContext, &fileData).Return(
+		nil, duplicateKeyError,
+	)
+
+	driver := MongoStorageDriver{Context: &dbContext, Collection: collectionMock}
+	written, err := driver.Put(&fileData, bytes.NewReader(fileData.Data))
+
+	assert.Equal(t, int64(0), written)
+	assert.Equal(t, base.NewFileAlreadyExistsError(fileData.Identifier), err)
+}
+
+func TestMongoStorageGet(t *testing.T) {
+	dbContext := context.TODO()
+	fileData := tests.FileDataFactory.Build()
+
+	collectionMock := new(mongoMock.Collection)
+	resultMock := new(mongoMock.SingleResult)
+	resultMock.On("Decode", &api.FileData{}).Return(func(v interface{}) error {
+		return copier.Copy(v, &fileData)
+	})
+	collectionMock.On("FindOne", dbContext, bson.D{
+		primitive.E{Key: "identifier", Value: fileData.Identifier},
+	}).Return(resultMock)
+
+	driver := MongoStorageDriver{Context: &dbContext, Collection: collectionMock}
+	stream, err := driver.Get(fileData.Identifier)
+
+	assert.Nil(t, err)
+	data, err := io.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.Equal(t, fileData.Data, data)
+}
+
+func TestMongoStorageGetNotFound(t *testing.T) {
+	dbContext := context.TODO()
+	fileData := tests.FileDataFactory.Build()
+
+	collectionMock := new(mongoMock.Collection)
+	resultMock := new(mongoMock.SingleResult)
+	resultMock.On("Decode", &api.FileData{}).Return(mongo.ErrNoDocuments)
+	collectionMock.On("FindOne", dbContext, bson.D{
+		primitive.E{Key: "identifier", Value: fileData.Identifier},
+	}).Return(resultMock)
+
+	driver := MongoStorageDriver{Context: &dbContext, Collection: collectionMock}
+	stream, err := driver.Get(fileData.Identifier)
+
+	assert.Nil(t, stream)
+	assert.Equal(t, base.NewFileNotFoundError(fileData.Identifier), err)
+}
+
+func TestMongoStorageStat(t *testing.T) {
+	dbContext := context.TODO()
+	fileId := "identifier"
+	opts := options.FindOne().SetProjection(bson.D{
+		{Key: "identifier", Value: 1},
+		{Key: "size", Value: bson.D{{Key: "$binarySize", Value: "$data"}}},
+	})
+
+	collectionMock := new(mongoMock.Collection)
+	resultMock := new(mongoMock.SingleResult)
+	resultMock.On("Decode", &api.StoredFileInfo{}).Return(func(v interface{}) error {
+		return copier.Copy(v, &api.StoredFileInfo{Size: 42})
+	})
+	collectionMock.On("FindOne", dbContext, bson.D{
+		primitive.E{Key: "identifier", Value: fileId},
+	}, opts).Return(resultMock)
+
+	driver := MongoStorageDriver{Context: &dbContext, Collection: collectionMock}
+	info, err := driver.Stat(fileId)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &api.StoredFileInfo{Identifier: fileId, Size: 42}, info)
+}
+
+func TestMongoStorageDeleteNotFound(t *testing.T) {
+	dbContext := context.TODO()
+	fileId := "identifier"
+
+	collectionMock := new(mongoMock.Collection)
+	collectionMock.On("DeleteOne", dbContext, bson.D{
+		primitive.E{Key: "identifier", Value: fileId},
+	}).Return(&mongo.DeleteResult{DeletedCount: 0}, nil)
+
+	driver := MongoStorageDriver{Context: &dbContext, Collection: collectionMock}
+	err := driver.Delete(fileId)
+
+	assert.Equal(t, base.NewFileNotFoundError(fileId), err)
+}
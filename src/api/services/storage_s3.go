@@ -0,0 +1,228 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+)
+
+// S3StorageDriver stores file content as objects of S3 compatible object
+// storage. Content of unknown size is sent with multipart upload, parts
+// are buffered in memory one at a time.
+type S3StorageDriver struct {
+	BaseStorageDriver
+	Context *context.Context
+	Client  *minio.Client
+	Config  *base.S3StorageConfig
+}
+
+func NewS3StorageDriver(
+	ctx *context.Context,
+	config *base.S3StorageConfig,
+) (*S3StorageDriver, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(
+			config.AccessKeyID, config.SecretAccessKey, "",
+		),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3StorageDriver{Context: ctx, Client: client, Config: config}, nil
+}
+
+// CheckBucket fails if the configured bucket is not available.
+func (driver S3StorageDriver) CheckBucket() error {
+	exists, err := driver.Client.BucketExists(*driver.Context, driver.Config.Bucket)
+	if err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("bucket '%s' does not exist", driver.Config.Bucket)
+	}
+	return nil
+}
+
+func (driver S3StorageDriver) objectName(fileId string) string {
+	return driver.Config.Prefix + fileId
+}
+
+func isS3ObjectNotFoundError(err error) bool {
+	response := minio.ToErrorResponse(err)
+	return response.Code == "NoSuchKey" || response.StatusCode == http.StatusNotFound
+}
+
+// isS3PreconditionFailedError reports conditional write rejected because
+// the object already exists, or is being written by a concurrent request.
+func isS3PreconditionFailedError(err error) bool {
+	response := minio.ToErrorResponse(err)
+	return response.Code == "PreconditionFailed" ||
+		response.Code == "ConditionalRequestConflict" ||
+		response.StatusCode == http.StatusPreconditionFailed
+}
+
+// Put sends content with multipart upload completed only if the object
+// does not exist yet, so existing content is never replaced. Upload is
+// driven part by part since PutObject does not send the condition with
+// the completion request.
+func (driver S3StorageDriver) Put(
+	file *api.FileData,
+	content io.Reader,
+) (int64, error) {
+	core := minio.Core{Client: driver.Client}
+	objectName := driver.objectName(file.Identifier)
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+	opts.SetMatchETagExcept("*")
+
+	uploadId, err := core.NewMultipartUpload(
+		*driver.Context, driver.Config.Bucket, objectName, opts,
+	)
+	if isS3PreconditionFailedError(err) {
+		return 0, base.NewFileAlreadyExistsError(file.Identifier)
+	} else if err != nil {
+		return 0, base.NewStorageError(err)
+	}
+
+	parts, written, err := driver.putParts(core, objectName, uploadId, content)
+	if err == nil {
+		_, err = core.CompleteMultipartUpload(
+			*driver.Context, driver.Config.Bucket, objectName, uploadId, parts, opts,
+		)
+		if isS3PreconditionFailedError(err) {
+			err = base.NewFileAlreadyExistsError(file.Identifier)
+		} else if err != nil {
+			err = base.NewStorageError(err)
+		}
+	}
+	if err != nil {
+		driver.abortUpload(core, objectName, uploadId)
+		return 0, err
+	}
+	return written, nil
+}
+
+// putParts sends content as parts of the upload, the last part may be
+// shorter or empty.
+func (driver S3StorageDriver) putParts(
+	core minio.Core,
+	objectName string,
+	uploadId string,
+	content io.Reader,
+) ([]minio.CompletePart, int64, error) {
+	buffer := make([]byte, driver.Config.PartSize())
+	var parts []minio.CompletePart
+	var written int64
+	for {
+		size, readErr := io.ReadFull(content, buffer)
+		if errors.Is(readErr, io.EOF) && len(parts) > 0 {
+			break
+		} else if readErr != nil &&
+			!errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			return nil, 0, base.NewFilesRequestError(readErr)
+		}
+
+		part, err := core.PutObjectPart(
+			*driver.Context,
+			driver.Config.Bucket,
+			objectName,
+			uploadId,
+			len(parts)+1,
+			bytes.NewReader(buffer[:size]),
+			int64(size),
+			minio.PutObjectPartOptions{},
+		)
+		if err != nil {
+			return nil, 0, base.NewStorageError(err)
+		}
+		parts = append(parts, minio.CompletePart{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+		})
+		written += int64(size)
+		if readErr != nil {
+			break
+		}
+	}
+	return parts, written, nil
+}
+
+func (driver S3StorageDriver) abortUpload(
+	core minio.Core,
+	objectName string,
+	uploadId string,
+) {
+	err := core.AbortMultipartUpload(
+		*driver.Context, driver.Config.Bucket, objectName, uploadId,
+	)
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"object": objectName,
+			"error":  err.Error(),
+		}).Warn("Abort multipart upload error")
+	}
+}
+
+func (driver S3StorageDriver) Get(fileId string) (io.ReadSeekCloser, error) {
+	object, err := driver.Client.GetObject(
+		*driver.Context,
+		driver.Config.Bucket,
+		driver.objectName(fileId),
+		minio.GetObjectOptions{},
+	)
+	if err != nil {
+		return nil, base.NewStorageError(err)
+	}
+
+	// Object is requested lazily, Stat sends the request so missing
+	// objects are reported before the response is started.
+	if _, err := object.Stat(); err != nil {
+		CloseFileStream(object, fileId)
+		if isS3ObjectNotFoundError(err) {
+			return nil, base.NewFileNotFoundError(fileId)
+		}
+		return nil, base.NewStorageError(err)
+	}
+	return object, nil
+}
+
+// Delete checks object existence first, since S3 does not report removal
+// of missing objects.
+func (driver S3StorageDriver) Delete(fileId string) error {
+	if _, err := driver.Stat(fileId); err != nil {
+		return err
+	}
+	err := driver.Client.RemoveObject(
+		*driver.Context,
+		driver.Config.Bucket,
+		driver.objectName(fileId),
+		minio.RemoveObjectOptions{},
+	)
+	if err != nil {
+		return base.NewStorageError(err)
+	}
+	return nil
+}
+
+func (driver S3StorageDriver) Stat(fileId string) (*api.StoredFileInfo, error) {
+	info, err := driver.Client.StatObject(
+		*driver.Context,
+		driver.Config.Bucket,
+		driver.objectName(fileId),
+		minio.StatObjectOptions{},
+	)
+	if isS3ObjectNotFoundError(err) {
+		return nil, base.NewFileNotFoundError(fileId)
+	} else if err != nil {
+		return nil, base.NewStorageError(err)
+	}
+	return &api.StoredFileInfo{Identifier: fileId, Size: info.Size}, nil
+}
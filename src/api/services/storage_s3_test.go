@@ -0,0 +1,390 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const s3TestBucket string = "bucket"
+
+// fakeS3Server is an in-memory stand-in for S3 compatible storage. It
+// supports the path-style object requests used by S3StorageDriver and does
+// not check request signatures.
+type fakeS3Server struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	aborted int
+}
+
+func newFakeS3Server(t *testing.T) (*fakeS3Server, *httptest.Server) {
+	fake := &fakeS3Server{
+		objects: map[string][]byte{},
+		uploads: map[string]map[int][]byte{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func newTestS3Driver(t *testing.T, prefix string) (*fakeS3Server, *S3StorageDriver) {
+	fake, server := newFakeS3Server(t)
+	endpoint, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	ctx := context.TODO()
+	driver, err := NewS3StorageDriver(&ctx, &base.S3StorageConfig{
+		Endpoint:        endpoint.Host,
+		Region:          "us-east-1",
+		Bucket:          s3TestBucket,
+		Prefix:          prefix,
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		PartBytes:       5 << 20,
+	})
+	assert.NoError(t, err)
+	return fake, driver
+}
+
+// readAwsChunked decodes body sent with streaming signature.
+func readAwsChunked(body io.Reader) ([]byte, error) {
+	reader := bufio.NewReader(body)
+	var data bytes.Buffer
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(&data, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data.Bytes(), nil
+		}
+	}
+}
+
+func readS3Body(r *http.Request) ([]byte, error) {
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return readAwsChunked(r.Body)
+	}
+	return io.ReadAll(r.Body)
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+	}
+}
+
+func writeS3Xml(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(value)
+}
+
+func s3ETag(data []byte) string {
+	sum := md5.Sum(data)
+	return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+func (fake *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s3TestBucket {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+	switch {
+	case key == "":
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		fake.initiateUpload(w, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		fake.uploadPart(w, r, query)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		fake.completeUpload(w, r, key, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(fake.uploads, query.Get("uploadId"))
+		fake.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		if fake.rejectExisting(w, r, key) {
+			return
+		}
+		data, err := readS3Body(r)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		fake.objects[key] = data
+		w.Header().Set("ETag", s3ETag(data))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		fake.getObject(w, r, key)
+	case r.Method == http.MethodDelete:
+		delete(fake.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// rejectExisting fails conditional write of existing object.
+func (fake *fakeS3Server) rejectExisting(
+	w http.ResponseWriter,
+	r *http.Request,
+	key string,
+) bool {
+	condition := strings.Trim(r.Header.Get("If-None-Match"), "\"")
+	if _, exists := fake.objects[key]; exists && condition == "*" {
+		writeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+		return true
+	}
+	return false
+}
+
+func (fake *fakeS3Server) initiateUpload(w http.ResponseWriter, key string) {
+	uploadId := strconv.Itoa(len(fake.uploads)+fake.aborted+1) + "-" + key
+	fake.uploads[uploadId] = map[int][]byte{}
+	writeS3Xml(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: s3TestBucket, Key: key, UploadId: uploadId})
+}
+
+func (fake *fakeS3Server) uploadPart(
+	w http.ResponseWriter,
+	r *http.Request,
+	query url.Values,
+) {
+	parts, exists := fake.uploads[query.Get("uploadId")]
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if !exists || err != nil {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	data, err := readS3Body(r)
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	parts[partNumber] = data
+	w.Header().Set("ETag", s3ETag(data))
+}
+
+func (fake *fakeS3Server) completeUpload(
+	w http.ResponseWriter,
+	r *http.Request,
+	key string,
+	uploadId string,
+) {
+	parts, exists := fake.uploads[uploadId]
+	if !exists {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	if fake.rejectExisting(w, r, key) {
+		return
+	}
+	numbers := make([]int, 0, len(parts))
+	for number := range parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	var data []byte
+	for _, number := range numbers {
+		data = append(data, parts[number]...)
+	}
+	fake.objects[key] = data
+	delete(fake.uploads, uploadId)
+
+	writeS3Xml(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: s3TestBucket, Key: key, ETag: s3ETag(data)})
+}
+
+func (fake *fakeS3Server) getObject(
+	w http.ResponseWriter,
+	r *http.Request,
+	key string,
+) {
+	data, exists := fake.objects[key]
+	if !exists {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	w.Header().Set("ETag", s3ETag(data))
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	status := http.StatusOK
+	if start, end, ok := parseS3Range(r.Header.Get("Range"), len(data)); ok {
+		w.Header().Set(
+			"Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(data)),
+		)
+		data = data[start:end]
+		status = http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+// parseS3Range parses single "bytes=start-[end]" range sent by the client.
+func parseS3Range(header string, size int) (int, int, bool) {
+	first, last, found := strings.Cut(strings.TrimPrefix(header, "bytes="), "-")
+	start, err := strconv.Atoi(first)
+	if !found || err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size
+	if last != "" {
+		if value, err := strconv.Atoi(last); err == nil && value+1 < size {
+			end = value + 1
+		}
+	}
+	return start, end, true
+}
+
+func TestS3StoragePutAndGet(t *testing.T) {
+	fake, driver := newTestS3Driver(t, "files/")
+	content := []byte("file content")
+
+	written, err := driver.Put(
+		&api.FileData{Identifier: "identifier"}, bytes.NewReader(content),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), written)
+	assert.Equal(t, content, fake.objects["files/identifier"])
+
+	info, err := driver.Stat("identifier")
+	assert.Nil(t, err)
+	assert.Equal(t, &api.StoredFileInfo{
+		Identifier: "identifier", Size: int64(len(content)),
+	}, info)
+
+	stream, err := driver.Get("identifier")
+	assert.Nil(t, err)
+	data, err := io.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.NoError(t, stream.Close())
+	assert.Equal(t, content, data)
+}
+
+func TestS3StoragePutDoesNotOverwrite(t *testing.T) {
+	fake, driver := newTestS3Driver(t, "")
+	file := &api.FileData{Identifier: "identifier"}
+
+	_, err := driver.Put(file, bytes.NewReader([]byte("first")))
+	assert.Nil(t, err)
+	_, err = driver.Put(file, bytes.NewReader([]byte("second")))
+
+	assert.Equal(t, base.NewFileAlreadyExistsError("identifier"), err)
+	assert.Equal(t, []byte("first"), fake.objects["identifier"])
+	assert.Equal(t, 1, fake.aborted)
+	assert.Empty(t, fake.uploads)
+}
+
+func TestS3StorageGetSeek(t *testing.T) {
+	fake, driver := newTestS3Driver(t, "")
+	fake.objects["identifier"] = []byte("file content")
+
+	stream, err := driver.Get("identifier")
+	assert.Nil(t, err)
+	size, err := stream.Seek(0, io.SeekEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(12), size)
+	_, err = stream.Seek(5, io.SeekStart)
+	assert.Nil(t, err)
+	data, err := io.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.NoError(t, stream.Close())
+	assert.Equal(t, []byte("content"), data)
+}
+
+func TestS3StoragePutMultipleParts(t *testing.T) {
+	fake, driver := newTestS3Driver(t, "")
+	content := bytes.Repeat([]byte("0123456789"), (6<<20)/10)
+
+	written, err := driver.Put(
+		&api.FileData{Identifier: "identifier"}, bytes.NewReader(content),
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), written)
+	assert.Equal(t, content, fake.objects["identifier"])
+	assert.Empty(t, fake.uploads)
+}
+
+func TestS3StoragePutAbortsOnReadError(t *testing.T) {
+	fake, driver := newTestS3Driver(t, "")
+
+	_, err := driver.Put(&api.FileData{Identifier: "identifier"}, failingReader{})
+
+	assert.Equal(t, base.NewFilesRequestError(fmt.Errorf("connection reset")), err)
+	assert.NotContains(t, fake.objects, "identifier")
+	assert.Empty(t, fake.uploads)
+	assert.Equal(t, 1, fake.aborted)
+}
+
+func TestS3StorageMissingObject(t *testing.T) {
+	_, driver := newTestS3Driver(t, "")
+
+	_, err := driver.Stat("identifier")
+	assert.Equal(t, base.NewFileNotFoundError("identifier"), err)
+	stream, err := driver.Get("identifier")
+	assert.Nil(t, stream)
+	assert.Equal(t, base.NewFileNotFoundError("identifier"), err)
+	assert.Equal(t, base.NewFileNotFoundError("identifier"), driver.Delete("identifier"))
+}
+
+func TestS3StorageDelete(t *testing.T) {
+	fake, driver := newTestS3Driver(t, "files/")
+	fake.objects["files/identifier"] = []byte("data")
+
+	assert.Nil(t, driver.Delete("identifier"))
+	assert.Empty(t, fake.objects)
+}
+
+func TestS3StorageCheckBucket(t *testing.T) {
+	_, driver := newTestS3Driver(t, "")
+	assert.Nil(t, driver.CheckBucket())
+
+	driver.Config.Bucket = "missing"
+	assert.Error(t, driver.CheckBucket())
+}
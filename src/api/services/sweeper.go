@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"time"
+)
+
+type SweepResult struct {
+	FilesDeleted         int64
+	FilesMetadataDeleted int64
+	UploadsDeleted       int64
+	BundlesDeleted       int64
+	ShareLinksDeleted    int64
+	FileAccessesDeleted  int64
+}
+
+type ExpirationSweeper struct {
+	FilesService         BaseFilesService
+	FilesMetadataService BaseFilesMetadataService
+	UploadsService       BaseUploadsService
+	BundlesService       BaseBundlesService
+	ShareLinksService    BaseShareLinksService
+	FileAccessLogService BaseFileAccessLogService
+	UserService          BaseUserService
+	Config               *base.SweeperConfig
+}
+
+// Sweep purges expired files batch by batch until no expired metadata
+// is left or the context is cancelled. File data is removed before its
+// metadata, so an interrupted run is picked up again on the next one.
+// Share links are removed with their files.
+// Expired resumable uploads, bundles and access log records are removed
+// afterwards.
+func (sweeper ExpirationSweeper) Sweep(ctx context.Context) (*SweepResult, error) {
+	result := &SweepResult{}
+	for ctx.Err() == nil {
+		files, err := sweeper.FilesMetadataService.GetExpiredFiles(
+			sweeper.Config.BatchSize,
+		)
+		if err != nil {
+			return result, err
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		fileIds := make([]string, len(files))
+		for i, file := range files {
+			fileIds[i] = file.Identifier
+		}
+		deleted, err := sweeper.FilesService.DeleteFiles(fileIds)
+		if err != nil {
+			return result, err
+		}
+		result.FilesDeleted += deleted
+
+		if err = sweeper.deleteFilesMetadata(files, result); err != nil {
+			return result, err
+		}
+		deleted, err = sweeper.ShareLinksService.DeleteShareLinks(fileIds)
+		if err != nil {
+			return result, err
+		}
+		result.ShareLinksDeleted += deleted
+
+		if int64(len(files)) < sweeper.Config.BatchSize {
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		return result, nil
+	}
+	if err := sweeper.sweepUploads(ctx, result); err != nil || ctx.Err() != nil {
+		return result, err
+	}
+
+	deleted, err := sweeper.BundlesService.DeleteExpiredBundles()
+	result.BundlesDeleted = deleted
+	if err != nil {
+		return result, err
+	}
+	deleted, err = sweeper.FileAccessLogService.DeleteExpiredFileAccesses()
+	result.FileAccessesDeleted = deleted
+	return result, err
+}
+
+// deleteFilesMetadata deletes metadata of expired files one by one, so
+// storage usage is released only for files deleted by the sweeper and not
+// by their owners meanwhile.
+func (sweeper ExpirationSweeper) deleteFilesMetadata(
+	files []api.FileMetadata,
+	result *SweepResult,
+) error {
+	released := map[string]*api.UserUsage{}
+	defer sweeper.releaseStorage(released)
+
+	for _, file := range files {
+		err := sweeper.FilesMetadataService.DeleteFileMetadata(file.Identifier)
+		if isFileNotFoundError(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		result.FilesMetadataDeleted++
+
+		usage, exists := released[file.Username]
+		if !exists {
+			usage = &api.UserUsage{}
+			released[file.Username] = usage
+		}
+		usage.Files++
+		usage.Bytes += file.Size
+	}
+	return nil
+}
+
+// releaseStorage uncounts purged files of their owners. Errors are only
+// logged since the files are already deleted.
+func (sweeper ExpirationSweeper) releaseStorage(released map[string]*api.UserUsage) {
+	for username, usage := range released {
+		if err := sweeper.UserService.ReleaseStorage(username, usage); err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"username": username,
+				"error":    err.Error(),
+			}).Error("Release storage usage error")
+		}
+	}
+}
+
+// sweepUploads removes expired resumable uploads together with chunks of
+// their content.
+func (sweeper ExpirationSweeper) sweepUploads(
+	ctx context.Context,
+	result *SweepResult,
+) error {
+	for ctx.Err() == nil {
+		uploads, err := sweeper.UploadsService.GetExpiredUploads(
+			sweeper.Config.BatchSize,
+		)
+		if err != nil {
+			return err
+		}
+		if len(uploads) == 0 {
+			break
+		}
+
+		var chunkIds []string
+		for _, upload := range uploads {
+			for _, chunk := range upload.Chunks {
+				chunkIds = append(chunkIds, chunk.Identifier)
+			}
+		}
+		if len(chunkIds) > 0 {
+			if _, err := sweeper.FilesService.DeleteFiles(chunkIds); err != nil {
+				return err
+			}
+		}
+		if err = sweeper.deleteUploads(uploads, result); err != nil {
+			return err
+		}
+
+		if int64(len(uploads)) < sweeper.Config.BatchSize {
+			break
+		}
+	}
+	return nil
+}
+
+// deleteUploads deletes expired uploads one by one, so storage reserved
+// on upload creation is released only for uploads neither terminated by
+// their owners nor finished meanwhile. Storage of finished uploads is
+// counted for their files.
+func (sweeper ExpirationSweeper) deleteUploads(
+	uploads []api.Upload,
+	result *SweepResult,
+) error {
+	released := map[string]*api.UserUsage{}
+	defer sweeper.releaseStorage(released)
+
+	for _, upload := range uploads {
+		deleted, err := sweeper.UploadsService.DeleteUpload(upload.Identifier)
+		if isFileNotFoundError(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		result.UploadsDeleted++
+		if deleted.FileIdentifier != "" {
+			continue
+		}
+
+		usage, exists := released[deleted.Username]
+		if !exists {
+			usage = &api.UserUsage{}
+			released[deleted.Username] = usage
+		}
+		usage.Files++
+		usage.Bytes += deleted.Length
+	}
+	return nil
+}
+
+func (sweeper ExpirationSweeper) sweepAndLog(ctx context.Context) {
+	started := time.Now()
+	result, err := sweeper.Sweep(ctx)
+	fields := logrus.Fields{
+		"files_deleted":          result.FilesDeleted,
+		"files_metadata_deleted": result.FilesMetadataDeleted,
+		"uploads_deleted":        result.UploadsDeleted,
+		"bundles_deleted":        result.BundlesDeleted,
+		"share_links_deleted":    result.ShareLinksDeleted,
+		"file_accesses_deleted":  result.FileAccessesDeleted,
+		"duration_ms":            time.Since(started).Milliseconds(),
+	}
+
+	if err != nil {
+		fields["error"] = err.Error()
+		base.Logger.WithFields(fields).Error("Expired files purge error")
+	} else if result.FilesMetadataDeleted > 0 || result.FilesDeleted > 0 ||
+		result.UploadsDeleted > 0 || result.BundlesDeleted > 0 ||
+		result.FileAccessesDeleted > 0 {
+		base.Logger.WithFields(fields).Info("Expired files purged")
+	} else {
+		base.Logger.WithFields(fields).Debug("No expired files to purge")
+	}
+}
+
+// Run purges expired files immediately and then once per configured
+// interval. It blocks until the context is cancelled.
+func (sweeper ExpirationSweeper) Run(ctx context.Context) {
+	interval := time.Duration(sweeper.Config.SecondsInterval) * time.Second
+	base.Logger.WithFields(logrus.Fields{
+		"interval_seconds": sweeper.Config.SecondsInterval,
+		"batch_size":       sweeper.Config.BatchSize,
+	}).Info("Starting expiration sweeper")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sweeper.sweepAndLog(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			base.Logger.Info("Expiration sweeper stopped")
+			return
+		case <-ticker.C:
+			sweeper.sweepAndLog(ctx)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"stealthy-backend/tests"
+	"testing"
+)
+
+func expiredFile(fileId string, username string, size int64) api.FileMetadata {
+	return api.FileMetadata{Identifier: fileId, Username: username, Size: size}
+}
+
+func TestSweepExpiredFiles(t *testing.T) {
+	config := &base.SweeperConfig{SecondsInterval: 1, BatchSize: 2}
+	firstBatch := []api.FileMetadata{
+		expiredFile("first", "john_doe", 10), expiredFile("second", "john_doe", 5),
+	}
+	secondBatch := []api.FileMetadata{expiredFile("third", "jane_doe", 7)}
+
+	filesServiceMock := tests.NewBaseFilesService(t)
+	metadataServiceMock := tests.NewBaseFilesMetadataService(t)
+	metadataServiceMock.On("GetExpiredFiles", int64(2)).Return(
+		firstBatch, nil,
+	).Once()
+	metadataServiceMock.On("GetExpiredFiles", int64(2)).Return(
+		secondBatch, nil,
+	).Once()
+	filesServiceMock.On("DeleteFiles", []string{"first", "second"}).Return(int64(2), nil)
+	filesServiceMock.On("DeleteFiles", []string{"third"}).Return(int64(1), nil)
+	metadataServiceMock.On("DeleteFileMetadata", "first").Return(nil)
+	metadataServiceMock.On("DeleteFileMetadata", "second").Return(nil)
+	metadataServiceMock.On("DeleteFileMetadata", "third").Return(nil)
+	userServiceMock := tests.NewBaseUserService(t)
+	userServiceMock.On("ReleaseStorage", "john_doe", &api.UserUsage{Files: 2, Bytes: 15}).
+		Return(nil)
+	userServiceMock.On("ReleaseStorage", "jane_doe", &api.UserUsage{Files: 1, Bytes: 7}).
+		Return(nil)
+	uploadsServiceMock := tests.NewBaseUploadsService(t)
+	uploadsServiceMock.On("GetExpiredUploads", int64(2)).Return([]api.Upload{}, nil)
+	bundlesServiceMock := tests.NewBaseBundlesService(t)
+	bundlesServiceMock.On("DeleteExpiredBundles").Return(int64(0), nil)
+	accessLogServiceMock := tests.NewBaseFileAccessLogService(t)
+	accessLogServiceMock.On("DeleteExpiredFileAccesses").Return(int64(0), nil)
+	shareLinksServiceMock := tests.NewBaseShareLinksService(t)
+	shareLinksServiceMock.On("DeleteShareLinks", []string{"first", "second"}).Return(
+		int64(2), nil,
+	)
+	shareLinksServiceMock.On("DeleteShareLinks", []string{"third"}).Return(int64(0), nil)
+
+	sweeper := ExpirationSweeper{
+		FilesService:         filesServiceMock,
+		FilesMetadataService: metadataServiceMock,
+		UploadsService:       uploadsServiceMock,
+		BundlesService:       bundlesServiceMock,
+		FileAccessLogService: accessLogServiceMock,
+		ShareLinksService:    shareLinksServiceMock,
+		UserService:          userServiceMock,
+		Config:               config,
+	}
+	result, err := sweeper.Sweep(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, &SweepResult{
+		FilesDeleted: 3, FilesMetadataDeleted: 3, ShareLinksDeleted: 2,
+	}, result)
+}
+
+func TestSweepSkipsFilesDeletedByOwner(t *testing.T) {
+	config := &base.SweeperConfig{SecondsInterval: 1, BatchSize: 10}
+	files := []api.FileMetadata{
+		expiredFile("first", "john_doe", 10), expiredFile("second", "john_doe", 5),
+	}
+
+	filesServiceMock := tests.NewBaseFilesService(t)
+	metadataServiceMock := tests.NewBaseFilesMetadataService(t)
+	metadataServiceMock.On("GetExpiredFiles", int64(10)).Return(files, nil)
+	filesServiceMock.On("DeleteFiles", []string{"first", "second"}).Return(int64(1), nil)
+	metadataServiceMock.On("DeleteFileMetadata", "first").Return(
+		base.NewFileNotFoundError("first"),
+	)
+	metadataServiceMock.On("DeleteFileMetadata", "second").Return(nil)
+	userServiceMock := tests.NewBaseUserService(t)
+	userServiceMock.On("ReleaseStorage", "john_doe", &api.UserUsage{Files: 1, Bytes: 5}).
+		Return(nil)
+	uploadsServiceMock := tests.NewBaseUploadsService(t)
+	uploadsServiceMock.On("GetExpiredUploads", int64(10)).Return([]api.Upload{}, nil)
+	bundlesServiceMock := tests.NewBaseBundlesService(t)
+	bundlesServiceMock.On("DeleteExpiredBundles").Return(int64(0), nil)
+	accessLogServiceMock := tests.NewBaseFileAccessLogService(t)
+	accessLogServiceMock.On("DeleteExpiredFileAccesses").Return(int64(0), nil)
+	shareLinksServiceMock := tests.NewBaseShareLinksService(t)
+	shareLinksServiceMock.On("DeleteShareLinks", []string{"first", "second"}).Return(
+		int64(0), nil,
+	)
+
+	sweeper := ExpirationSweeper{
+		FilesService:         filesServiceMock,
+		FilesMetadataService: metadataServiceMock,
+		UploadsService:       uploadsServiceMock,
+		BundlesService:       bundlesServiceMock,
+		FileAccessLogService: accessLogServiceMock,
+		ShareLinksService:    shareLinksServiceMock,
+		UserService:          userServiceMock,
+		Config:               config,
+	}
+	result, err := sweeper.Sweep(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, &SweepResult{FilesDeleted: 1, FilesMetadataDeleted: 1}, result)
+}
+
+func TestSweepKeepsMetadataOnFilesDeleteError(t *testing.T) {
+	config := &base.SweeperConfig{SecondsInterval: 1, BatchSize: 10}
+	fileIds := []string{"first"}
+	expectedError := base.NewDatabaseError(errors.New("connection lost"))
+
+	filesServiceMock := tests.NewBaseFilesService(t)
+	metadataServiceMock := tests.NewBaseFilesMetadataService(t)
+	metadataServiceMock.On("GetExpiredFiles", int64(10)).Return(
+		[]api.FileMetadata{expiredFile("first", "john_doe", 10)}, nil,
+	)
+	filesServiceMock.On("DeleteFiles", fileIds).Return(int64(0), expectedError)
+
+	sweeper := ExpirationSweeper{
+		FilesService:         filesServiceMock,
+		FilesMetadataService: metadataServiceMock,
+		Config:               config,
+	}
+	result, err := sweeper.Sweep(context.TODO())
+
+	assert.Equal(t, expectedError, err)
+	assert.Equal(t, &SweepResult{}, result)
+	metadataServiceMock.AssertNotCalled(t, "DeleteFileMetadata", "first")
+}
+
+func TestSweepExpiredUploadsBundlesAndAccesses(t *testing.T) {
+	config := &base.SweeperConfig{SecondsInterval: 1, BatchSize: 10}
+	uploads := []api.Upload{
+		{Identifier: "first", Username: "john_doe", Length: 20, Chunks: []api.UploadChunk{
+			{Identifier: "chunk1", Size: 10},
+			{Identifier: "chunk2", Size: 5},
+		}},
+		{Identifier: "second", Username: "john_doe", Length: 8, Chunks: []api.UploadChunk{}},
+		{Identifier: "finished", Username: "john_doe", FileIdentifier: "file"},
+		{Identifier: "terminated", Username: "john_doe", Length: 4},
+	}
+
+	filesServiceMock := tests.NewBaseFilesService(t)
+	metadataServiceMock := tests.NewBaseFilesMetadataService(t)
+	metadataServiceMock.On("GetExpiredFiles", int64(10)).Return(
+		[]api.FileMetadata{}, nil,
+	)
+	uploadsServiceMock := tests.NewBaseUploadsService(t)
+	uploadsServiceMock.On("GetExpiredUploads", int64(10)).Return(uploads, nil)
+	filesServiceMock.On("DeleteFiles", []string{"chunk1", "chunk2"}).Return(
+		int64(2), nil,
+	)
+	for i := range uploads[:3] {
+		uploadsServiceMock.On("DeleteUpload", uploads[i].Identifier).Return(
+			&uploads[i], nil,
+		)
+	}
+	uploadsServiceMock.On("DeleteUpload", "terminated").Return(
+		nil, base.NewUploadNotFoundError("terminated"),
+	)
+	userServiceMock := tests.NewBaseUserService(t)
+	userServiceMock.On("ReleaseStorage", "john_doe", &api.UserUsage{Files: 2, Bytes: 28}).
+		Return(nil)
+	bundlesServiceMock := tests.NewBaseBundlesService(t)
+	bundlesServiceMock.On("DeleteExpiredBundles").Return(int64(3), nil)
+	accessLogServiceMock := tests.NewBaseFileAccessLogService(t)
+	accessLogServiceMock.On("DeleteExpiredFileAccesses").Return(int64(4), nil)
+
+	sweeper := ExpirationSweeper{
+		FilesService:         filesServiceMock,
+		FilesMetadataService: metadataServiceMock,
+		UploadsService:       uploadsServiceMock,
+		BundlesService:       bundlesServiceMock,
+		FileAccessLogService: accessLogServiceMock,
+		UserService:          userServiceMock,
+		Config:               config,
+	}
+	result, err := sweeper.Sweep(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, &SweepResult{
+		UploadsDeleted: 3, BundlesDeleted: 3, FileAccessesDeleted: 4,
+	}, result)
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sv-tools/mongoifc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"time"
+)
+
+type BaseUploadsService interface {
+	AddUpload(upload *api.Upload) error
+	GetUploadByOwner(uploadId string, username string) (*api.Upload, error)
+	AppendUploadChunk(
+		uploadId string,
+		offset int64,
+		chunk *api.UploadChunk,
+	) (*api.Upload, error)
+	FinishUpload(uploadId string, fileId string) (*api.Upload, error)
+	DeleteUpload(uploadId string) (*api.Upload, error)
+	GetExpiredUploads(limit int64) ([]api.Upload, error)
+}
+
+type UploadsService struct {
+	BaseUploadsService
+	Context    *context.Context
+	Collection mongoifc.Collection
+	Config     *base.UploadsConfig
+}
+
+func IsUploadExpired(upload *api.Upload) bool {
+	return !upload.ExpirationDate.After(time.Now())
+}
+
+func (service UploadsService) AddUpload(upload *api.Upload) error {
+	if _, err := service.Collection.InsertOne(*service.Context, upload); err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
+
+func (service UploadsService) findUpload(uploadId string) (*api.Upload, error) {
+	var upload api.Upload
+	err := service.Collection.FindOne(*service.Context, bson.D{
+		primitive.E{Key: "identifier", Value: uploadId},
+	}).Decode(&upload)
+
+	if err == nil {
+		return &upload, nil
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewUploadNotFoundError(uploadId)
+	} else {
+		return nil, base.NewDatabaseError(err)
+	}
+}
+
+// GetUploadByOwner returns not expired upload if it was started by the
+// specified user.
+func (service UploadsService) GetUploadByOwner(
+	uploadId string,
+	username string,
+) (*api.Upload, error) {
+	upload, err := service.findUpload(uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Username != username {
+		return nil, base.NewUploadAccessDeniedError(uploadId)
+	}
+	if IsUploadExpired(upload) {
+		return nil, base.NewUploadExpiredError(uploadId)
+	}
+	return upload, nil
+}
+
+// AppendUploadChunk registers stored chunk and moves upload offset if the
+// upload is still at the expected offset, so concurrent requests can not
+// both append content at the same position. Upload expiration is
+// prolonged.
+func (service UploadsService) AppendUploadChunk(
+	uploadId string,
+	offset int64,
+	chunk *api.UploadChunk,
+) (*api.Upload, error) {
+	filter := bson.D{
+		primitive.E{Key: "identifier", Value: uploadId},
+		primitive.E{Key: "offset", Value: offset},
+		primitive.E{Key: "file_identifier", Value: bson.D{
+			primitive.E{Key: "$exists", Value: false},
+		}},
+	}
+	update := bson.D{
+		primitive.E{Key: "$inc", Value: bson.D{
+			primitive.E{Key: "offset", Value: chunk.Size},
+		}},
+		primitive.E{Key: "$push", Value: bson.D{
+			primitive.E{Key: "chunks", Value: chunk},
+		}},
+		primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "expiration_date", Value: service.Config.Expiration(time.Now())},
+		}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var upload api.Upload
+	err := service.Collection.FindOneAndUpdate(
+		*service.Context, filter, update, opts,
+	).Decode(&upload)
+	if err == nil {
+		return &upload, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewDatabaseError(err)
+	}
+
+	current, err := service.findUpload(uploadId)
+	if err != nil {
+		return nil, err
+	}
+	return nil, base.NewUploadOffsetError(uploadId, current.Offset)
+}
+
+// FinishUpload links the upload with the created file and forgets its
+// chunks if the upload is not finished yet, so concurrent requests can not
+// both finish it. Upload finished before is returned unchanged, callers
+// compare its file identifier to find out whether their file was linked.
+func (service UploadsService) FinishUpload(
+	uploadId string,
+	fileId string,
+) (*api.Upload, error) {
+	filter := bson.D{
+		primitive.E{Key: "identifier", Value: uploadId},
+		primitive.E{Key: "file_identifier", Value: bson.D{
+			primitive.E{Key: "$exists", Value: false},
+		}},
+	}
+	update := bson.D{
+		primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "file_identifier", Value: fileId},
+			primitive.E{Key: "chunks", Value: bson.A{}},
+		}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var upload api.Upload
+	err := service.Collection.FindOneAndUpdate(
+		*service.Context, filter, update, opts,
+	).Decode(&upload)
+	if err == nil {
+		return &upload, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewDatabaseError(err)
+	}
+
+	current, err := service.findUpload(uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if current.FileIdentifier == "" {
+		return nil, base.NewUploadNotFoundError(uploadId)
+	}
+	return current, nil
+}
+
+// DeleteUpload returns the upload as it was deleted, so callers find out
+// whether it was finished meanwhile.
+func (service UploadsService) DeleteUpload(uploadId string) (*api.Upload, error) {
+	var upload api.Upload
+	err := service.Collection.FindOneAndDelete(*service.Context, bson.D{
+		primitive.E{Key: "identifier", Value: uploadId},
+	}).Decode(&upload)
+	if err == nil {
+		return &upload, nil
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, base.NewUploadNotFoundError(uploadId)
+	} else {
+		return nil, base.NewDatabaseError(err)
+	}
+}
+
+func (service UploadsService) GetExpiredUploads(limit int64) ([]api.Upload, error) {
+	findOptions := options.Find().
+		SetLimit(limit).
+		SetSort(bson.M{"expiration_date": 1})
+	filter := bson.D{
+		primitive.E{Key: "expiration_date", Value: bson.D{
+			primitive.E{Key: "$lte", Value: time.Now()},
+		}},
+	}
+
+	cursor, err := service.Collection.Find(*service.Context, filter, findOptions)
+	if err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+	defer func(cursor mongoifc.Cursor, ctx *context.Context) {
+		err := cursor.Close(*ctx)
+		if err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Close cursor error")
+		}
+	}(cursor, service.Context)
+
+	uploads := []api.Upload{}
+	for cursor.Next(*service.Context) {
+		var upload api.Upload
+		if err := cursor.Decode(&upload); err != nil {
+			return nil, base.NewDatabaseError(err)
+		}
+		uploads = append(uploads, upload)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, base.NewDatabaseError(err)
+	}
+
+	return uploads, nil
+}
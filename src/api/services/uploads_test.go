@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"github.com/jinzhu/copier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"testing"
+	"time"
+)
+
+func newUploadFixture() api.Upload {
+	return api.Upload{
+		Identifier:     "upload",
+		Username:       "username",
+		Length:         8,
+		Offset:         4,
+		Chunks:         []api.UploadChunk{{Identifier: "chunk", Size: 4}},
+		ExpirationDate: time.Now().Add(time.Hour),
+	}
+}
+
+func mockFindUpload(
+	collectionMock *mongoMock.Collection,
+	dbContext context.Context,
+	upload *api.Upload,
+	err error,
+) {
+	resultMock := new(mongoMock.SingleResult)
+	resultMock.On("Decode", &api.Upload{}).Return(func(v interface{}) error {
+		if v != nil && err == nil {
+			copier.Copy(v, upload)
+		}
+		return err
+	})
+	collectionMock.On("FindOne", dbContext, bson.D{
+		primitive.E{Key: "identifier", Value: upload.Identifier},
+	}).Return(resultMock)
+}
+
+func TestGetUploadByOwner(t *testing.T) {
+	dbContext := context.TODO()
+	upload := newUploadFixture()
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindUpload(collectionMock, dbContext, &upload, nil)
+
+	service := UploadsService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.GetUploadByOwner(upload.Identifier, upload.Username)
+
+	assert.Nil(t, err)
+	assert.Equal(t, upload.Offset, result.Offset)
+	assert.Equal(t, upload.Chunks, result.Chunks)
+}
+
+func TestGetUploadByOwnerAnotherUser(t *testing.T) {
+	dbContext := context.TODO()
+	upload := newUploadFixture()
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindUpload(collectionMock, dbContext, &upload, nil)
+
+	service := UploadsService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.GetUploadByOwner(upload.Identifier, "another_user")
+
+	assert.Nil(t, result)
+	assert.Equal(t, base.NewUploadAccessDeniedError(upload.Identifier), err)
+}
+
+func TestGetUploadByOwnerExpired(t *testing.T) {
+	dbContext := context.TODO()
+	upload := newUploadFixture()
+	upload.ExpirationDate = time.Now().Add(-time.Minute)
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindUpload(collectionMock, dbContext, &upload, nil)
+
+	service := UploadsService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.GetUploadByOwner(upload.Identifier, upload.Username)
+
+	assert.Nil(t, result)
+	assert.Equal(t, base.NewUploadExpiredError(upload.Identifier), err)
+}
+
+func TestGetUploadByOwnerNotFound(t *testing.T) {
+	dbContext := context.TODO()
+	upload := newUploadFixture()
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindUpload(collectionMock, dbContext, &upload, mongo.ErrNoDocuments)
+
+	service := UploadsService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.GetUploadByOwner(upload.Identifier, upload.Username)
+
+	assert.Nil(t, result)
+	assert.Equal(t, base.NewUploadNotFoundError(upload.Identifier), err)
+}
+
+func TestAppendUploadChunkOffsetMismatch(t *testing.T) {
+	dbContext := context.TODO()
+	upload := newUploadFixture()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	collectionMock := new(mongoMock.Collection)
+	updateResultMock := new(mongoMock.SingleResult)
+	updateResultMock.On("Decode", &api.Upload{}).Return(mongo.ErrNoDocuments)
+	collectionMock.On(
+		"FindOneAndUpdate", dbContext, mock.MatchedBy(func(filter bson.D) bool {
+			return filter[1].Value == int64(0)
+		}), mock.Anything, opts,
+	).Return(updateResultMock)
+	mockFindUpload(collectionMock, dbContext, &upload, nil)
+
+	service := UploadsService{
+		Context:    &dbContext,
+		Collection: collectionMock,
+		Config:     &base.UploadsConfig{MinutesExpiration: 60},
+	}
+	result, err := service.AppendUploadChunk(
+		upload.Identifier, 0, &api.UploadChunk{Identifier: "other", Size: 4},
+	)
+
+	assert.Nil(t, result)
+	assert.Equal(t, base.NewUploadOffsetError(upload.Identifier, upload.Offset), err)
+}
+
+func TestFinishUpload(t *testing.T) {
+	dbContext := context.TODO()
+	upload := newUploadFixture()
+	upload.FileIdentifier = "file"
+	upload.Chunks = []api.UploadChunk{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	collectionMock := new(mongoMock.Collection)
+	updateResultMock := new(mongoMock.SingleResult)
+	updateResultMock.On("Decode", &api.Upload{}).Return(func(v interface{}) error {
+		copier.Copy(v, &upload)
+		return nil
+	})
+	collectionMock.On(
+		"FindOneAndUpdate", dbContext, bson.D{
+			primitive.E{Key: "identifier", Value: upload.Identifier},
+			primitive.E{Key: "file_identifier", Value: bson.D{
+				primitive.E{Key: "$exists", Value: false},
+			}},
+		}, mock.Anything, opts,
+	).Return(updateResultMock)
+
+	service := UploadsService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.FinishUpload(upload.Identifier, "file")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "file", result.FileIdentifier)
+	collectionMock.AssertNotCalled(t, "FindOne", mock.Anything, mock.Anything)
+}
+
+func TestFinishUploadAlreadyFinished(t *testing.T) {
+	dbContext := context.TODO()
+	upload := newUploadFixture()
+	upload.FileIdentifier = "finished_file"
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	collectionMock := new(mongoMock.Collection)
+	updateResultMock := new(mongoMock.SingleResult)
+	updateResultMock.On("Decode", &api.Upload{}).Return(mongo.ErrNoDocuments)
+	collectionMock.On(
+		"FindOneAndUpdate", dbContext, mock.Anything, mock.Anything, opts,
+	).Return(updateResultMock)
+	mockFindUpload(collectionMock, dbContext, &upload, nil)
+
+	service := UploadsService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.FinishUpload(upload.Identifier, "file")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "finished_file", result.FileIdentifier)
+}
+
+func TestDeleteUpload(t *testing.T) {
+	dbContext := context.TODO()
+	upload := newUploadFixture()
+
+	collectionMock := new(mongoMock.Collection)
+	deleteResultMock := new(mongoMock.SingleResult)
+	deleteResultMock.On("Decode", &api.Upload{}).Return(func(v interface{}) error {
+		copier.Copy(v, &upload)
+		return nil
+	})
+	collectionMock.On("FindOneAndDelete", dbContext, bson.D{
+		primitive.E{Key: "identifier", Value: upload.Identifier},
+	}).Return(deleteResultMock)
+
+	service := UploadsService{Context: &dbContext, Collection: collectionMock}
+	result, err := service.DeleteUpload(upload.Identifier)
+
+	assert.Nil(t, err)
+	assert.Equal(t, upload.Length, result.Length)
+	assert.Empty(t, result.FileIdentifier)
+}
+
+func TestDeleteUploadNotFound(t *testing.T) {
+	dbContext := context.TODO()
+
+	collectionMock := new(mongoMock.Collection)
+	deleteResultMock := new(mongoMock.SingleResult)
+	deleteResultMock.On("Decode", &api.Upload{}).Return(mongo.ErrNoDocuments)
+	collectionMock.On("FindOneAndDelete", dbContext, mock.Anything).Return(
+		deleteResultMock,
+	)
+
+	service := UploadsService{Context: &dbContext, Collection: collectionMock}
+	_, err := service.DeleteUpload("upload")
+
+	assert.Equal(t, base.NewUploadNotFoundError("upload"), err)
+}
@@ -23,18 +23,29 @@ func GeneratePasswordHash(rawValue string) ([]byte, error) {
 	return bcrypt.GenerateFromPassword([]byte(rawValue), base.PasswordCost)
 }
 
+func newUserAlreadyExistsError(username string) base.ServiceError {
+	return base.ServiceError{
+		Summary: fmt.Sprintf("User '%s' already exist", username),
+		Status:  http.StatusBadRequest,
+	}
+}
+
 type BaseUserService interface {
 	CheckUserExists(request *api.SignUpRequest) (bool, error)
 	AddUser(request *api.SignUpRequest) (*api.UserResponse, error)
 	GetUserByUsername(username string) (*api.User, error)
 	GetUserPublicData(username string) (*api.UserResponse, error)
 	GetUserByCredentials(request *api.SignInRequest) (*api.User, error)
+	GetUserStorage(username string) (*api.UserStorage, error)
+	ReserveStorage(username string, size int64) error
+	ReleaseStorage(username string, usage *api.UserUsage) error
 }
 
 type UserService struct {
 	BaseUserService
 	Context    *context.Context
 	Collection mongoifc.Collection
+	Quota      *base.QuotaConfig
 }
 
 func (service *UserService) CheckUserExists(request *api.SignUpRequest) (bool, error) {
@@ -57,11 +68,7 @@ func (service *UserService) AddUser(request *api.SignUpRequest) (*api.UserRespon
 	if exists && err != nil {
 		return nil, err
 	} else if exists {
-		err := base.ServiceError{
-			Summary: fmt.Sprintf("User '%s' already exist", request.Username),
-			Status:  http.StatusBadRequest,
-		}
-		return nil, err
+		return nil, newUserAlreadyExistsError(request.Username)
 	} else {
 		bytes, err := GeneratePasswordHash(request.Password)
 		user := api.User{
@@ -77,6 +84,9 @@ func (service *UserService) AddUser(request *api.SignUpRequest) (*api.UserRespon
 		}
 
 		if _, err := service.Collection.InsertOne(*service.Context, &user); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, newUserAlreadyExistsError(request.Username)
+			}
 			return nil, base.NewDatabaseError(err)
 		}
 		return &api.UserResponse{Username: request.Username}, nil
@@ -108,6 +118,7 @@ func (service *UserService) GetUserPublicData(username string) (*api.UserRespons
 	} else {
 		return &api.UserResponse{
 			Username: user.Username,
+			Storage:  service.userStorage(user),
 		}, nil
 	}
 }
@@ -127,3 +138,112 @@ func (service *UserService) GetUserByCredentials(request *api.SignInRequest) (*a
 		}
 	}
 }
+
+// userStorage returns storage limits of the user, limits set for the user
+// override configured defaults.
+func (service *UserService) userStorage(user *api.User) *api.UserStorage {
+	quota := api.UserQuota{
+		MaxTotalBytes: service.Quota.MaxTotalBytes,
+		MaxFiles:      service.Quota.MaxFiles,
+		MaxFileBytes:  service.Quota.MaxFileBytes,
+	}
+	if user.Quota != nil {
+		if user.Quota.MaxTotalBytes > 0 {
+			quota.MaxTotalBytes = user.Quota.MaxTotalBytes
+		}
+		if user.Quota.MaxFiles > 0 {
+			quota.MaxFiles = user.Quota.MaxFiles
+		}
+		if user.Quota.MaxFileBytes > 0 {
+			quota.MaxFileBytes = user.Quota.MaxFileBytes
+		}
+	}
+	return &api.UserStorage{Quota: quota, Usage: user.Usage}
+}
+
+func (service *UserService) GetUserStorage(username string) (*api.UserStorage, error) {
+	user, err := service.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	return service.userStorage(user), nil
+}
+
+// ReserveStorage counts a new file of the user. Usage is checked against
+// the quota and incremented atomically, so concurrent uploads can not
+// exceed the quota together.
+func (service *UserService) ReserveStorage(username string, size int64) error {
+	storage, err := service.GetUserStorage(username)
+	if err != nil {
+		return err
+	}
+	quota := storage.Quota
+	if quota.MaxFileBytes > 0 && size > quota.MaxFileBytes {
+		return base.NewFileTooLargeError(quota.MaxFileBytes)
+	}
+
+	// Counters are missing in documents of users created before quotas,
+	// $not matches such documents as well.
+	filter := bson.D{primitive.E{Key: "username", Value: username}}
+	if quota.MaxFiles > 0 {
+		filter = append(filter, primitive.E{Key: "usage.files", Value: bson.D{
+			primitive.E{Key: "$not", Value: bson.D{
+				primitive.E{Key: "$gte", Value: quota.MaxFiles},
+			}},
+		}})
+	}
+	if quota.MaxTotalBytes > 0 {
+		filter = append(filter, primitive.E{Key: "usage.bytes", Value: bson.D{
+			primitive.E{Key: "$not", Value: bson.D{
+				primitive.E{Key: "$gt", Value: quota.MaxTotalBytes - size},
+			}},
+		}})
+	}
+	update := bson.D{
+		primitive.E{Key: "$inc", Value: bson.D{
+			primitive.E{Key: "usage.files", Value: 1},
+			primitive.E{Key: "usage.bytes", Value: size},
+		}},
+	}
+
+	result, err := service.Collection.UpdateOne(*service.Context, filter, update)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	if result.MatchedCount == 0 {
+		return base.NewStorageQuotaError(fmt.Sprintf(
+			"Quota allows %d files of %d bytes in total",
+			quota.MaxFiles, quota.MaxTotalBytes,
+		))
+	}
+	return nil
+}
+
+// ReleaseStorage uncounts deleted files of the user. Files uploaded before
+// quotas were introduced are not counted, so counters never drop below
+// zero.
+func (service *UserService) ReleaseStorage(username string, usage *api.UserUsage) error {
+	decrement := func(field string, value int64) bson.D {
+		return bson.D{primitive.E{Key: "$max", Value: bson.A{
+			0,
+			bson.D{primitive.E{Key: "$subtract", Value: bson.A{
+				bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$" + field, 0}}},
+				value,
+			}}},
+		}}}
+	}
+	update := bson.A{
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "usage.files", Value: decrement("usage.files", usage.Files)},
+			primitive.E{Key: "usage.bytes", Value: decrement("usage.bytes", usage.Bytes)},
+		}}},
+	}
+
+	_, err := service.Collection.UpdateOne(*service.Context, bson.D{
+		primitive.E{Key: "username", Value: username},
+	}, update)
+	if err != nil {
+		return base.NewDatabaseError(err)
+	}
+	return nil
+}
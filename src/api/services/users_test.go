@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"github.com/jinzhu/copier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mongoMock "github.com/sv-tools/mongoifc/mocks/mockery"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"stealthy-backend/api"
+	"stealthy-backend/base"
+	"testing"
+)
+
+func mockFindUser(collectionMock *mongoMock.Collection, dbContext context.Context, user *api.User) {
+	resultMock := new(mongoMock.SingleResult)
+	resultMock.On("Decode", &api.User{}).Return(func(v interface{}) error {
+		return copier.Copy(v, user)
+	})
+	collectionMock.On("FindOne", dbContext, bson.D{
+		primitive.E{Key: "username", Value: user.Username},
+	}).Return(resultMock)
+}
+
+func newQuotaUserService(
+	dbContext *context.Context,
+	collectionMock *mongoMock.Collection,
+) *UserService {
+	return &UserService{
+		Context:    dbContext,
+		Collection: collectionMock,
+		Quota:      &base.QuotaConfig{MaxTotalBytes: 1000, MaxFiles: 10},
+	}
+}
+
+func TestGetUserStorageOverridesQuota(t *testing.T) {
+	dbContext := context.TODO()
+	user := &api.User{
+		Username: "john_doe",
+		Quota:    &api.UserQuota{MaxFiles: 50, MaxFileBytes: 100},
+		Usage:    api.UserUsage{Bytes: 300, Files: 3},
+	}
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindUser(collectionMock, dbContext, user)
+
+	service := newQuotaUserService(&dbContext, collectionMock)
+	storage, err := service.GetUserStorage(user.Username)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &api.UserStorage{
+		Quota: api.UserQuota{MaxTotalBytes: 1000, MaxFiles: 50, MaxFileBytes: 100},
+		Usage: user.Usage,
+	}, storage)
+}
+
+func TestReserveStorage(t *testing.T) {
+	dbContext := context.TODO()
+	user := &api.User{Username: "john_doe"}
+	expectedFilter := bson.D{
+		primitive.E{Key: "username", Value: user.Username},
+		primitive.E{Key: "usage.files", Value: bson.D{
+			primitive.E{Key: "$not", Value: bson.D{
+				primitive.E{Key: "$gte", Value: int64(10)},
+			}},
+		}},
+		primitive.E{Key: "usage.bytes", Value: bson.D{
+			primitive.E{Key: "$not", Value: bson.D{
+				primitive.E{Key: "$gt", Value: int64(900)},
+			}},
+		}},
+	}
+	expectedUpdate := bson.D{
+		primitive.E{Key: "$inc", Value: bson.D{
+			primitive.E{Key: "usage.files", Value: 1},
+			primitive.E{Key: "usage.bytes", Value: int64(100)},
+		}},
+	}
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindUser(collectionMock, dbContext, user)
+	collectionMock.On("UpdateOne", dbContext, expectedFilter, expectedUpdate).Return(
+		&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil,
+	)
+
+	service := newQuotaUserService(&dbContext, collectionMock)
+	err := service.ReserveStorage(user.Username, 100)
+
+	assert.Nil(t, err)
+	collectionMock.AssertExpectations(t)
+}
+
+func TestReserveStorageQuotaExceeded(t *testing.T) {
+	dbContext := context.TODO()
+	user := &api.User{Username: "john_doe"}
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindUser(collectionMock, dbContext, user)
+	collectionMock.On("UpdateOne", dbContext, mock.Anything, mock.Anything).Return(
+		&mongo.UpdateResult{}, nil,
+	)
+
+	service := newQuotaUserService(&dbContext, collectionMock)
+	err := service.ReserveStorage(user.Username, 100)
+
+	assert.Equal(t, http.StatusInsufficientStorage, err.(base.ServiceError).Status)
+}
+
+func TestReserveStorageFileTooLarge(t *testing.T) {
+	dbContext := context.TODO()
+	user := &api.User{Username: "john_doe", Quota: &api.UserQuota{MaxFileBytes: 50}}
+
+	collectionMock := new(mongoMock.Collection)
+	mockFindUser(collectionMock, dbContext, user)
+
+	service := newQuotaUserService(&dbContext, collectionMock)
+	err := service.ReserveStorage(user.Username, 100)
+
+	assert.Equal(t, base.NewFileTooLargeError(50), err)
+	collectionMock.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestReleaseStorage(t *testing.T) {
+	dbContext := context.TODO()
+
+	collectionMock := new(mongoMock.Collection)
+	collectionMock.On("UpdateOne", dbContext, bson.D{
+		primitive.E{Key: "username", Value: "john_doe"},
+	}, mock.AnythingOfType("primitive.A")).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+
+	service := newQuotaUserService(&dbContext, collectionMock)
+	err := service.ReleaseStorage("john_doe", &api.UserUsage{Files: 1, Bytes: 100})
+
+	assert.Nil(t, err)
+	collectionMock.AssertExpectations(t)
+}
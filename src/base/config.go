@@ -6,6 +6,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 	"os"
+	"time"
 )
 
 type MongoDBConfig struct {
@@ -25,10 +26,170 @@ type ServerConfig struct {
 	OpenapiBasePath        string    `yaml:"openapiBasePath"`
 	JwtConfig              JwtConfig `yaml:"jwtConfig" validate:"required"`
 	PaginationDefaultLimit int64     `yaml:"paginationDefaultLimit" validate:"required,gt=1"`
+	SecondsShutdownTimeout int       `yaml:"secondsShutdownTimeout" validate:"required,gt=0"`
+	// Addresses or networks of proxies whose X-Forwarded-For header tells
+	// the client address, it is ignored if sent by other clients.
+	TrustedProxies []string `yaml:"trustedProxies" validate:"dive,ip|cidr"`
 }
 
 type FilesExpirationConfig struct {
-	MinutesLifetimeDefault uint64 `yaml:"minutesLifetimeDefault" validate:"required,gt=0"`
+	MinutesLifetimeDefault uint64 `yaml:"minutesLifetimeDefault" validate:"required,gt=0,gtefield=MinutesLifetimeMin,ltefield=MinutesLifetimeMax"`
+	MinutesLifetimeMin     uint64 `yaml:"minutesLifetimeMin" validate:"required,gt=0"`
+	MinutesLifetimeMax     uint64 `yaml:"minutesLifetimeMax" validate:"required,gtefield=MinutesLifetimeMin"`
+	TTLIndexes             bool   `yaml:"ttlIndexes"`
+}
+
+func (cfg *FilesExpirationConfig) DefaultLifetime() time.Duration {
+	return time.Minute * time.Duration(cfg.MinutesLifetimeDefault)
+}
+
+// ClampLifetime limits file lifetime to configured bounds.
+func (cfg *FilesExpirationConfig) ClampLifetime(
+	lifetime time.Duration,
+) time.Duration {
+	minLifetime := time.Minute * time.Duration(cfg.MinutesLifetimeMin)
+	maxLifetime := time.Minute * time.Duration(cfg.MinutesLifetimeMax)
+	if lifetime < minLifetime {
+		return minLifetime
+	} else if lifetime > maxLifetime {
+		return maxLifetime
+	}
+	return lifetime
+}
+
+type S3StorageConfig struct {
+	Endpoint        string `yaml:"endpoint" validate:"required"`
+	Region          string `yaml:"region"`
+	UseSSL          bool   `yaml:"useSSL"`
+	Bucket          string `yaml:"bucket" validate:"required"`
+	Prefix          string `yaml:"prefix"`
+	AccessKeyID     string `yaml:"accessKeyId" validate:"required"`
+	SecretAccessKey string `yaml:"secretAccessKey" validate:"required"`
+	PartBytes       uint64 `yaml:"partBytes" validate:"omitempty,gte=5242880"`
+}
+
+// PartSize returns size of multipart upload parts. Each running upload
+// buffers one part in memory.
+func (cfg *S3StorageConfig) PartSize() uint64 {
+	if cfg.PartBytes == 0 {
+		return 16 << 20
+	}
+	return cfg.PartBytes
+}
+
+type StorageConfig struct {
+	Backend   string           `yaml:"backend" validate:"required,oneof=mongo gridfs local s3"`
+	Directory string           `yaml:"directory" validate:"required_if=Backend local"`
+	S3        *S3StorageConfig `yaml:"s3" validate:"required_if=Backend s3,omitempty"`
+}
+
+// EncryptionConfig sets master key wrapping data keys of files, content
+// is stored unencrypted unless enabled. Master keys are base64 encoded
+// 32 bytes keys, previous master keys are kept until data keys are
+// re-wrapped with the current one.
+type EncryptionConfig struct {
+	Enabled            bool     `yaml:"enabled"`
+	MasterKey          string   `yaml:"masterKey" validate:"required_if=Enabled true MasterKeyFile ''"`
+	MasterKeyFile      string   `yaml:"masterKeyFile" validate:"required_if=Enabled true MasterKey '',omitempty,file"`
+	PreviousMasterKeys []string `yaml:"previousMasterKeys"`
+	ChunkBytes         int64    `yaml:"chunkBytes" validate:"required,gte=1024,lte=16777216"`
+}
+
+// UploadConfig limits uploads, files uploaded in one request are grouped
+// into a bundle.
+type UploadConfig struct {
+	MaxFileBytes       int64 `yaml:"maxFileBytes" validate:"required,gt=0"`
+	MaxFilesPerRequest int64 `yaml:"maxFilesPerRequest" validate:"required,gt=0"`
+	ComputeMD5         bool  `yaml:"computeMD5"`
+}
+
+// ContentTypesConfig restricts types of uploaded files. Both declared and
+// detected types are checked, "image/*" matches every image type. Denied
+// types and extensions take precedence, empty allowed list allows all.
+type ContentTypesConfig struct {
+	AllowedTypes      []string `yaml:"allowedTypes" validate:"dive,contains=/"`
+	DeniedTypes       []string `yaml:"deniedTypes" validate:"dive,contains=/"`
+	AllowedExtensions []string `yaml:"allowedExtensions" validate:"dive,startswith=."`
+	DeniedExtensions  []string `yaml:"deniedExtensions" validate:"dive,startswith=."`
+}
+
+// QuotaConfig sets default storage limits of users, zero value means no
+// limit. Limits can be overridden for a user in its quota document.
+type QuotaConfig struct {
+	MaxTotalBytes int64 `yaml:"maxTotalBytes" validate:"gte=0"`
+	MaxFiles      int64 `yaml:"maxFiles" validate:"gte=0"`
+	MaxFileBytes  int64 `yaml:"maxFileBytes" validate:"gte=0"`
+}
+
+// ScanningConfig selects malware scanner checking content of new files.
+// Infected files are rejected, files not found clean are not served if
+// scanning is required.
+type ScanningConfig struct {
+	Scanner        string `yaml:"scanner" validate:"required,oneof=none clamd"`
+	Network        string `yaml:"network" validate:"required_if=Scanner clamd,omitempty,oneof=tcp unix"`
+	Address        string `yaml:"address" validate:"required_if=Scanner clamd"`
+	SecondsTimeout int    `yaml:"secondsTimeout" validate:"required,gt=0"`
+	Required       bool   `yaml:"required"`
+}
+
+func (cfg *ScanningConfig) Timeout() time.Duration {
+	return time.Second * time.Duration(cfg.SecondsTimeout)
+}
+
+// PresignConfig sets key signing presigned download URLs and bounds of
+// their lifetime. Presigned URLs are disabled without the key. In owner
+// only mode plain file URLs are refused, files are downloaded only with
+// URLs presigned by their owners or share links.
+type PresignConfig struct {
+	SecretKey              string `yaml:"secretKey" validate:"required_if=OwnerOnly true,omitempty,min=32,startsnotwith=REPLACE_WITH"`
+	SecondsLifetimeDefault int64  `yaml:"secondsLifetimeDefault" validate:"required,gt=0,ltefield=SecondsLifetimeMax"`
+	SecondsLifetimeMax     int64  `yaml:"secondsLifetimeMax" validate:"required,gt=0"`
+	OwnerOnly              bool   `yaml:"ownerOnly"`
+}
+
+func (cfg *PresignConfig) Enabled() bool {
+	return cfg.SecretKey != ""
+}
+
+// Lifetime returns lifetime of presigned URL limited to the maximum, zero
+// requested lifetime means the default one.
+func (cfg *PresignConfig) Lifetime(seconds int64) time.Duration {
+	if seconds == 0 {
+		seconds = cfg.SecondsLifetimeDefault
+	}
+	seconds = min(seconds, cfg.SecondsLifetimeMax)
+	return time.Second * time.Duration(seconds)
+}
+
+type UploadsConfig struct {
+	MinutesExpiration int `yaml:"minutesExpiration" validate:"required,gt=0"`
+}
+
+// Expiration returns time of unfinished upload expiration, it is
+// prolonged with every received chunk.
+func (cfg *UploadsConfig) Expiration(from time.Time) time.Time {
+	return from.Add(time.Minute * time.Duration(cfg.MinutesExpiration))
+}
+
+type FilesPasswordConfig struct {
+	MaxAttempts           int `yaml:"maxAttempts" validate:"required,gt=0"`
+	SecondsAttemptsWindow int `yaml:"secondsAttemptsWindow" validate:"required,gt=0"`
+}
+
+// AccessLogConfig sets how long download attempts are kept in access log,
+// records are removed by the sweeper.
+type AccessLogConfig struct {
+	DaysRetention int `yaml:"daysRetention" validate:"required,gt=0"`
+}
+
+// Expiration returns time the access recorded now is removed after.
+func (cfg *AccessLogConfig) Expiration(now time.Time) time.Time {
+	return now.AddDate(0, 0, cfg.DaysRetention)
+}
+
+type SweeperConfig struct {
+	SecondsInterval int   `yaml:"secondsInterval" validate:"required,gt=0"`
+	BatchSize       int64 `yaml:"batchSize" validate:"required,gt=0"`
 }
 
 type LogConfig struct {
@@ -40,6 +201,17 @@ type BackendConfig struct {
 	MongoDB        MongoDBConfig         `yaml:"mongoDB"`
 	Server         ServerConfig          `yaml:"server"`
 	FilesExpConfig FilesExpirationConfig `yaml:"filesExpConfig"`
+	Storage        StorageConfig         `yaml:"storage"`
+	Encryption     EncryptionConfig      `yaml:"encryption"`
+	Upload         UploadConfig          `yaml:"upload"`
+	Quota          QuotaConfig           `yaml:"quota"`
+	ContentTypes   ContentTypesConfig    `yaml:"contentTypes"`
+	Scanning       ScanningConfig        `yaml:"scanning"`
+	Presign        PresignConfig         `yaml:"presign"`
+	Uploads        UploadsConfig         `yaml:"uploads"`
+	FilesPassword  FilesPasswordConfig   `yaml:"filesPassword"`
+	AccessLog      AccessLogConfig       `yaml:"accessLog"`
+	Sweeper        SweeperConfig         `yaml:"sweeper"`
 	Logs           LogConfig             `yaml:"logs"`
 }
 
@@ -68,10 +240,40 @@ func (cfg *BackendConfig) SetDefaults() {
 	cfg.Server.BasePath = "/backend"
 	cfg.Server.OpenapiBasePath = "/swagger"
 	cfg.Server.PaginationDefaultLimit = 20
+	cfg.Server.SecondsShutdownTimeout = 10
 
 	cfg.Server.JwtConfig.DaysLifespan = 3
 
 	cfg.FilesExpConfig.MinutesLifetimeDefault = 1
+	cfg.FilesExpConfig.MinutesLifetimeMin = 1
+	cfg.FilesExpConfig.MinutesLifetimeMax = 10080
+
+	cfg.Storage.Backend = MongoStorageBackend
+
+	cfg.Encryption.ChunkBytes = 64 << 10
+
+	cfg.Upload.MaxFileBytes = 100 << 20
+	cfg.Upload.MaxFilesPerRequest = 20
+
+	cfg.Quota.MaxTotalBytes = 1 << 30
+	cfg.Quota.MaxFiles = 1000
+
+	cfg.Scanning.Scanner = NoopScanner
+	cfg.Scanning.Network = "tcp"
+	cfg.Scanning.SecondsTimeout = 60
+
+	cfg.Presign.SecondsLifetimeDefault = 900
+	cfg.Presign.SecondsLifetimeMax = 86400
+
+	cfg.Uploads.MinutesExpiration = 1440
+
+	cfg.FilesPassword.MaxAttempts = 5
+	cfg.FilesPassword.SecondsAttemptsWindow = 300
+
+	cfg.AccessLog.DaysRetention = 90
+
+	cfg.Sweeper.SecondsInterval = 60
+	cfg.Sweeper.BatchSize = 100
 
 	cfg.Logs.Level = logrus.DebugLevel.String()
 	cfg.Logs.AppName = "sharing-backend"
@@ -3,13 +3,98 @@ package base
 type Collection string
 
 const ConfigFile string = "config.yaml"
+const MigrateFilesCommand string = "migrate-files"
+const VerifyFilesCommand string = "verify-files"
+const RewrapKeysCommand string = "rewrap-keys"
+const FilesBucket string = "file_contents"
 const PasswordCost int = 12
+const MaxFormFieldsBytes int64 = 64 << 10
 const FileIdPathParam string = "identifier"
 const LimitQueryParam string = "limit"
 const SkipQueryParam string = "skip"
+const IncludeExpiredQueryParam string = "include_expired"
+const FileFormField string = "file"
+const LifetimeMinutesFormField string = "lifetime_minutes"
+const ExpiresAtFormField string = "expires_at"
+const MaxDownloadsFormField string = "max_downloads"
+const PasswordFormField string = "password"
+const EncryptionParamsFormField string = "encryption_params"
+const VisibilityFormField string = "visibility"
+const FilePasswordHeader string = "X-File-Password"
+const FileIdentifierHeader string = "X-File-Identifier"
+const EncryptionParamsHeader string = "X-Encryption-Params"
+const DigestHeader string = "Digest"
+const ReprDigestHeader string = "Repr-Digest"
+const ContentMD5Header string = "Content-MD5"
+const OctetStreamMimetype string = "application/octet-stream"
+const EmptyContentMimetype string = "application/x-empty"
+const UploadIdPathParam string = "identifier"
+const BundleIdPathParam string = "identifier"
+const ShareTokenPathParam string = "token"
+const GranteePathParam string = "username"
+const ShareTokenBytes int = 24
+const ZipMimetype string = "application/zip"
+const ExpiresQueryParam string = "expires"
+const IPQueryParam string = "ip"
+const MaxBytesQueryParam string = "max-bytes"
+const SignatureQueryParam string = "signature"
+const FileNameUploadMetadata string = "filename"
+const FileTypeUploadMetadata string = "filetype"
+
+const (
+	TusVersion           string = "1.0.0"
+	TusExtensions        string = "creation,termination,expiration"
+	TusContentType       string = "application/offset+octet-stream"
+	TusResumableHeader   string = "Tus-Resumable"
+	TusVersionHeader     string = "Tus-Version"
+	TusExtensionHeader   string = "Tus-Extension"
+	TusMaxSizeHeader     string = "Tus-Max-Size"
+	UploadLengthHeader   string = "Upload-Length"
+	UploadOffsetHeader   string = "Upload-Offset"
+	UploadMetadataHeader string = "Upload-Metadata"
+	UploadExpiresHeader  string = "Upload-Expires"
+)
 
 const (
 	Users         Collection = "users"
 	Files         Collection = "files"
 	FilesMetadata Collection = "files_metadata"
+	Uploads       Collection = "uploads"
+	Bundles       Collection = "bundles"
+	ShareLinks    Collection = "share_links"
+	FileAccessLog Collection = "file_access_log"
+)
+
+const (
+	MongoStorageBackend  string = "mongo"
+	GridFSStorageBackend string = "gridfs"
+	LocalStorageBackend  string = "local"
+	S3StorageBackend     string = "s3"
+)
+
+const (
+	NoopScanner  string = "none"
+	ClamdScanner string = "clamd"
+)
+
+const (
+	ScanStatusPending  string = "pending"
+	ScanStatusClean    string = "clean"
+	ScanStatusInfected string = "infected"
+	ScanStatusError    string = "error"
+)
+
+const (
+	AccessOutcomeDownloaded  string = "downloaded"
+	AccessOutcomePartial     string = "partial"
+	AccessOutcomeNotModified string = "not_modified"
+	AccessOutcomeDenied      string = "denied"
+	AccessOutcomeUnavailable string = "unavailable"
+	AccessOutcomeFailed      string = "failed"
+)
+
+const (
+	VisibilityPublic        string = "public"
+	VisibilityAuthenticated string = "authenticated"
+	VisibilityPrivate       string = "private"
 )
@@ -23,6 +23,19 @@ func (sError *ServiceError) String() string {
 	return sError.Summary
 }
 
+func (sError ServiceError) Error() string {
+	if sError.Detail != nil {
+		return fmt.Sprintf("%s. %v", sError.Summary, sError.Detail)
+	}
+	return sError.Summary
+}
+
+// Unwrap returns the cause of the error if it is kept, so callers can
+// match it with errors.Is.
+func (sError ServiceError) Unwrap() error {
+	return sError.error
+}
+
 func NewDatabaseError(err error) ServiceError {
 	return ServiceError{
 		Summary: "Database interaction error",
@@ -30,6 +43,21 @@ func NewDatabaseError(err error) ServiceError {
 	}
 }
 
+func NewStorageError(err error) ServiceError {
+	return ServiceError{
+		Summary: "File storage interaction error",
+		Detail:  err.Error(),
+	}
+}
+
+func NewEncryptionError(err error) ServiceError {
+	return ServiceError{
+		error:   err,
+		Summary: "File content encryption error",
+		Detail:  err.Error(),
+	}
+}
+
 func NewQueryParamError(paramName string, err error) ServiceError {
 	return ServiceError{
 		Summary: fmt.Sprintf("Invalid format for query param '%s'", paramName),
@@ -53,6 +81,151 @@ func NewPathParamError(paramName string, err error) ServiceError {
 	}
 }
 
+func NewFileNotFoundError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' not found", fileId),
+		Status:  http.StatusNotFound,
+	}
+}
+
+func NewFileAuthenticationRequiredError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' requires authentication", fileId),
+		Detail:  "Sign in to download the file",
+		Status:  http.StatusUnauthorized,
+	}
+}
+
+func NewFileGrantNotFoundError(fileId string, username string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' is not shared with user '%s'", fileId, username),
+		Status:  http.StatusNotFound,
+	}
+}
+
+func NewFileGrantOwnerError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' can not be shared with its owner", fileId),
+		Status:  http.StatusBadRequest,
+	}
+}
+
+func NewFileAlreadyExistsError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' already exist", fileId),
+		Status:  http.StatusBadRequest,
+	}
+}
+
+func NewFileAccessDeniedError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Access to file '%s' denied", fileId),
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewFileExpiredError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' expired", fileId),
+		Status:  http.StatusGone,
+	}
+}
+
+func NewFileDownloadLimitError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' download limit reached", fileId),
+		Status:  http.StatusGone,
+	}
+}
+
+func NewFilePasswordRequiredError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' is protected with password", fileId),
+		Detail: fmt.Sprintf(
+			"Send password in '%s' header or '%s' form field",
+			FilePasswordHeader,
+			PasswordFormField,
+		),
+		Status: http.StatusUnauthorized,
+	}
+}
+
+func NewFilePasswordInvalidError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Invalid password for file '%s'", fileId),
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewFilePasswordAttemptsError(fileId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf(
+			"Too many invalid password attempts for file '%s'. Try again later",
+			fileId,
+		),
+		Status: http.StatusTooManyRequests,
+	}
+}
+
+func NewFileTooLargeError(maxBytes int64) ServiceError {
+	return ServiceError{
+		Summary: "File is too large",
+		Detail:  fmt.Sprintf("Maximum allowed file size is %d bytes", maxBytes),
+		Status:  http.StatusRequestEntityTooLarge,
+	}
+}
+
+func NewUnsupportedFileTypeError(detail string) ServiceError {
+	return ServiceError{
+		Summary: "Unsupported file type",
+		Detail:  detail,
+		Status:  http.StatusUnsupportedMediaType,
+	}
+}
+
+func NewFileInfectedError(signature string) ServiceError {
+	return ServiceError{
+		Summary: "File is infected",
+		Detail:  fmt.Sprintf("Malware '%s' found in file content", signature),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func NewFileScanStatusError(fileId string, status string) ServiceError {
+	detail := "File was not scanned"
+	if status != "" {
+		detail = fmt.Sprintf("Scan status of the file is '%s'", status)
+	}
+	return ServiceError{
+		Summary: fmt.Sprintf("File '%s' did not pass malware scan", fileId),
+		Detail:  detail,
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewScannerError(err error) ServiceError {
+	return ServiceError{
+		Summary: "Malware scan error",
+		Detail:  err.Error(),
+	}
+}
+
+func NewStorageQuotaError(detail string) ServiceError {
+	return ServiceError{
+		Summary: "Storage quota exceeded",
+		Detail:  detail,
+		Status:  http.StatusInsufficientStorage,
+	}
+}
+
+func NewFormFieldError(fieldName string, err error) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Invalid format for form field '%s'", fieldName),
+		Detail:  err.Error(),
+		Status:  http.StatusBadRequest,
+	}
+}
+
 func NewFilesRequestError(err error) ServiceError {
 	return ServiceError{
 		Summary: "Failed to parse file data request. Invalid structure",
@@ -61,6 +234,171 @@ func NewFilesRequestError(err error) ServiceError {
 	}
 }
 
+func NewHeaderError(headerName string, err error) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Invalid value of header '%s'", headerName),
+		Detail:  err.Error(),
+		Status:  http.StatusBadRequest,
+	}
+}
+
+func NewDigestMismatchError(algorithm string) ServiceError {
+	return ServiceError{
+		Summary: "File content digest mismatch",
+		Detail:  fmt.Sprintf("Content does not match '%s' digest", algorithm),
+		Status:  http.StatusBadRequest,
+	}
+}
+
+func NewTooManyFilesError(maxFiles int64) ServiceError {
+	return ServiceError{
+		Summary: "Too many files",
+		Detail:  fmt.Sprintf("Maximum allowed number of files is %d", maxFiles),
+		Status:  http.StatusBadRequest,
+	}
+}
+
+func NewBundleNotFoundError(bundleId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Bundle '%s' not found", bundleId),
+		Status:  http.StatusNotFound,
+	}
+}
+
+func NewBundleExpiredError(bundleId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Bundle '%s' expired", bundleId),
+		Status:  http.StatusGone,
+	}
+}
+
+func NewShareLinkNotFoundError(token string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Share link '%s' not found", token),
+		Status:  http.StatusNotFound,
+	}
+}
+
+func NewShareLinkDisabledError(token string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Share link '%s' is disabled", token),
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewShareLinkExpiredError(token string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Share link '%s' expired", token),
+		Status:  http.StatusGone,
+	}
+}
+
+func NewShareLinkDownloadLimitError(token string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Share link '%s' download limit reached", token),
+		Status:  http.StatusGone,
+	}
+}
+
+func NewShareLinkExpirationError() ServiceError {
+	return ServiceError{
+		Summary: "Invalid share link expiration",
+		Detail:  "Expiration has to be in the future",
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func NewPresignedUrlRequiredError() ServiceError {
+	return ServiceError{
+		Summary: "Download requires presigned URL",
+		Detail:  "Plain download URLs are disabled, ask the owner for presigned URL",
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewPresignedUrlDisabledError() ServiceError {
+	return ServiceError{
+		Summary: "Presigned URLs are disabled",
+		Detail:  "Presign secret key is not configured on the server",
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewPresignedUrlInvalidError(detail string) ServiceError {
+	return ServiceError{
+		Summary: "Invalid presigned URL",
+		Detail:  detail,
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewPresignedUrlExpiredError() ServiceError {
+	return ServiceError{
+		Summary: "Presigned URL expired",
+		Status:  http.StatusGone,
+	}
+}
+
+func NewPresignedUrlMaxBytesError(maxBytes int64) ServiceError {
+	return ServiceError{
+		Summary: "Requested content exceeds presigned URL limit",
+		Detail:  fmt.Sprintf("At most %d bytes can be requested", maxBytes),
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewTusVersionError(version string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Unsupported tus protocol version '%s'", version),
+		Status:  http.StatusPreconditionFailed,
+	}
+}
+
+func NewUploadNotFoundError(uploadId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Upload '%s' not found", uploadId),
+		Status:  http.StatusNotFound,
+	}
+}
+
+func NewUploadAccessDeniedError(uploadId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Access to upload '%s' denied", uploadId),
+		Status:  http.StatusForbidden,
+	}
+}
+
+func NewUploadExpiredError(uploadId string) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Upload '%s' expired", uploadId),
+		Status:  http.StatusGone,
+	}
+}
+
+func NewUploadOffsetError(uploadId string, offset int64) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Offset of upload '%s' mismatch", uploadId),
+		Detail:  fmt.Sprintf("Current offset is %d", offset),
+		Status:  http.StatusConflict,
+	}
+}
+
+func NewUploadContentTypeError() ServiceError {
+	return ServiceError{
+		Summary: "Upload content type not supported",
+		Detail:  "Content type has to be 'application/offset+octet-stream'",
+		Status:  http.StatusUnsupportedMediaType,
+	}
+}
+
+func NewUploadLengthExceededError(length int64) ServiceError {
+	return ServiceError{
+		Summary: "Upload content exceeds declared length",
+		Detail:  fmt.Sprintf("Upload length is %d bytes", length),
+		Status:  http.StatusRequestEntityTooLarge,
+	}
+}
+
 func WrapValidationErrors(err error) error {
 	var validationErr validator.ValidationErrors
 	if errors.As(err, &validationErr) {
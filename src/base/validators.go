@@ -67,6 +67,12 @@ func getErrorMessageForTag(tag string) string {
 		return "Field required"
 	case "gte":
 		return "The field length is less than the specified length"
+	case "max":
+		return "The field length is greater than the specified length"
+	case "printascii":
+		return "The field can only contain printable ASCII symbols"
+	case "startsnotwith":
+		return "The field contains placeholder value, replace it"
 	}
 	return ""
 }
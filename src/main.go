@@ -2,17 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/sv-tools/mongoifc"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"net/http"
 	"os"
+	"os/signal"
 	"stealthy-backend/api"
 	"stealthy-backend/api/controllers"
 	"stealthy-backend/api/services"
 	"stealthy-backend/base"
+	"sync"
+	"syscall"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -53,6 +59,187 @@ func checkMongoConnection(client mongoifc.Client, ctx *context.Context) {
 	}
 }
 
+func ensureMongoIndexes(
+	client mongoifc.Client,
+	config *base.BackendConfig,
+	ctx *context.Context,
+) {
+	base.Logger.Info("Ensuring mongo DB indexes")
+	indexesService := services.IndexesService{
+		Context:        ctx,
+		Database:       client.Database(config.MongoDB.Database),
+		FilesExpConfig: &config.FilesExpConfig,
+	}
+	if err := indexesService.EnsureIndexes(); err != nil {
+		panic(err)
+	}
+}
+
+func createStorageDriver(
+	client mongoifc.Client,
+	config *base.BackendConfig,
+	ctx *context.Context,
+) services.BaseStorageDriver {
+	database := client.Database(config.MongoDB.Database)
+	switch config.Storage.Backend {
+	case base.GridFSStorageBackend:
+		bucket, err := gridfs.NewBucket(
+			mongoifc.UnWrapDatabase(database),
+			options.GridFSBucket().SetName(base.FilesBucket),
+		)
+		if err != nil {
+			panic(err)
+		}
+		return &services.GridFSStorageDriver{Context: ctx, Bucket: bucket}
+	case base.LocalStorageBackend:
+		err := os.MkdirAll(config.Storage.Directory, 0o750)
+		if err != nil {
+			panic(err)
+		}
+		return &services.LocalStorageDriver{Directory: config.Storage.Directory}
+	case base.S3StorageBackend:
+		driver, err := services.NewS3StorageDriver(ctx, config.Storage.S3)
+		if err != nil {
+			panic(err)
+		}
+		if err = driver.CheckBucket(); err != nil {
+			panic(err)
+		}
+		return driver
+	default:
+		return &services.MongoStorageDriver{
+			Context: ctx, Collection: database.Collection(string(base.Files)),
+		}
+	}
+}
+
+func migrateFiles(
+	client mongoifc.Client,
+	config *base.BackendConfig,
+	ctx *context.Context,
+	target services.BaseStorageDriver,
+) {
+	if config.Storage.Backend == base.MongoStorageBackend {
+		panic(fmt.Errorf(
+			"files are already stored in '%s' storage backend",
+			base.MongoStorageBackend,
+		))
+	}
+	base.Logger.WithFields(logrus.Fields{
+		"backend": config.Storage.Backend,
+	}).Info("Migrating files to storage backend")
+
+	migration := services.FilesMigration{
+		Source: &services.MongoStorageDriver{
+			Context: ctx,
+			Collection: client.Database(
+				config.MongoDB.Database,
+			).Collection(string(base.Files)),
+		},
+		Target: target,
+	}
+	result, err := migration.MigrateFiles()
+	base.Logger.WithFields(logrus.Fields{
+		"migrated": result.Migrated,
+		"skipped":  result.Skipped,
+	}).Info("Files migration finished")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func verifyFiles(
+	ctx *context.Context,
+	filesMetadataCollection mongoifc.Collection,
+	filesService services.BaseFilesService,
+) {
+	base.Logger.Info("Verifying files content")
+
+	verification := services.FilesVerification{
+		Context:      ctx,
+		Collection:   filesMetadataCollection,
+		FilesService: filesService,
+	}
+	result, err := verification.VerifyFiles()
+	base.Logger.WithFields(logrus.Fields{
+		"verified":  result.Verified,
+		"skipped":   result.Skipped,
+		"corrupted": result.Corrupted,
+		"missing":   result.Missing,
+	}).Info("Files verification finished")
+	if err != nil {
+		panic(err)
+	}
+	if result.Failed() {
+		panic(fmt.Errorf(
+			"%d corrupted and %d missing files found",
+			len(result.Corrupted), len(result.Missing),
+		))
+	}
+}
+
+// createKeyRing returns nil if encryption is disabled, file content is
+// stored unencrypted then.
+func createKeyRing(config *base.BackendConfig) *services.KeyRing {
+	if !config.Encryption.Enabled {
+		return nil
+	}
+	keys, err := services.NewKeyRing(&config.Encryption)
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+func createScanner(config *base.BackendConfig) services.BaseScanner {
+	if config.Scanning.Scanner == base.ClamdScanner {
+		return services.ClamdScanner{
+			Network: config.Scanning.Network,
+			Address: config.Scanning.Address,
+			Timeout: config.Scanning.Timeout(),
+		}
+	}
+	return services.NoopScanner{}
+}
+
+func rewrapKeys(
+	ctx *context.Context,
+	filesMetadataCollection mongoifc.Collection,
+	uploadsCollection mongoifc.Collection,
+	keys *services.KeyRing,
+) {
+	if keys == nil {
+		panic(errors.New("encryption is not enabled"))
+	}
+	base.Logger.WithFields(logrus.Fields{
+		"keyId": keys.CurrentKeyId(),
+	}).Info("Rewrapping data keys with current master key")
+
+	rewrap := services.KeysRewrap{
+		Context:       ctx,
+		FilesMetadata: filesMetadataCollection,
+		Uploads:       uploadsCollection,
+		Keys:          keys,
+	}
+	result, err := rewrap.RewrapKeys()
+	base.Logger.WithFields(logrus.Fields{
+		"files":  result.Files,
+		"chunks": result.Chunks,
+	}).Info("Data keys rewrap finished")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func closeMongoConnection(client mongoifc.Client, ctx *context.Context) {
+	base.Logger.Info("Closing mongo DB connection")
+	if err := client.Disconnect(*ctx); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Warn("Close mongo DB connection error")
+	}
+}
+
 func processError(err error) {
 	base.Logger.WithFields(logrus.Fields{
 		"error": err.Error(),
@@ -112,11 +299,47 @@ func setLogger(config *base.BackendConfig) {
 	base.Logger = base.CreateLogger(config)
 }
 
-func runServer(engine *gin.Engine, config *base.BackendConfig) {
+func runSweeper(
+	ctx context.Context,
+	sweeper *services.ExpirationSweeper,
+	wg *sync.WaitGroup,
+) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sweeper.Run(ctx)
+	}()
+}
+
+func runServer(
+	ctx context.Context,
+	engine *gin.Engine,
+	config *base.BackendConfig,
+) {
 	base.Logger.Info("Starting server")
-	if err := engine.Run(config.Server.Socket); err != nil {
+	server := &http.Server{Addr: config.Server.Socket, Handler: engine}
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+
+		base.Logger.Info("Stopping server")
+		timeout := time.Duration(config.Server.SecondsShutdownTimeout) * time.Second
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Server shutdown error")
+		}
+	}()
+
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		panic(err)
 	}
+	<-shutdownDone
 	base.Logger.Info("Server stopped")
 }
 
@@ -135,29 +358,80 @@ func main() {
 	mongoClient := createMongoClient(config, &ctx)
 
 	checkMongoConnection(mongoClient, &ctx)
+	ensureMongoIndexes(mongoClient, config, &ctx)
 
 	usersCollection := mongoClient.Database(
 		config.MongoDB.Database,
 	).Collection(string(base.Users))
-	filesCollection := mongoClient.Database(
-		config.MongoDB.Database,
-	).Collection(string(base.Files))
 	filesMetadataCollection := mongoClient.Database(
 		config.MongoDB.Database,
 	).Collection(string(base.FilesMetadata))
+	uploadsCollection := mongoClient.Database(
+		config.MongoDB.Database,
+	).Collection(string(base.Uploads))
+	bundlesCollection := mongoClient.Database(
+		config.MongoDB.Database,
+	).Collection(string(base.Bundles))
+	shareLinksCollection := mongoClient.Database(
+		config.MongoDB.Database,
+	).Collection(string(base.ShareLinks))
+	fileAccessLogCollection := mongoClient.Database(
+		config.MongoDB.Database,
+	).Collection(string(base.FileAccessLog))
 
 	authService := &services.AuthorizationService{
 		JwtConfig: &config.Server.JwtConfig,
 	}
 	userService := &services.UserService{
-		Context: &ctx, Collection: usersCollection,
+		Context: &ctx, Collection: usersCollection, Quota: &config.Quota,
+	}
+	keys := createKeyRing(config)
+	storageDriver := createStorageDriver(mongoClient, config, &ctx)
+	filesService := &services.FilesService{Driver: storageDriver, Keys: keys}
+	if len(os.Args) > 1 && os.Args[1] == base.MigrateFilesCommand {
+		migrateFiles(mongoClient, config, &ctx, storageDriver)
+		closeMongoConnection(mongoClient, &ctx)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == base.VerifyFilesCommand {
+		verifyFiles(&ctx, filesMetadataCollection, filesService)
+		closeMongoConnection(mongoClient, &ctx)
+		return
 	}
-	filesService := &services.FilesService{
-		Context: &ctx, Collection: filesCollection,
+	if len(os.Args) > 1 && os.Args[1] == base.RewrapKeysCommand {
+		rewrapKeys(&ctx, filesMetadataCollection, uploadsCollection, keys)
+		closeMongoConnection(mongoClient, &ctx)
+		return
 	}
 	filesMetadataService := &services.FilesMetadataService{
 		Context: &ctx, Collection: filesMetadataCollection,
 	}
+	uploadsService := &services.UploadsService{
+		Context:    &ctx,
+		Collection: uploadsCollection,
+		Config:     &config.Uploads,
+	}
+	bundlesService := &services.BundlesService{
+		Context: &ctx, Collection: bundlesCollection,
+	}
+	shareLinksService := &services.ShareLinksService{
+		Context: &ctx, Collection: shareLinksCollection,
+	}
+	fileAccessLogService := &services.FileAccessLogService{
+		Context:    &ctx,
+		Collection: fileAccessLogCollection,
+		Config:     &config.AccessLog,
+	}
+	expirationSweeper := &services.ExpirationSweeper{
+		FilesService:         filesService,
+		FilesMetadataService: filesMetadataService,
+		UploadsService:       uploadsService,
+		BundlesService:       bundlesService,
+		ShareLinksService:    shareLinksService,
+		FileAccessLogService: fileAccessLogService,
+		UserService:          userService,
+		Config:               &config.Sweeper,
+	}
 
 	authController := controllers.AuthorizationController{
 		AuthService: authService,
@@ -174,12 +448,37 @@ func main() {
 	filesController := controllers.FilesController{
 		FilesService:         filesService,
 		FilesMetadataService: filesMetadataService,
+		BundlesService:       bundlesService,
+		ShareLinksService:    shareLinksService,
+		FileAccessLogService: fileAccessLogService,
+		UserService:          userService,
 		FilesExpConfig:       &config.FilesExpConfig,
+		UploadConfig:         &config.Upload,
+		ContentTypes:         &config.ContentTypes,
+		Scanning:             &config.Scanning,
+		Scanner:              createScanner(config),
+		Presign:              &config.Presign,
+		Signer:               services.URLSigner{Key: []byte(config.Presign.SecretKey)},
+		PasswordLimiter:      services.NewAttemptsLimiter(&config.FilesPassword),
 		SchemaValidator:      schemaValidator,
 	}
+	uploadsController := controllers.UploadsController{
+		Files:          filesController,
+		UploadsService: uploadsService,
+		UploadsConfig:  &config.Uploads,
+	}
+	bundlesController := controllers.BundlesController{
+		Files: filesController,
+	}
+	shareLinksController := controllers.ShareLinksController{
+		Files: filesController,
+	}
 
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	if err = router.SetTrustedProxies(config.Server.TrustedProxies); err != nil {
+		processError(err)
+	}
 	router.NoRoute(api.NoRouteHandler)
 	router.NoMethod(api.NoMethodHandler)
 	router.Use(api.LogsHandler)
@@ -195,11 +494,15 @@ func main() {
 	usersGroup := v1.Group("/users")
 	usersGroup.POST("", userController.SignUpUser)
 
-	filesGroup := v1.Group("/files")
+	filesGroup := v1.Group("/files").Use(authController.AuthorizeOptionally)
 	filesGroup.GET(
 		fmt.Sprintf("/:%s", base.FileIdPathParam),
 		filesController.DownloadFile,
 	)
+	filesGroup.POST(
+		fmt.Sprintf("/:%s", base.FileIdPathParam),
+		filesController.DownloadFile,
+	)
 
 	withAuthUsersGroup := v1.Group("/users").Use(authController.Authorize)
 	withAuthUsersGroup.GET("/me", userController.GetUser)
@@ -207,8 +510,108 @@ func main() {
 	withAuthFilesGroup := v1.Group("/files").Use(authController.Authorize)
 	withAuthFilesGroup.POST("", filesController.UploadFile)
 	withAuthFilesGroup.GET("", filesController.GetFileMetadataList)
+	withAuthFilesGroup.GET("/shared", filesController.GetSharedFileMetadataList)
+	withAuthFilesGroup.DELETE(
+		fmt.Sprintf("/:%s", base.FileIdPathParam),
+		filesController.DeleteFile,
+	)
+	withAuthFilesGroup.PUT(
+		fmt.Sprintf("/:%s/grants/:%s", base.FileIdPathParam, base.GranteePathParam),
+		filesController.ShareFile,
+	)
+	withAuthFilesGroup.DELETE(
+		fmt.Sprintf("/:%s/grants/:%s", base.FileIdPathParam, base.GranteePathParam),
+		filesController.UnshareFile,
+	)
+	withAuthFilesGroup.GET(
+		fmt.Sprintf("/:%s/accesses", base.FileIdPathParam),
+		filesController.GetFileAccesses,
+	)
+	withAuthFilesGroup.POST(
+		fmt.Sprintf("/:%s/presign", base.FileIdPathParam),
+		filesController.PresignFile,
+	)
+	withAuthFilesGroup.POST(
+		fmt.Sprintf("/:%s/links", base.FileIdPathParam),
+		shareLinksController.CreateShareLink,
+	)
+	withAuthFilesGroup.GET(
+		fmt.Sprintf("/:%s/links", base.FileIdPathParam),
+		shareLinksController.GetShareLinks,
+	)
+	withAuthFilesGroup.GET(
+		fmt.Sprintf("/:%s/links/:%s", base.FileIdPathParam, base.ShareTokenPathParam),
+		shareLinksController.GetShareLink,
+	)
+	withAuthFilesGroup.PATCH(
+		fmt.Sprintf("/:%s/links/:%s", base.FileIdPathParam, base.ShareTokenPathParam),
+		shareLinksController.UpdateShareLink,
+	)
+	withAuthFilesGroup.DELETE(
+		fmt.Sprintf("/:%s/links/:%s", base.FileIdPathParam, base.ShareTokenPathParam),
+		shareLinksController.DeleteShareLink,
+	)
+
+	uploadsGroup := v1.Group("/uploads")
+	uploadsGroup.OPTIONS("", uploadsController.DescribeUploads)
+	uploadsGroup.OPTIONS(
+		fmt.Sprintf("/:%s", base.UploadIdPathParam),
+		uploadsController.DescribeUploads,
+	)
+
+	withAuthUploadsGroup := v1.Group("/uploads").Use(
+		uploadsController.CheckTusResumable, authController.Authorize,
+	)
+	withAuthUploadsGroup.POST("", uploadsController.CreateUpload)
+	withAuthUploadsGroup.HEAD(
+		fmt.Sprintf("/:%s", base.UploadIdPathParam),
+		uploadsController.GetUploadOffset,
+	)
+	withAuthUploadsGroup.PATCH(
+		fmt.Sprintf("/:%s", base.UploadIdPathParam),
+		uploadsController.AppendUploadContent,
+	)
+	withAuthUploadsGroup.DELETE(
+		fmt.Sprintf("/:%s", base.UploadIdPathParam),
+		uploadsController.TerminateUpload,
+	)
+
+	bundlesGroup := v1.Group("/bundles").Use(authController.AuthorizeOptionally)
+	bundlesGroup.GET(
+		fmt.Sprintf("/:%s", base.BundleIdPathParam),
+		bundlesController.GetBundle,
+	)
+	bundlesGroup.GET(
+		fmt.Sprintf("/:%s/archive", base.BundleIdPathParam),
+		bundlesController.DownloadBundleArchive,
+	)
+	bundlesGroup.POST(
+		fmt.Sprintf("/:%s/archive", base.BundleIdPathParam),
+		bundlesController.DownloadBundleArchive,
+	)
+
+	sharedGroup := v1.Group("/s")
+	sharedGroup.GET(
+		fmt.Sprintf("/:%s", base.ShareTokenPathParam),
+		shareLinksController.DownloadSharedFile,
+	)
+	sharedGroup.POST(
+		fmt.Sprintf("/:%s", base.ShareTokenPathParam),
+		shareLinksController.DownloadSharedFile,
+	)
 
 	configureSwagger(applicationGroup, config)
 
-	runServer(router, config)
+	runCtx, stop := signal.NotifyContext(
+		context.Background(), os.Interrupt, syscall.SIGTERM,
+	)
+	defer stop()
+	var workers sync.WaitGroup
+
+	runSweeper(runCtx, expirationSweeper, &workers)
+	runServer(runCtx, router, config)
+
+	stop()
+	workers.Wait()
+	closeMongoConnection(mongoClient, &ctx)
 }
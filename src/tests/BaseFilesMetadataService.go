@@ -71,6 +71,54 @@ func (_m *BaseFilesMetadataService) CheckFileMetadataExists(fileId string) (bool
 	return r0, r1
 }
 
+// DeleteFileMetadata provides a mock function with given fields: fileId
+func (_m *BaseFilesMetadataService) DeleteFileMetadata(fileId string) error {
+	ret := _m.Called(fileId)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteFileMetadata")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(fileId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetExpiredFiles provides a mock function with given fields: limit
+func (_m *BaseFilesMetadataService) GetExpiredFiles(limit int64) ([]api.FileMetadata, error) {
+	ret := _m.Called(limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetExpiredFiles")
+	}
+
+	var r0 []api.FileMetadata
+	var r1 error
+	if rf, ok := ret.Get(0).(func(int64) ([]api.FileMetadata, error)); ok {
+		return rf(limit)
+	}
+	if rf, ok := ret.Get(0).(func(int64) []api.FileMetadata); ok {
+		r0 = rf(limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]api.FileMetadata)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(int64) error); ok {
+		r1 = rf(limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetFileMetadata provides a mock function with given fields: fileId
 func (_m *BaseFilesMetadataService) GetFileMetadata(fileId string) (*api.FileMetadata, error) {
 	ret := _m.Called(fileId)
@@ -101,8 +149,38 @@ func (_m *BaseFilesMetadataService) GetFileMetadata(fileId string) (*api.FileMet
 	return r0, r1
 }
 
+// GetFileMetadataByOwner provides a mock function with given fields: fileId, username
+func (_m *BaseFilesMetadataService) GetFileMetadataByOwner(fileId string, username string) (*api.FileMetadata, error) {
+	ret := _m.Called(fileId, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetFileMetadataByOwner")
+	}
+
+	var r0 *api.FileMetadata
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (*api.FileMetadata, error)); ok {
+		return rf(fileId, username)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) *api.FileMetadata); ok {
+		r0 = rf(fileId, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.FileMetadata)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(fileId, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetFileMetadataList provides a mock function with given fields: queryParams, username
-func (_m *BaseFilesMetadataService) GetFileMetadataList(queryParams *api.PaginationQueryParameters, username string) (*api.FileMetadataListResponse, error) {
+func (_m *BaseFilesMetadataService) GetFileMetadataList(queryParams *api.FileMetadataListQueryParameters, username string) (*api.FileMetadataListResponse, error) {
 	ret := _m.Called(queryParams, username)
 
 	if len(ret) == 0 {
@@ -111,10 +189,70 @@ func (_m *BaseFilesMetadataService) GetFileMetadataList(queryParams *api.Paginat
 
 	var r0 *api.FileMetadataListResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*api.PaginationQueryParameters, string) (*api.FileMetadataListResponse, error)); ok {
+	if rf, ok := ret.Get(0).(func(*api.FileMetadataListQueryParameters, string) (*api.FileMetadataListResponse, error)); ok {
+		return rf(queryParams, username)
+	}
+	if rf, ok := ret.Get(0).(func(*api.FileMetadataListQueryParameters, string) *api.FileMetadataListResponse); ok {
+		r0 = rf(queryParams, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.FileMetadataListResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(*api.FileMetadataListQueryParameters, string) error); ok {
+		r1 = rf(queryParams, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFilesMetadata provides a mock function with given fields: fileIds
+func (_m *BaseFilesMetadataService) GetFilesMetadata(fileIds []string) ([]api.FileMetadata, error) {
+	ret := _m.Called(fileIds)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetFilesMetadata")
+	}
+
+	var r0 []api.FileMetadata
+	var r1 error
+	if rf, ok := ret.Get(0).(func([]string) ([]api.FileMetadata, error)); ok {
+		return rf(fileIds)
+	}
+	if rf, ok := ret.Get(0).(func([]string) []api.FileMetadata); ok {
+		r0 = rf(fileIds)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]api.FileMetadata)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func([]string) error); ok {
+		r1 = rf(fileIds)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSharedFileMetadataList provides a mock function with given fields: queryParams, username
+func (_m *BaseFilesMetadataService) GetSharedFileMetadataList(queryParams *api.FileMetadataListQueryParameters, username string) (*api.FileMetadataListResponse, error) {
+	ret := _m.Called(queryParams, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSharedFileMetadataList")
+	}
+
+	var r0 *api.FileMetadataListResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(*api.FileMetadataListQueryParameters, string) (*api.FileMetadataListResponse, error)); ok {
 		return rf(queryParams, username)
 	}
-	if rf, ok := ret.Get(0).(func(*api.PaginationQueryParameters, string) *api.FileMetadataListResponse); ok {
+	if rf, ok := ret.Get(0).(func(*api.FileMetadataListQueryParameters, string) *api.FileMetadataListResponse); ok {
 		r0 = rf(queryParams, username)
 	} else {
 		if ret.Get(0) != nil {
@@ -122,7 +260,7 @@ func (_m *BaseFilesMetadataService) GetFileMetadataList(queryParams *api.Paginat
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(*api.PaginationQueryParameters, string) error); ok {
+	if rf, ok := ret.Get(1).(func(*api.FileMetadataListQueryParameters, string) error); ok {
 		r1 = rf(queryParams, username)
 	} else {
 		r1 = ret.Error(1)
@@ -131,6 +269,108 @@ func (_m *BaseFilesMetadataService) GetFileMetadataList(queryParams *api.Paginat
 	return r0, r1
 }
 
+// RegisterFileAccess provides a mock function with given fields: access
+func (_m *BaseFilesMetadataService) RegisterFileAccess(access *api.FileAccess) error {
+	ret := _m.Called(access)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RegisterFileAccess")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*api.FileAccess) error); ok {
+		r0 = rf(access)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RegisterFileDownload provides a mock function with given fields: fileId
+func (_m *BaseFilesMetadataService) RegisterFileDownload(fileId string) (*api.FileMetadata, error) {
+	ret := _m.Called(fileId)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RegisterFileDownload")
+	}
+
+	var r0 *api.FileMetadata
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (*api.FileMetadata, error)); ok {
+		return rf(fileId)
+	}
+	if rf, ok := ret.Get(0).(func(string) *api.FileMetadata); ok {
+		r0 = rf(fileId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.FileMetadata)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(fileId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetScanStatus provides a mock function with given fields: fileId, status
+func (_m *BaseFilesMetadataService) SetScanStatus(fileId string, status string) error {
+	ret := _m.Called(fileId, status)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetScanStatus")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(fileId, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ShareFile provides a mock function with given fields: fileId, username
+func (_m *BaseFilesMetadataService) ShareFile(fileId string, username string) error {
+	ret := _m.Called(fileId, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ShareFile")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(fileId, username)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UnshareFile provides a mock function with given fields: fileId, username
+func (_m *BaseFilesMetadataService) UnshareFile(fileId string, username string) error {
+	ret := _m.Called(fileId, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UnshareFile")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(fileId, username)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewBaseFilesMetadataService creates a new instance of BaseFilesMetadataService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewBaseFilesMetadataService(t interface {
@@ -5,6 +5,8 @@ package tests
 import (
 	api "stealthy-backend/api"
 
+	io "io"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -13,9 +15,9 @@ type BaseFilesService struct {
 	mock.Mock
 }
 
-// AddFile provides a mock function with given fields: request
-func (_m *BaseFilesService) AddFile(request *api.FileData) (*api.AddFileResponse, error) {
-	ret := _m.Called(request)
+// AddFile provides a mock function with given fields: request, content
+func (_m *BaseFilesService) AddFile(request *api.FileData, content io.Reader) (*api.AddFileResponse, error) {
+	ret := _m.Called(request, content)
 
 	if len(ret) == 0 {
 		panic("no return value specified for AddFile")
@@ -23,19 +25,19 @@ func (_m *BaseFilesService) AddFile(request *api.FileData) (*api.AddFileResponse
 
 	var r0 *api.AddFileResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(*api.FileData) (*api.AddFileResponse, error)); ok {
-		return rf(request)
+	if rf, ok := ret.Get(0).(func(*api.FileData, io.Reader) (*api.AddFileResponse, error)); ok {
+		return rf(request, content)
 	}
-	if rf, ok := ret.Get(0).(func(*api.FileData) *api.AddFileResponse); ok {
-		r0 = rf(request)
+	if rf, ok := ret.Get(0).(func(*api.FileData, io.Reader) *api.AddFileResponse); ok {
+		r0 = rf(request, content)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*api.AddFileResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(*api.FileData) error); ok {
-		r1 = rf(request)
+	if rf, ok := ret.Get(1).(func(*api.FileData, io.Reader) error); ok {
+		r1 = rf(request, content)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -71,29 +73,105 @@ func (_m *BaseFilesService) CheckFileDataExists(fileId string) (bool, error) {
 	return r0, r1
 }
 
-// GetFile provides a mock function with given fields: fileId
-func (_m *BaseFilesService) GetFile(fileId string) (*api.FileData, error) {
+// DeleteFile provides a mock function with given fields: fileId
+func (_m *BaseFilesService) DeleteFile(fileId string) error {
 	ret := _m.Called(fileId)
 
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteFile")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(fileId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteFiles provides a mock function with given fields: fileIds
+func (_m *BaseFilesService) DeleteFiles(fileIds []string) (int64, error) {
+	ret := _m.Called(fileIds)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteFiles")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func([]string) (int64, error)); ok {
+		return rf(fileIds)
+	}
+	if rf, ok := ret.Get(0).(func([]string) int64); ok {
+		r0 = rf(fileIds)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func([]string) error); ok {
+		r1 = rf(fileIds)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFile provides a mock function with given fields: file
+func (_m *BaseFilesService) GetFile(file *api.FileData) (*api.FileData, error) {
+	ret := _m.Called(file)
+
 	if len(ret) == 0 {
 		panic("no return value specified for GetFile")
 	}
 
 	var r0 *api.FileData
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) (*api.FileData, error)); ok {
-		return rf(fileId)
+	if rf, ok := ret.Get(0).(func(*api.FileData) (*api.FileData, error)); ok {
+		return rf(file)
 	}
-	if rf, ok := ret.Get(0).(func(string) *api.FileData); ok {
-		r0 = rf(fileId)
+	if rf, ok := ret.Get(0).(func(*api.FileData) *api.FileData); ok {
+		r0 = rf(file)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*api.FileData)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(fileId)
+	if rf, ok := ret.Get(1).(func(*api.FileData) error); ok {
+		r1 = rf(file)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OpenFile provides a mock function with given fields: file
+func (_m *BaseFilesService) OpenFile(file *api.FileData) (io.ReadSeekCloser, error) {
+	ret := _m.Called(file)
+
+	if len(ret) == 0 {
+		panic("no return value specified for OpenFile")
+	}
+
+	var r0 io.ReadSeekCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func(*api.FileData) (io.ReadSeekCloser, error)); ok {
+		return rf(file)
+	}
+	if rf, ok := ret.Get(0).(func(*api.FileData) io.ReadSeekCloser); ok {
+		r0 = rf(file)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadSeekCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(*api.FileData) error); ok {
+		r1 = rf(file)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -161,6 +161,72 @@ func (_m *BaseUserService) GetUserPublicData(username string) (*api.UserResponse
 	return r0, r1
 }
 
+// GetUserStorage provides a mock function with given fields: username
+func (_m *BaseUserService) GetUserStorage(username string) (*api.UserStorage, error) {
+	ret := _m.Called(username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserStorage")
+	}
+
+	var r0 *api.UserStorage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (*api.UserStorage, error)); ok {
+		return rf(username)
+	}
+	if rf, ok := ret.Get(0).(func(string) *api.UserStorage); ok {
+		r0 = rf(username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.UserStorage)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReleaseStorage provides a mock function with given fields: username, usage
+func (_m *BaseUserService) ReleaseStorage(username string, usage *api.UserUsage) error {
+	ret := _m.Called(username, usage)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReleaseStorage")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *api.UserUsage) error); ok {
+		r0 = rf(username, usage)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReserveStorage provides a mock function with given fields: username, size
+func (_m *BaseUserService) ReserveStorage(username string, size int64) error {
+	ret := _m.Called(username, size)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReserveStorage")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int64) error); ok {
+		r0 = rf(username, size)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewBaseUserService creates a new instance of BaseUserService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewBaseUserService(t interface {
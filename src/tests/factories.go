@@ -5,4 +5,16 @@ import (
 	"stealthy-backend/api"
 )
 
-var FileDataFactory = fabricator.New[api.FileData](api.FileData{})
+// Files are built as stored without encryption, tests of encrypted content
+// set it explicitly.
+var plainContent = map[string]any{"Encryption": (*api.FileEncryption)(nil)}
+
+var FileDataFactory = fabricator.New[api.FileData](
+	api.FileData{},
+	fabricator.Options[api.FileData]{Defaults: plainContent},
+)
+
+var FileMetadataFactory = fabricator.New[api.FileMetadata](
+	api.FileMetadata{},
+	fabricator.Options[api.FileMetadata]{Defaults: plainContent},
+)